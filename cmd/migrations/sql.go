@@ -1,16 +1,38 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/svvictorelias/shipping-pack-backend/internal/api"
+	"github.com/svvictorelias/shipping-pack-backend/internal/config"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
 
 	"github.com/svvictorelias/go-migrate/pkg/migrate"
 )
 
 func main() {
+	cfg, _, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// the SQLite store applies its own migrations when opened
+	if path, ok := cfg.Database.SQLitePath(); ok {
+		db, err := store.OpenSQLite(context.Background(), path)
+		if err != nil {
+			log.Fatalf("Erro ao aplicar migrations: %v", err)
+		}
+		db.Close()
+		return
+	}
 	// Setup DB
-	db, err := api.SetupDB()
+	db, err := api.SetupDB(cfg.Database.URL)
 	if err != nil {
 		log.Fatalf("DB not available: %v", err)
 	}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/api"
+	"github.com/svvictorelias/shipping-pack-backend/internal/config"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+var keysUsage = `usage:
+  packcalc keys create -name NAME -scopes SCOPE[,SCOPE...]
+  packcalc keys list
+  packcalc keys revoke -id ID
+
+scopes: ` + strings.Join(service.Scopes, ", ")
+
+// runKeys manages API keys in the store of cfg.
+func runKeys(cfg config.Database, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+	ctx := context.Background()
+	var svc *service.Service
+	if path, ok := cfg.SQLitePath(); ok {
+		db, err := store.OpenSQLite(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		svc = service.NewService(store.NewSQLiteStore(db))
+	} else {
+		db, err := api.SetupDB(cfg.URL)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		svc = service.NewService(store.NewPostgresStore(db))
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		name := fs.String("name", "", "who or what the key is for")
+		scopes := fs.String("scopes", "", "comma separated scopes")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		secret, key, err := svc.CreateAPIKey(ctx, *name, strings.Split(*scopes, ","))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "created key %d (%s) with scopes %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+		fmt.Fprintf(out, "%s\n", secret)
+		fmt.Fprintln(out, "store it now: it cannot be shown again")
+		return nil
+	case "list":
+		keys, err := svc.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tREVOKED")
+		for _, k := range keys {
+			revoked := "-"
+			if !k.RevokedAt.IsZero() {
+				revoked = k.RevokedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","), k.CreatedAt.Format(time.RFC3339), revoked)
+		}
+		return tw.Flush()
+	case "revoke":
+		fs := flag.NewFlagSet("keys revoke", flag.ContinueOnError)
+		id := fs.Int("id", 0, "id of the key to revoke")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if err := svc.RevokeAPIKey(ctx, *id); errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("key %d not found or already revoked", *id)
+		} else if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "revoked key %d\n", *id)
+		return nil
+	default:
+		return errors.New(keysUsage)
+	}
+}
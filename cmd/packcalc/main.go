@@ -1,52 +1,230 @@
 package main
 
 import (
-	"log"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/svvictorelias/shipping-pack-backend/internal/api"
+	"github.com/svvictorelias/shipping-pack-backend/internal/config"
 	"github.com/svvictorelias/shipping-pack-backend/internal/service"
 	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
 
 	_ "github.com/lib/pq"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		cfg := loadConfig(nil)
+		if err := runKeys(cfg.Database, os.Args[2:], os.Stdout); err != nil {
+			fatal("keys", err)
+		}
+		return
+	}
+
+	cfg := loadConfig(os.Args[1:])
+	shutdownTracing, err := tracing.Setup(tracingOptions(cfg.Tracing))
+	if err != nil {
+		fatal("tracing", err)
+	}
+	err = run(cfg)
+	// spans still buffered are written before exiting, even on error
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if terr := shutdownTracing(ctx); terr != nil {
+		slog.Error("tracing shutdown", "error", terr)
+	}
+	if err != nil {
+		fatal("server", err)
+	}
+}
+
+// run serves the API of cfg until shutdown.
+func run(cfg config.Config) error {
+	if path, ok := cfg.Database.SQLitePath(); ok {
+		db, err := store.OpenSQLite(context.Background(), path)
+		if err != nil {
+			return fmt.Errorf("SQLite store not available: %w", err)
+		}
+		slog.Info("serving from SQLite", "file", path)
+		return runDB(cfg, store.NewSQLiteStore(db), db, "sqlite")
+	}
+
 	// Setup DB
-	db, err := api.SetupDB()
+	db, err := api.SetupDB(cfg.Database.URL)
 	if err != nil {
-		log.Printf("DB not available: %v. Falling back to mock store (development).", err)
-		// fallback to mock store to allow local dev without DB
-		mock := store.NewMockStore([]int{250, 500, 1000, 2000, 5000})
-		svc := service.NewService(mock)
-		srv := api.NewServer(svc, nil)
-		startHTTP(srv)
-		return
+		if !cfg.Database.AllowFallback {
+			return fmt.Errorf("DB not available: %w", err)
+		}
+		slog.Warn("DB not available, falling back to mock store (development); calculations are lost on restart, set STORE=sqlite://PATH to keep them", "error", err)
+		// fallback to mock store to allow local dev without DB; it has no
+		// API keys, so unless auth.disabled every protected route answers 401
+		// rather than an outage opening the API
+		mock := store.Instrument(store.NewMockStore(cfg.Packs.Default))
+		svc := newService(cfg, mock)
+		srv := newServer(cfg, svc, nil).WithFallback(err).WithAuth(!cfg.Auth.Disabled)
+		if cfg.Auth.Disabled {
+			slog.Info("API key authentication disabled (auth.disabled)")
+		} else {
+			slog.Warn("API key authentication stays on and the mock store has no keys; set AUTH_DISABLED=true for local development")
+		}
+		return serve(cfg, srv, svc, nil)
 	}
+	configurePool(cfg.Database, db)
+	return runDB(cfg, store.NewPostgresStore(db), db, "postgres")
+}
 
-	// create Postgres store
-	pstore := store.NewPostgresStore(db)
-	svc := service.NewService(pstore)
+// runDB serves the API of cfg from st, the store of the named backend on
+// db, until shutdown.
+func runDB(cfg config.Config, st store.Store, db *sql.DB, backend string) error {
+	svc := newService(cfg, store.Instrument(st))
+
+	if cfg.Auth.Disabled {
+		slog.Info("API key authentication disabled (auth.disabled)")
+	}
+	srv := newServer(cfg, svc, db).WithBackend(backend).WithAuth(!cfg.Auth.Disabled)
+	return serve(cfg, srv, svc, db)
+}
 
-	srv := api.NewServer(svc, db)
-	startHTTP(srv)
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
-func startHTTP(srv *api.Server) {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// loadConfig loads the configuration from args and the environment,
+// printing it and exiting for -print-config, and installs the logger it
+// configures as the default.
+func loadConfig(args []string) config.Config {
+	cfg, opts, err := config.Load(args, os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		config.Usage(os.Stderr)
+		os.Exit(0)
 	}
-	h := srv.Routes()
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	if opts.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fatal("print configuration", err)
+		}
+		os.Exit(0)
+	}
+	slog.SetDefault(slog.New(cfg.Log.Handler(os.Stdout)))
+	if opts.File != "" {
+		slog.Info("configuration read", "file", opts.File)
+	}
+	return cfg
+}
+
+// newServer builds the API server of svc with the server and rate limit
+// settings of cfg.
+func newServer(cfg config.Config, svc *service.Service, db *sql.DB) *api.Server {
+	srv := api.NewServer(svc, db).
+		WithCORSOrigins(cfg.Server.CORSOrigins).
+		WithBatchWorkers(cfg.Solver.BatchWorkers).
+		WithReadyTimeout(time.Duration(cfg.Server.ReadyTimeout))
+	if limits, on := rateLimits(cfg.RateLimit); on {
+		srv.WithRateLimits(limits)
+	} else {
+		slog.Info("rate limiting disabled (rate_limit.default=off)")
+	}
+	return srv
+}
+
+// configurePool applies the pool settings of cfg to db. Zero values keep
+// the database/sql defaults.
+func configurePool(cfg config.Database, db *sql.DB) {
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
+	}
+}
+
+// serve runs srv until SIGINT or SIGTERM, then shuts down in order: /readyz
+// starts failing, the shutdown delay passes so load balancers notice, the
+// listener closes and in-flight requests get the shutdown timeout to finish
+// before their contexts are canceled, the results svc still has to save get
+// the flush timeout, and finally db is closed. A second signal during the
+// delay exits at once.
+func serve(c config.Config, srv *api.Server, svc *service.Service, db *sql.DB) error {
+	cfg := c.Server
+	port := strconv.Itoa(cfg.Port)
+
+	// canceled when the drain timeout expires, so requests still running
+	// roll back their transactions instead of being cut mid-write
+	base, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 	s := &http.Server{
-		Addr:           ":" + port,
-		Handler:        h,
-		ReadTimeout:    5 * time.Second,
-		WriteTimeout:   20 * time.Second,
-		MaxHeaderBytes: 1 << 20,
-	}
-	log.Printf("listening on :%s", port)
-	log.Fatal(s.ListenAndServe())
+		Addr:              ":" + port,
+		Handler:           srv.Routes(),
+		ReadTimeout:       time.Duration(cfg.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(cfg.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.IdleTimeout),
+		MaxHeaderBytes:    1 << 20,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", s.Addr)
+		errc <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	// restore default signal handling so a second signal exits at once
+	stop()
+	slog.Info("shutting down: draining", "delay", cfg.ShutdownDelay.String())
+	srv.Drain()
+	time.Sleep(time.Duration(cfg.ShutdownDelay))
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout))
+	defer cancel()
+	err := s.Shutdown(shutdownCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn("shutdown: requests still running, canceling them", "timeout", cfg.ShutdownTimeout.String())
+		cancelRequests()
+		err = s.Close()
+	}
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), time.Duration(c.Persistence.FlushTimeout))
+	defer cancelFlush()
+	if ferr := svc.Flush(flushCtx); ferr != nil {
+		slog.Error("shutdown: calculations not saved were dead-lettered", "error", ferr)
+	}
+	if db != nil {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	slog.Info("shutdown complete")
+	return nil
 }
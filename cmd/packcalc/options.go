@@ -0,0 +1,70 @@
+package main
+
+import (
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/api"
+	"github.com/svvictorelias/shipping-pack-backend/internal/config"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+)
+
+// The functions below map a valid configuration onto the packages it
+// configures.
+
+// newService returns the service of st with the limits and persistence of
+// cfg.
+func newService(cfg config.Config, st store.Store) *service.Service {
+	return service.NewService(st).
+		WithPackLimits(packLimits(cfg.Packs)).
+		WithSolverLimits(service.SolverLimits{MaxItems: cfg.Solver.MaxItems, MaxTarget: cfg.Solver.MaxTarget}).
+		WithPersistence(persistence(cfg.Persistence))
+}
+
+func packLimits(c config.Packs) service.PackLimits {
+	return service.PackLimits{MinSize: c.MinSize, MaxSize: c.MaxSize, MaxPacks: c.MaxCount}
+}
+
+func persistence(c config.Persistence) service.Persistence {
+	return service.Persistence{
+		Policy:      c.Policy,
+		QueueSize:   c.QueueSize,
+		MaxAttempts: c.MaxAttempts,
+		Backoff:     time.Duration(c.Backoff),
+		MaxBackoff:  time.Duration(c.MaxBackoff),
+		DeadLetter:  c.DeadLetterFile,
+	}
+}
+
+// rateLimits returns the rate limits of the API, ok is false when rate
+// limiting is off.
+func rateLimits(c config.RateLimit) (limits api.RateLimits, ok bool) {
+	if c.Default == "off" {
+		return api.RateLimits{}, false
+	}
+	limits.Default = rateLimit(c.Default)
+	if len(c.Clients) > 0 {
+		limits.Clients = make(map[string]api.RateLimit, len(c.Clients))
+		for client, v := range c.Clients {
+			limits.Clients[client] = rateLimit(v)
+		}
+	}
+	limits.CostUnit = c.CostUnit
+	limits.TrustProxy = c.TrustProxy
+	return limits, true
+}
+
+func rateLimit(v string) api.RateLimit {
+	rate, burst, _ := config.ParseRateLimit(v)
+	return api.RateLimit{Rate: rate, Burst: burst}
+}
+
+func tracingOptions(c config.Tracing) tracing.Options {
+	return tracing.Options{
+		Exporter:    c.Exporter,
+		File:        c.File,
+		SampleRatio: c.SampleRatio,
+		Service:     "packcalc",
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+type apiKeyCtxKey struct{}
+
+// apiKeyFromContext returns the key a request was authenticated with, ok is
+// false when authentication is off.
+func apiKeyFromContext(ctx context.Context) (store.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyCtxKey{}).(store.APIKey)
+	return key, ok
+}
+
+// authorize wraps h so that it needs an API key, sent as a bearer token,
+// with the read scope for GET and HEAD and the write scope otherwise. It
+// returns h unchanged when authentication is off.
+func (s *Server) authorize(read, write string, h http.HandlerFunc) http.HandlerFunc {
+	if !s.auth {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		scope := write
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope = read
+		}
+		secret, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="packcalc"`)
+			writeProblem(w, http.StatusUnauthorized, "unauthorized", "api key required")
+			return
+		}
+		key, err := s.svc.Authenticate(r.Context(), secret)
+		if errors.Is(err, service.ErrUnauthenticated) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="packcalc", error="invalid_token"`)
+			writeProblem(w, http.StatusUnauthorized, "unauthorized", err.Error())
+			return
+		}
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		if !service.HasScope(key, scope) {
+			writeProblem(w, http.StatusForbidden, "forbidden", fmt.Sprintf("api key lacks scope %s", scope))
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), apiKeyCtxKey{}, key)))
+	}
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestAuthorize(t *testing.T) {
+	ctx := context.Background()
+	svc := service.NewService(store.NewMockStore([]int{23, 31, 53}))
+	reader, _, err := svc.CreateAPIKey(ctx, "reader", []string{service.ScopePacksRead, service.ScopeCalculate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer, key, err := svc.CreateAPIKey(ctx, "writer", []string{service.ScopePacksWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prometheus, _, err := svc.CreateAPIKey(ctx, "prometheus", []string{service.ScopeMetricsRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(svc, nil).WithAuth(true).Routes()
+
+	cases := []struct {
+		name, method, path, auth string
+		status                   int
+	}{
+		{"health is public", http.MethodGet, "/health", "", 200},
+		{"no key", http.MethodGet, "/packs", "", 401},
+		{"unknown key", http.MethodGet, "/packs", "Bearer pk_nope", 401},
+		{"not bearer", http.MethodGet, "/packs", "Basic " + reader, 401},
+		{"read scope", http.MethodGet, "/packs", "Bearer " + reader, 200},
+		{"calculate scope", http.MethodPost, "/calculate", "Bearer " + reader, 200},
+		{"missing write scope", http.MethodPost, "/packs", "Bearer " + reader, 403},
+		{"missing history scope", http.MethodGet, "/calculations", "Bearer " + reader, 403},
+		{"write scope", http.MethodPost, "/packs", "bearer " + writer, 200},
+		{"write only", http.MethodGet, "/packs", "Bearer " + writer, 403},
+		{"metrics need a key", http.MethodGet, "/metrics", "", 401},
+		{"missing metrics scope", http.MethodGet, "/metrics", "Bearer " + reader, 403},
+		{"metrics scope", http.MethodGet, "/metrics", "Bearer " + prometheus, 200},
+		{"metrics only", http.MethodGet, "/packs", "Bearer " + prometheus, 403},
+	}
+	body := map[string]string{"/packs": `{"packs":[23,31]}`, "/calculate": `{"items":10}`}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, bytes.NewReader([]byte(body[tc.path])))
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Fatalf("%s: expected %d got %d, body=%s", tc.name, tc.status, rec.Code, rec.Body.String())
+		}
+		if tc.status == 401 && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s: expected WWW-Authenticate header", tc.name)
+		}
+	}
+
+	// revoked keys stop working at once
+	if err := svc.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/packs", bytes.NewReader([]byte(body["/packs"])))
+	req.Header.Set("Authorization", "Bearer "+writer)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked key rejected, got %d", rec.Code)
+	}
+}
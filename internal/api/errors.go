@@ -0,0 +1,135 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+// Errors are RFC 7807 problem details. Code is stable for clients to switch
+// on; detail is meant for humans and may change.
+const problemContentType = "application/problem+json"
+
+// statusClientClosedRequest is the non-standard status (from nginx) logged
+// when the client went away before the response was written.
+const statusClientClosedRequest = 499
+
+// errInvalidJSON marks a request body, or a batch order, that is not valid
+// JSON.
+var errInvalidJSON = errors.New("invalid json")
+
+// fieldError is one invalid field of a request.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// problemCodes maps errors from the service layer to a status and code, in
+// order; the first match wins.
+var problemCodes = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{errInvalidJSON, http.StatusBadRequest, "invalid_json"},
+	{service.ErrInvalidObjective, http.StatusBadRequest, "invalid_objective"},
+	{calc.ErrInvalidAlternatives, http.StatusBadRequest, "invalid_alternatives"},
+	{calc.ErrInvalidTarget, http.StatusUnprocessableEntity, "invalid_target"},
+	{calc.ErrNoPacks, http.StatusUnprocessableEntity, "no_packs"},
+	{calc.ErrInvalidPackSize, http.StatusUnprocessableEntity, "invalid_pack_size"},
+	{calc.ErrNegativeStock, http.StatusUnprocessableEntity, "negative_stock"},
+	{calc.ErrNegativeCost, http.StatusUnprocessableEntity, "negative_cost"},
+	{calc.ErrInsufficientStock, http.StatusUnprocessableEntity, "insufficient_stock"},
+	{calc.ErrNoSolution, http.StatusUnprocessableEntity, "no_solution"},
+	{calc.ErrOrderTooLarge, http.StatusUnprocessableEntity, "order_too_large"},
+	{service.ErrTooManyItems, http.StatusUnprocessableEntity, "too_many_items"},
+	{service.ErrInvalidPackSet, http.StatusUnprocessableEntity, "invalid_pack_set"},
+	{store.ErrUnknownPackSize, http.StatusUnprocessableEntity, "unknown_pack_size"},
+	{service.ErrUnauthenticated, http.StatusUnauthorized, "unauthorized"},
+	{store.ErrNotFound, http.StatusNotFound, "not_found"},
+	{errRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{context.Canceled, statusClientClosedRequest, "client_closed_request"},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable, "timeout"},
+}
+
+// problemCode returns the status and code err is reported with.
+func problemCode(err error) (int, string) {
+	for _, p := range problemCodes {
+		if errors.Is(err, p.err) {
+			return p.status, p.code
+		}
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
+
+func problem(status int, code, detail string) map[string]interface{} {
+	title := http.StatusText(status)
+	if status == statusClientClosedRequest {
+		title = "Client Closed Request"
+	}
+	return map[string]interface{}{
+		"type":   "about:blank",
+		"title":  title,
+		"status": status,
+		"detail": detail,
+		"code":   code,
+	}
+}
+
+func writeProblemBody(w http.ResponseWriter, body map[string]interface{}) {
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(body["status"].(int))
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeProblem writes a problem with the given status, code and detail.
+func writeProblem(w http.ResponseWriter, status int, code, detail string) {
+	writeProblemBody(w, problem(status, code, detail))
+}
+
+// writeInvalid writes a 400 invalid_request listing every invalid field.
+func writeInvalid(w http.ResponseWriter, fields ...fieldError) {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Message
+	}
+	body := problem(http.StatusBadRequest, "invalid_request", strings.Join(msgs, "; "))
+	body["errors"] = fields
+	writeProblemBody(w, body)
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter) {
+	writeProblem(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+}
+
+// writeServiceErr writes err from the service layer with the status and code
+// of problemCodes. Insufficient stock also reports max_reachable and a
+// rejected pack set lists every violation in errors.
+func writeServiceErr(w http.ResponseWriter, err error) {
+	logError(w, err)
+	status, code := problemCode(err)
+	body := problem(status, code, err.Error())
+	var stockErr *calc.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		body["max_reachable"] = stockErr.MaxReachable
+	}
+	var packsErr *service.PackSetError
+	if errors.As(err, &packsErr) {
+		fields := make([]fieldError, len(packsErr.Violations))
+		for i, v := range packsErr.Violations {
+			fields[i] = fieldError{"packs", v.Message}
+			if v.Index >= 0 {
+				fields[i].Field = fmt.Sprintf("packs[%d]", v.Index)
+			}
+		}
+		body["errors"] = fields
+	}
+	writeProblemBody(w, body)
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestProblemCode(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("calculate 0 items: %w", calc.ErrInvalidTarget), http.StatusUnprocessableEntity, "invalid_target"},
+		{fmt.Errorf("sku %q: %w", "A", calc.ErrNoSolution), http.StatusUnprocessableEntity, "no_solution"},
+		{&calc.InsufficientStockError{Target: 10, MaxReachable: 5}, http.StatusUnprocessableEntity, "insufficient_stock"},
+		{fmt.Errorf("%w 7", store.ErrUnknownPackSize), http.StatusUnprocessableEntity, "unknown_pack_size"},
+		{fmt.Errorf("calculate 2000000 items: %w", service.ErrTooManyItems), http.StatusUnprocessableEntity, "too_many_items"},
+		{fmt.Errorf("version 3: %w", store.ErrNotFound), http.StatusNotFound, "not_found"},
+		{context.Canceled, statusClientClosedRequest, "client_closed_request"},
+		{context.DeadlineExceeded, http.StatusServiceUnavailable, "timeout"},
+		{errors.New("boom"), http.StatusInternalServerError, "internal_error"},
+	}
+	for _, tc := range cases {
+		status, code := problemCode(tc.err)
+		if status != tc.status || code != tc.code {
+			t.Errorf("%v: expected %d %s got %d %s", tc.err, tc.status, tc.code, status, code)
+		}
+	}
+}
+
+func TestProblemResponse_FieldErrors(t *testing.T) {
+	srv := setupServer()
+	payload := []byte(`{"lines":[{"sku":"","items":1},{"sku":"A","items":0}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/orders/calculate", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != problemContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var p struct {
+		Type   string       `json:"type"`
+		Title  string       `json:"title"`
+		Status int          `json:"status"`
+		Code   string       `json:"code"`
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if p.Type != "about:blank" || p.Title != "Bad Request" || p.Status != 400 || p.Code != "invalid_request" {
+		t.Fatalf("unexpected problem %+v", p)
+	}
+	// every invalid field is reported, not only the first
+	if len(p.Errors) != 2 || p.Errors[0].Field != "lines[0].sku" || p.Errors[1].Field != "lines[1].items" {
+		t.Fatalf("unexpected field errors %+v", p.Errors)
+	}
+}
@@ -1,54 +1,152 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"database/sql"
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
-	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/cors"
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
 	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
 
 	_ "github.com/lib/pq"
 )
 
 // Server holds dependencies for HTTP handlers.
 type Server struct {
-	svc *service.Service
-	db  *sql.DB
+	svc     *service.Service
+	db      *sql.DB
+	backend string // names the store on db in /readyz
+	auth    bool
+	limiter *rateLimiter
+
+	fallback     error // why the in-memory store replaced the database
+	readyTimeout time.Duration
+	draining     atomic.Bool
+	corsOrigins  []string
+	batchWorkers int
+	logger       *slog.Logger
 }
 
 // NewServer builds server given a store implementation.
 func NewServer(svc *service.Service, db *sql.DB) *Server {
-	return &Server{svc: svc, db: db}
+	return &Server{svc: svc, db: db, backend: "postgres", readyTimeout: defaultReadyTimeout, corsOrigins: []string{"*"}, logger: slog.Default()}
+}
+
+// WithCORSOrigins sets the origins allowed to call the API from a browser,
+// "*" for any, and returns s. It must be called before Routes.
+func (s *Server) WithCORSOrigins(origins []string) *Server {
+	s.corsOrigins = origins
+	return s
+}
+
+// WithBatchWorkers sets how many orders of a batch are calculated at once,
+// 0 for one per CPU, and returns s. It must be called before Routes.
+func (s *Server) WithBatchWorkers(n int) *Server {
+	s.batchWorkers = n
+	return s
+}
+
+// WithRateLimits turns per-client rate limiting on and returns s. It must be
+// called before Routes.
+func (s *Server) WithRateLimits(cfg RateLimits) *Server {
+	s.limiter = newRateLimiter(cfg)
+	return s
+}
+
+// WithAuth turns API key authentication on or off and returns s. It must be
+// called before Routes.
+func (s *Server) WithAuth(enabled bool) *Server {
+	s.auth = enabled
+	return s
 }
 
 func (s *Server) Routes() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.health)
-	mux.HandleFunc("/packs", s.packsHandler)
-	mux.HandleFunc("/calculate", s.calculateHandler)
+	mux.HandleFunc("/livez", s.livez)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/openapi.json", s.openAPIHandler)
+
+	// scopes needed for GET and for every other method; rate limits apply
+	// by IP until the key is checked, then by client
+	packsRW := func(h http.HandlerFunc) http.HandlerFunc {
+		return s.limitIP(s.authorize(service.ScopePacksRead, service.ScopePacksWrite, s.limit(h)))
+	}
+	calculate := func(h http.HandlerFunc) http.HandlerFunc {
+		return s.limitIP(s.authorize(service.ScopeCalculate, service.ScopeCalculate, s.limit(h)))
+	}
+	history := func(h http.HandlerFunc) http.HandlerFunc {
+		return s.limitIP(s.authorize(service.ScopeHistoryRead, service.ScopeHistoryRead, s.limit(h)))
+	}
+	metricsRead := func(h http.HandlerFunc) http.HandlerFunc {
+		return s.limitIP(s.authorize(service.ScopeMetricsRead, service.ScopeMetricsRead, s.limit(h)))
+	}
+	mux.HandleFunc("/metrics", metricsRead(metrics.Default.Handler().ServeHTTP))
+	mux.HandleFunc("/packs", packsRW(s.packsHandler))
+	mux.HandleFunc("/packs/costs", packsRW(s.packCostsHandler))
+	mux.HandleFunc("/packs/versions", packsRW(s.packVersionsHandler))
+	mux.HandleFunc("/packs/diff", packsRW(s.packDiffHandler))
+	mux.HandleFunc("/packs/rollback", packsRW(s.packRollbackHandler))
+	mux.HandleFunc("/calculate", calculate(s.calculateHandler))
+	mux.HandleFunc("/calculate/batch", calculate(s.calculateBatchHandler))
+	mux.HandleFunc("/inventory", packsRW(s.inventoryHandler))
+	mux.HandleFunc("/skus/{sku}/packs", packsRW(s.skuPacksHandler))
+	mux.HandleFunc("/orders/calculate", calculate(s.orderCalculateHandler))
+	mux.HandleFunc("/calculations", history(s.calculationsHandler))
+	mux.HandleFunc("/calculations/{id}", history(s.calculationHandler))
 
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
+		AllowedOrigins: s.corsOrigins,
 		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", requestid.Header},
+		ExposedHeaders: []string{requestid.Header},
 	})
 
-	return c.Handler(mux)
+	return withRequestID(s.observe(c.Handler(mux)))
 }
 
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "ts": time.Now().Format(time.RFC3339)})
 }
 
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIHandler serves the OpenAPI 3 document of every route.
+func (s *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(openAPISpec)
+}
+
 func (s *Server) packsHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		packs, err := s.svc.GetPacks()
+		packs, err := s.svc.GetPacks(r.Context())
 		if err != nil {
-			writeErr(w, http.StatusInternalServerError, err.Error())
+			writeServiceErr(w, err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]interface{}{"packs": packs})
@@ -58,49 +156,258 @@ func (s *Server) packsHandler(w http.ResponseWriter, r *http.Request) {
 			Packs []int `json:"packs"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-			writeErr(w, http.StatusBadRequest, "invalid json")
+			writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
 			return
 		}
 		if len(body.Packs) == 0 {
-			writeErr(w, http.StatusBadRequest, "packs required")
+			writeInvalid(w, fieldError{"packs", "packs required"})
+			return
+		}
+		set, err := s.svc.SetPacks(r.Context(), body.Packs)
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, packSetJSON(set))
+		return
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+}
+
+// packSetJSON is the answer to a stored pack set: the sizes as stored and
+// any warnings about them.
+func packSetJSON(set service.PackSet) map[string]interface{} {
+	warnings := set.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	return map[string]interface{}{"ok": true, "packs": set.Packs, "warnings": warnings}
+}
+
+func (s *Server) packCostsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		costs, err := s.svc.GetPackCosts(r.Context())
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"costs": costs})
+		return
+	case http.MethodPost:
+		var body struct {
+			Costs map[int]float64 `json:"costs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
 			return
 		}
-		if err := s.svc.SetPacks(body.Packs); err != nil {
-			writeErr(w, http.StatusInternalServerError, err.Error())
+		var fields []fieldError
+		for size, cost := range body.Costs {
+			if cost < 0 {
+				fields = append(fields, fieldError{fmt.Sprintf("costs.%d", size), "costs must not be negative"})
+			}
+		}
+		if fields != nil {
+			writeInvalid(w, fields...)
+			return
+		}
+		if err := s.svc.SetPackCosts(r.Context(), body.Costs); err != nil {
+			writeServiceErr(w, err)
 			return
 		}
 		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
 		return
 	default:
-		writeErr(w, http.StatusMethodNotAllowed, "method not allowed")
+		writeMethodNotAllowed(w)
+		return
+	}
+}
+
+func (s *Server) packVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	catalogs, err := s.svc.ListPackCatalogs(r.Context())
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+	out := make([]map[string]interface{}, len(catalogs))
+	for i, c := range catalogs {
+		out[i] = map[string]interface{}{
+			"version":    c.Version,
+			"active":     c.Active,
+			"packs":      c.Packs,
+			"costs":      c.Costs,
+			"created_at": c.CreatedAt.Format(time.RFC3339),
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"versions": out})
+}
+
+func (s *Server) packDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	q := r.URL.Query()
+	from, err := strconv.Atoi(q.Get("from"))
+	if err != nil || from <= 0 {
+		writeInvalid(w, fieldError{"from", "invalid from"})
+		return
+	}
+	to, err := strconv.Atoi(q.Get("to"))
+	if err != nil || to <= 0 {
+		writeInvalid(w, fieldError{"to", "invalid to"})
+		return
+	}
+	d, err := s.svc.DiffPackCatalogs(r.Context(), from, to)
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+	costs := make([]map[string]interface{}, len(d.Costs))
+	for i, c := range d.Costs {
+		costs[i] = map[string]interface{}{"size": c.Size, "from": c.From, "to": c.To}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"from":    d.From,
+		"to":      d.To,
+		"added":   d.Added,
+		"removed": d.Removed,
+		"costs":   costs,
+	})
+}
+
+func (s *Server) packRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	var body struct {
+		Version int `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if body.Version <= 0 {
+		writeInvalid(w, fieldError{"version", "version must be positive"})
+		return
+	}
+	err := s.svc.RollbackPacks(r.Context(), body.Version)
+	if errors.Is(err, store.ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, "not_found", "catalog version not found")
+		return
+	}
+	if err != nil {
+		writeServiceErr(w, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ok": true, "version": body.Version})
 }
 
 func (s *Server) calculateHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		writeErr(w, http.StatusMethodNotAllowed, "method")
+		writeMethodNotAllowed(w)
 		return
 	}
 	var body struct {
-		Items int `json:"items"`
+		Items     int         `json:"items"`
+		Stock     map[int]int `json:"stock"`
+		Objective string      `json:"objective"`
+		ItemValue float64     `json:"item_value"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeErr(w, http.StatusBadRequest, "invalid json")
+		writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
 		return
 	}
 	if body.Items <= 0 {
-		writeErr(w, http.StatusBadRequest, "items must be > 0")
+		writeInvalid(w, fieldError{"items", "items must be > 0"})
+		return
+	}
+	logItems(w, body.Items)
+	alternatives := 0
+	if v := r.URL.Query().Get("alternatives"); v != "" {
+		k, err := strconv.Atoi(v)
+		if err != nil || k < 1 || k > calc.MaxAlternatives {
+			writeInvalid(w, fieldError{"alternatives", fmt.Sprintf("alternatives must be between 1 and %d", calc.MaxAlternatives)})
+			return
+		}
+		alternatives = k
+	}
+	explain := false
+	if v := r.URL.Query().Get("explain"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeInvalid(w, fieldError{"explain", "explain must be true or false"})
+			return
+		}
+		explain = b
+	}
+	// the result is saved with the version of the packs it used, and costs
+	// come from that version too
+	catalog, err := s.svc.ActiveCatalog(r.Context())
+	if err != nil {
+		writeServiceErr(w, err)
 		return
 	}
-	packs, err := s.svc.GetPacks()
+	obj, err := s.svc.Objective(body.Objective, body.ItemValue, catalog)
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServiceErr(w, err)
+		return
+	}
+	packs := catalog.Packs
+	if !s.charge(w, r, body.Items, packs) {
+		return
+	}
+	// stock from the request wins, and an empty one limits nothing; only
+	// without one (absent or null) does the stored inventory apply
+	stock := body.Stock
+	if stock == nil {
+		if stock, err = s.svc.GetStock(r.Context()); err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+	}
+	// alternatives and explanations are about waste then pack count, so they
+	// only make sense for the default objective; compute them before persisting
+	if (alternatives > 0 || explain) && obj != nil {
+		writeProblem(w, http.StatusBadRequest, "invalid_request", "alternatives and explain require the waste objective")
 		return
 	}
-	counts, total, packCount, err := s.svc.Calculate(body.Items, packs)
+	var sols []calc.Solution
+	if alternatives > 0 {
+		if sols, err = s.svc.Alternatives(r.Context(), body.Items, packs, stock, alternatives); err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+	}
+	var expl *calc.Explanation
+	if explain {
+		e, err := s.svc.Explain(r.Context(), body.Items, packs, stock)
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		expl = &e
+	}
+	var counts map[int]int
+	var total, packCount int
+	switch {
+	case len(stock) > 0:
+		counts, total, packCount, err = s.svc.CalculateBounded(r.Context(), body.Items, catalog, stock, obj)
+	case obj != nil:
+		counts, total, packCount, err = s.svc.CalculateWithObjective(r.Context(), body.Items, catalog, obj)
+	default:
+		counts, total, packCount, err = s.svc.Calculate(r.Context(), body.Items, catalog)
+	}
 	if err != nil {
-		writeErr(w, http.StatusInternalServerError, err.Error())
+		writeServiceErr(w, err)
 		return
 	}
 	resp := map[string]interface{}{
@@ -109,25 +416,522 @@ func (s *Server) calculateHandler(w http.ResponseWriter, r *http.Request) {
 		"pack_count":  packCount,
 		"waste":       total - body.Items,
 	}
+	if obj != nil {
+		resp["cost"] = calc.TotalCost(obj, body.Items, counts, total)
+	}
+	if sols != nil {
+		alts := make([]map[string]interface{}, len(sols))
+		for i, sol := range sols {
+			alts[i] = map[string]interface{}{
+				"counts":      sol.Counts,
+				"total_items": sol.Total,
+				"pack_count":  sol.PackCount,
+				"waste":       sol.Total - body.Items,
+			}
+		}
+		resp["alternatives"] = alts
+	}
+	if expl != nil {
+		resp["explanation"] = explanationJSON(*expl, body.Items)
+	}
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// batchRef identifies a batch order in its result line.
+type batchRef struct {
+	line int
+	id   json.RawMessage
+}
+
+// calculateBatchHandler reads orders as a JSON array or NDJSON and streams
+// one NDJSON result per order as soon as it is computed.
+func (s *Server) calculateBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	ctx := r.Context()
+	charge, err := s.chargeFunc(r)
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+	in := make(chan service.BatchItem)
+	workers := s.batchWorkers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results, err := s.svc.CalculateBatch(ctx, in, workers)
+	if err != nil {
+		close(in)
+		writeServiceErr(w, err)
+		return
+	}
+	go func() {
+		defer close(in)
+		readBatch(ctx, r.Body, in, charge)
+	}()
+
+	// results are written while the body is still being read
+	rc := http.NewResponseController(w)
+	_ = rc.EnableFullDuplex()
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	for res := range results {
+		logItems(w, res.Items)
+		ref := res.Ref.(batchRef)
+		line := map[string]interface{}{"line": ref.line}
+		if ref.id != nil {
+			line["id"] = ref.id
+		}
+		if res.Err != nil {
+			_, line["code"] = problemCode(res.Err)
+			line["error"] = res.Err.Error()
+		} else {
+			line["counts"] = res.Counts
+			line["total_items"] = res.Total
+			line["pack_count"] = res.PackCount
+			line["waste"] = res.Total - res.Items
+		}
+		_ = enc.Encode(line)
+		_ = rc.Flush()
+	}
+}
+
+// readBatch sends every order of body to in, numbered from 1. A JSON array
+// is read element by element; anything else is NDJSON, one order per line.
+// Orders that cannot be read, or that charge rejects, are sent with Err set.
+func readBatch(ctx context.Context, body io.Reader, in chan<- service.BatchItem, charge func(items int) error) {
+	send := func(item service.BatchItem) bool {
+		select {
+		case in <- item:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	parse := func(line int, raw []byte) service.BatchItem {
+		var order struct {
+			ID    json.RawMessage `json:"id"`
+			Items int             `json:"items"`
+		}
+		err := json.Unmarshal(raw, &order)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", errInvalidJSON, err)
+		} else {
+			err = charge(order.Items)
+		}
+		return service.BatchItem{Ref: batchRef{line: line, id: order.ID}, Items: order.Items, Err: err}
+	}
+
+	br := bufio.NewReader(body)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return
+	}
+
+	if first == '[' {
+		dec := json.NewDecoder(br)
+		if _, err := dec.Token(); err != nil {
+			return
+		}
+		for line := 1; dec.More(); line++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				// the array is malformed past this point
+				send(service.BatchItem{Ref: batchRef{line: line}, Err: fmt.Errorf("%w: %v", errInvalidJSON, err)})
+				return
+			}
+			if !send(parse(line, raw)) {
+				return
+			}
+		}
+		return
+	}
+
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	line := 0
+	for sc.Scan() {
+		line++
+		raw := bytes.TrimSpace(sc.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if !send(parse(line, raw)) {
+			return
+		}
+	}
+	if err := sc.Err(); err != nil {
+		send(service.BatchItem{Ref: batchRef{line: line + 1}, Err: err})
+	}
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte unread.
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+func explanationJSON(e calc.Explanation, items int) map[string]interface{} {
+	out := map[string]interface{}{
+		"minimal_total":       e.MinimalTotal,
+		"unreachable_totals":  e.Unreachable,
+		"gcd":                 e.GCD,
+		"largest_unreachable": e.LargestUnreachable,
+	}
+	if e.RunnersUp != nil {
+		runners := make([]map[string]interface{}, len(e.RunnersUp))
+		for i, sol := range e.RunnersUp {
+			runners[i] = map[string]interface{}{
+				"counts":      sol.Counts,
+				"total_items": sol.Total,
+				"pack_count":  sol.PackCount,
+				"waste":       sol.Total - items,
+			}
+		}
+		out["runners_up"] = runners
+	}
+	return out
+}
+
+func (s *Server) skuPacksHandler(w http.ResponseWriter, r *http.Request) {
+	sku := r.PathValue("sku")
+	switch r.Method {
+	case http.MethodGet:
+		packs, err := s.svc.GetSKUPacks(r.Context(), sku)
+		if errors.Is(err, store.ErrNotFound) {
+			writeProblem(w, http.StatusNotFound, "not_found", "sku not found")
+			return
+		}
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"sku": sku, "packs": packs})
+		return
+	case http.MethodPost:
+		var body struct {
+			Packs []int `json:"packs"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
+			return
+		}
+		if len(body.Packs) == 0 {
+			writeInvalid(w, fieldError{"packs", "packs required"})
+			return
+		}
+		set, err := s.svc.SetSKUPacks(r.Context(), sku, body.Packs)
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, packSetJSON(set))
+		return
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+}
+
+func (s *Server) orderCalculateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w)
+		return
+	}
+	var body struct {
+		Lines []struct {
+			SKU   string `json:"sku"`
+			Items int    `json:"items"`
+		} `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if len(body.Lines) == 0 {
+		writeInvalid(w, fieldError{"lines", "lines required"})
+		return
+	}
+	lines := make([]service.OrderLine, len(body.Lines))
+	seen := make(map[string]bool, len(body.Lines))
+	var fields []fieldError
+	for i, l := range body.Lines {
+		if l.SKU == "" {
+			fields = append(fields, fieldError{fmt.Sprintf("lines[%d].sku", i), fmt.Sprintf("lines[%d]: sku required", i)})
+		} else if seen[l.SKU] {
+			// stored pack items are keyed by sku, so each sku appears once
+			fields = append(fields, fieldError{fmt.Sprintf("lines[%d].sku", i), fmt.Sprintf("lines[%d]: duplicate sku %q", i, l.SKU)})
+		}
+		if l.Items <= 0 {
+			fields = append(fields, fieldError{fmt.Sprintf("lines[%d].items", i), fmt.Sprintf("lines[%d]: items must be > 0", i)})
+		}
+		seen[l.SKU] = true
+		lines[i] = service.OrderLine{SKU: l.SKU, Items: l.Items}
+	}
+	if fields != nil {
+		writeInvalid(w, fields...)
+		return
+	}
+
+	// SKU catalogs are not known yet, so lines are charged as if their
+	// sizes had no common divisor. The sum is checked against MaxItems
+	// line by line, so it cannot overflow.
+	maxItems := s.svc.SolverLimits().MaxItems
+	if maxItems <= 0 {
+		maxItems = math.MaxInt
+	}
+	ordered := 0
+	for _, l := range lines {
+		if l.Items > maxItems-ordered {
+			writeServiceErr(w, fmt.Errorf("%w: more than %d items in the order", service.ErrTooManyItems, maxItems))
+			return
+		}
+		ordered += l.Items
+	}
+	logItems(w, ordered)
+	if !s.charge(w, r, ordered, nil) {
+		return
+	}
+
+	results, err := s.svc.CalculateOrder(r.Context(), lines)
+	if errors.Is(err, store.ErrNotFound) {
+		writeProblem(w, http.StatusUnprocessableEntity, "unknown_sku", err.Error())
+		return
+	}
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+
+	var items, total, packCount int
+	out := make([]map[string]interface{}, len(results))
+	for i, l := range results {
+		out[i] = map[string]interface{}{
+			"sku":         l.SKU,
+			"items":       l.Items,
+			"counts":      l.Counts,
+			"total_items": l.TotalItems,
+			"pack_count":  l.PackCount,
+			"waste":       l.TotalItems - l.Items,
+		}
+		items += l.Items
+		total += l.TotalItems
+		packCount += l.PackCount
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"lines":       out,
+		"items":       items,
+		"total_items": total,
+		"pack_count":  packCount,
+		"waste":       total - items,
+	})
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+func (s *Server) calculationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	q := r.URL.Query()
+	f := store.CalculationFilter{Limit: defaultPageSize}
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &f.Limit},
+		{"cursor", &f.Before},
+		{"min_items", &f.MinItems},
+		{"max_items", &f.MaxItems},
+	}
+	for _, p := range ints {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeInvalid(w, fieldError{p.name, p.name + " must be a positive integer"})
+			return
+		}
+		*p.dst = n
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+	times := []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &f.From},
+		{"to", &f.To},
+	}
+	for _, p := range times {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeInvalid(w, fieldError{p.name, p.name + " must be an RFC 3339 timestamp"})
+			return
+		}
+		*p.dst = t
+	}
+	if v := q.Get("request_id"); v != "" {
+		if !requestid.Valid(v) {
+			writeInvalid(w, fieldError{"request_id", "request_id must be 1 to 128 printable ASCII characters without spaces"})
+			return
+		}
+		f.RequestID = v
+	}
+
+	// fetch one extra row to know whether another page exists
+	pageSize := f.Limit
+	f.Limit++
+	calcs, err := s.svc.ListCalculations(r.Context(), f)
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+	var next interface{}
+	if len(calcs) > pageSize {
+		calcs = calcs[:pageSize]
+		next = calcs[pageSize-1].ID
+	}
+	out := make([]map[string]interface{}, len(calcs))
+	for i, c := range calcs {
+		out[i] = calculationJSON(c)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"calculations": out, "next_cursor": next})
+}
+
+func (s *Server) calculationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id <= 0 {
+		writeInvalid(w, fieldError{"id", "invalid id"})
+		return
+	}
+	c, err := s.svc.GetCalculation(r.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		writeProblem(w, http.StatusNotFound, "not_found", "calculation not found")
+		return
+	}
+	if err != nil {
+		writeServiceErr(w, err)
+		return
+	}
+	resp := calculationJSON(c)
+	if c.Lines != nil {
+		lines := make([]map[string]interface{}, len(c.Lines))
+		for i, l := range c.Lines {
+			lines[i] = map[string]interface{}{
+				"sku":         l.SKU,
+				"items":       l.Items,
+				"counts":      l.Counts,
+				"total_items": l.TotalItems,
+				"pack_count":  l.PackCount,
+				"waste":       l.TotalItems - l.Items,
+			}
+		}
+		resp["lines"] = lines
+	} else {
+		resp["counts"] = c.Counts
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func calculationJSON(c store.Calculation) map[string]interface{} {
+	out := map[string]interface{}{
+		"id":          c.ID,
+		"items":       c.Items,
+		"total_items": c.TotalItems,
+		"pack_count":  c.PackCount,
+		"waste":       c.TotalItems - c.Items,
+		"created_at":  c.CreatedAt.Format(time.RFC3339),
+	}
+	if c.CatalogVersion > 0 {
+		out["catalog_version"] = c.CatalogVersion
+	}
+	if c.RequestID != "" {
+		out["request_id"] = c.RequestID
+	}
+	return out
+}
+
+func (s *Server) inventoryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stock, err := s.svc.GetStock(r.Context())
+		if err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"stock": stock})
+		return
+	case http.MethodPost:
+		var body struct {
+			Stock map[int]int `json:"stock"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeProblem(w, http.StatusBadRequest, "invalid_json", "invalid json")
+			return
+		}
+		var fields []fieldError
+		for size, qty := range body.Stock {
+			if qty < 0 {
+				fields = append(fields, fieldError{fmt.Sprintf("stock.%d", size), "stock must not be negative"})
+			}
+		}
+		if fields != nil {
+			writeInvalid(w, fields...)
+			return
+		}
+		if err := s.svc.SetStock(r.Context(), body.Stock); err != nil {
+			writeServiceErr(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]bool{"ok": true})
+		return
+	default:
+		writeMethodNotAllowed(w)
+		return
+	}
+}
+
 func writeJSON(w http.ResponseWriter, code int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(v)
 }
-func writeErr(w http.ResponseWriter, code int, msg string) {
-	writeJSON(w, code, map[string]string{"error": msg})
-}
 
-// SetupDB helper to open DB based on env DATABASE_URL
-func SetupDB() (*sql.DB, error) {
-	dsn := os.Getenv("DATABASE_URL")
+// SetupDB helper to open the Postgres DB at dsn, tracing its statements
+func SetupDB(dsn string) (*sql.DB, error) {
 	if dsn == "" {
 		return nil, ErrNoDBURL
 	}
-	db, err := sql.Open("postgres", dsn)
+	db, err := tracing.OpenDB("postgres", dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -2,10 +2,13 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/svvictorelias/shipping-pack-backend/internal/service"
@@ -97,6 +100,73 @@ func TestCalculateHandler_Success(t *testing.T) {
 	}
 }
 
+func TestCalculateHandler_Canceled(t *testing.T) {
+	mock := store.NewMockStore([]int{99991, 100003})
+	srv := NewServer(service.NewService(mock), nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":1000000}`))).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != statusClientClosedRequest {
+		t.Fatalf("expected 499 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	if mock.CountCalculations() != 0 {
+		t.Fatalf("canceled calculation must not be persisted")
+	}
+}
+
+func TestCalculateBatchHandler(t *testing.T) {
+	srv := setupServer()
+	bodies := map[string]string{
+		"array":  `[{"id":"a","items":53},{"id":2,"items":0},{"id":"c","items":"x"},{"items":24}]`,
+		"ndjson": "{\"id\":\"a\",\"items\":53}\n{\"id\":2,\"items\":0}\nnot json\n\n{\"items\":24}\n",
+	}
+	for name, body := range bodies {
+		req := httptest.NewRequest(http.MethodPost, "/calculate/batch", bytes.NewReader([]byte(body)))
+		rec := httptest.NewRecorder()
+		srv.Routes().ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 got %d, body=%s", name, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Fatalf("%s: unexpected content type %q", name, ct)
+		}
+		dec := json.NewDecoder(rec.Body)
+		errs, ok := 0, 0
+		for dec.More() {
+			var res struct {
+				Line       int             `json:"line"`
+				ID         json.RawMessage `json:"id"`
+				TotalItems int             `json:"total_items"`
+				Code       string          `json:"code"`
+				Error      string          `json:"error"`
+			}
+			if err := dec.Decode(&res); err != nil {
+				t.Fatalf("%s: invalid ndjson: %v", name, err)
+			}
+			switch {
+			case res.Error != "":
+				if res.Code != "invalid_target" && res.Code != "invalid_json" {
+					t.Fatalf("%s: unexpected code %q for %s", name, res.Code, res.Error)
+				}
+				errs++
+			case string(res.ID) == `"a"` && res.TotalItems == 53,
+				res.ID == nil && res.TotalItems == 31:
+				ok++
+			default:
+				t.Fatalf("%s: unexpected result line %+v", name, res)
+			}
+		}
+		if ok != 2 || errs != 2 {
+			t.Fatalf("%s: expected 2 results and 2 errors, got %d and %d", name, ok, errs)
+		}
+	}
+}
+
 func TestCalculateHandler_InvalidJSON(t *testing.T) {
 	srv := setupServer()
 	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`invalid-json`)))
@@ -155,6 +225,44 @@ func TestPostPacksHandler_MissingField(t *testing.T) {
 	}
 }
 
+func TestPostPacksHandler_Validation(t *testing.T) {
+	srv := setupServer()
+	req := httptest.NewRequest(http.MethodPost, "/packs", bytes.NewReader([]byte(`{"packs":[0,250,-1,250,5000000]}`)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var p struct {
+		Code   string       `json:"code"`
+		Errors []fieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if p.Code != "invalid_pack_set" || len(p.Errors) != 3 || p.Errors[2].Field != "packs[4]" {
+		t.Fatalf("expected every violation reported, got %+v", p)
+	}
+
+	// duplicates are dropped and a shared divisor is only a warning
+	req = httptest.NewRequest(http.MethodPost, "/packs", bytes.NewReader([]byte(`{"packs":[500,250,500]}`)))
+	rec = httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+	var resp struct {
+		Packs    []int    `json:"packs"`
+		Warnings []string `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if rec.Code != http.StatusOK || len(resp.Packs) != 2 || len(resp.Warnings) != 1 {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestPostPacksHandler_InternalError(t *testing.T) {
 	// cria um mock store que falha no SetPacks
 	mock := &failingStore{}
@@ -193,9 +301,541 @@ func TestHandlers_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestCalculateHandler_StockInRequest(t *testing.T) {
+	srv := setupServer()
+	payload := []byte(`{"items":100,"stock":{"53":1,"31":0,"23":1}}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp["code"] != "insufficient_stock" || resp["max_reachable"].(float64) != 76 {
+		t.Fatalf("expected max_reachable 76 got %v", resp["max_reachable"])
+	}
+}
+
+func TestInventoryHandler_StoredStockLimitsCalculate(t *testing.T) {
+	srv := setupServer()
+	h := srv.Routes()
+
+	payload := []byte(`{"stock":{"53":0}}`)
+	req := httptest.NewRequest(http.MethodPost, "/inventory", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":53}`)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Counts map[string]int `json:"counts"`
+		Total  int            `json:"total_items"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp.Counts["53"] != 0 || resp.Total != 54 {
+		t.Fatalf("expected 54 without 53-packs, got %+v", resp)
+	}
+
+	// alternatives respect it
+	req = httptest.NewRequest(http.MethodPost, "/calculate?alternatives=2", bytes.NewReader([]byte(`{"items":53}`)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var alts struct {
+		Total        int `json:"total_items"`
+		Alternatives []struct {
+			Counts map[string]int `json:"counts"`
+			Total  int            `json:"total_items"`
+		} `json:"alternatives"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &alts); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if alts.Total != 54 || len(alts.Alternatives) != 2 || alts.Alternatives[0].Total != 54 {
+		t.Fatalf("expected alternatives from 54 got %s", rec.Body.String())
+	}
+	for _, a := range alts.Alternatives {
+		if a.Counts["53"] != 0 {
+			t.Fatalf("expected alternatives without 53-packs got %s", rec.Body.String())
+		}
+	}
+
+	// and so does the explanation
+	req = httptest.NewRequest(http.MethodPost, "/calculate?explain=true", bytes.NewReader([]byte(`{"items":53}`)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var expl struct {
+		Explanation struct {
+			MinimalTotal int   `json:"minimal_total"`
+			Unreachable  []int `json:"unreachable_totals"`
+		} `json:"explanation"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &expl); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if expl.Explanation.MinimalTotal != 54 || len(expl.Explanation.Unreachable) != 1 {
+		t.Fatalf("expected 53 unreachable without 53-packs got %s", rec.Body.String())
+	}
+
+	// an empty stock in the request limits nothing, so orders above
+	// solver.max_target still solve
+	for _, body := range []string{`{"items":53,"stock":{}}`, `{"items":2000000,"stock":{}}`} {
+		req = httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(body)))
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200 got %d, body=%s", body, rec.Code, rec.Body.String())
+		}
+		resp.Counts = nil
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+		if resp.Counts["53"] == 0 {
+			t.Fatalf("%s: expected 53-packs without stock limits got %+v", body, resp)
+		}
+	}
+	req = httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":2000000}`)))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), "too_many_items") {
+		t.Fatalf("expected 422 too_many_items with the stored stock got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCalculateHandler_CostObjective(t *testing.T) {
+	mock := store.NewMockStore([]int{250, 1000})
+	if err := mock.SetPackCosts(context.Background(), map[int]float64{250: 1, 1000: 5}); err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(service.NewService(mock), nil)
+
+	payload := []byte(`{"items":1000,"objective":"cost"}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Counts map[string]int `json:"counts"`
+		Cost   float64        `json:"cost"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp.Counts["250"] != 4 || resp.Cost != 4 {
+		t.Fatalf("expected four 250 packs costing 4, got %+v", resp)
+	}
+}
+
+func TestCalculateHandler_UnknownObjective(t *testing.T) {
+	srv := setupServer()
+	payload := []byte(`{"items":10,"objective":"cheapest"}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rec.Code)
+	}
+}
+
+func TestCalculateHandler_Alternatives(t *testing.T) {
+	srv := setupServer()
+	payload := []byte(`{"items":53}`)
+	req := httptest.NewRequest(http.MethodPost, "/calculate?alternatives=3", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Total        int `json:"total_items"`
+		Alternatives []struct {
+			Total     int `json:"total_items"`
+			PackCount int `json:"pack_count"`
+		} `json:"alternatives"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(resp.Alternatives) != 3 {
+		t.Fatalf("expected 3 alternatives got %d", len(resp.Alternatives))
+	}
+	if resp.Alternatives[0].Total != resp.Total {
+		t.Fatalf("expected first alternative to be the chosen one, got %+v", resp)
+	}
+}
+
+func TestCalculateHandler_Explain(t *testing.T) {
+	srv := setupServer()
+	req := httptest.NewRequest(http.MethodPost, "/calculate?explain=true", bytes.NewReader([]byte(`{"items":24}`)))
+	rec := httptest.NewRecorder()
+
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Explanation struct {
+			MinimalTotal int   `json:"minimal_total"`
+			Unreachable  []int `json:"unreachable_totals"`
+			GCD          int   `json:"gcd"`
+			RunnersUp    []any `json:"runners_up"`
+		} `json:"explanation"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	e := resp.Explanation
+	if e.MinimalTotal != 31 || len(e.Unreachable) != 7 || e.Unreachable[0] != 24 || e.GCD != 1 || e.RunnersUp == nil {
+		t.Fatalf("unexpected explanation: %s", rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/calculate?explain=maybe", bytes.NewReader([]byte(`{"items":24}`)))
+	rec = httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rec.Code)
+	}
+}
+
+func TestCalculateHandler_InvalidAlternatives(t *testing.T) {
+	srv := setupServer()
+	req := httptest.NewRequest(http.MethodPost, "/calculate?alternatives=abc", bytes.NewReader([]byte(`{"items":53}`)))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rec.Code)
+	}
+}
+
+func TestOrderCalculateHandler(t *testing.T) {
+	mock := store.NewMockStore(nil)
+	_ = mock.SetSKUPacks(context.Background(), "A", []int{250, 500})
+	srv := NewServer(service.NewService(mock), nil)
+	h := srv.Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/skus/B/packs", bytes.NewReader([]byte(`{"packs":[23,31,53]}`)))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+
+	payload := []byte(`{"lines":[{"sku":"A","items":251},{"sku":"B","items":53}]}`)
+	req = httptest.NewRequest(http.MethodPost, "/orders/calculate", bytes.NewReader(payload))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Lines []struct {
+			SKU   string `json:"sku"`
+			Total int    `json:"total_items"`
+		} `json:"lines"`
+		Total int `json:"total_items"`
+		Waste int `json:"waste"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(resp.Lines) != 2 || resp.Total != 553 || resp.Waste != 249 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestOrderCalculateHandler_TooManyItems(t *testing.T) {
+	mock := store.NewMockStore(nil)
+	_ = mock.SetSKUPacks(context.Background(), "A", []int{250, 500})
+	_ = mock.SetSKUPacks(context.Background(), "B", []int{23, 31, 53})
+	svc := service.NewService(mock).WithSolverLimits(service.SolverLimits{MaxItems: 1000})
+	h := NewServer(svc, nil).Routes()
+
+	cases := map[string]string{
+		"over the limit together": `{"lines":[{"sku":"A","items":600},{"sku":"B","items":401}]}`,
+		// the sum would wrap around to a small number
+		"overflowing": `{"lines":[{"sku":"A","items":9223372036854775807},{"sku":"B","items":9223372036854775807},{"sku":"C","items":2}]}`,
+	}
+	for name, payload := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/orders/calculate", strings.NewReader(payload))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"code":"too_many_items"`) {
+			t.Fatalf("%s: expected 422 too_many_items got %d, body=%s", name, rec.Code, rec.Body.String())
+		}
+	}
+
+	// unlimited orders are still checked against overflow
+	h = NewServer(service.NewService(mock).WithSolverLimits(service.SolverLimits{}), nil).Routes()
+	req := httptest.NewRequest(http.MethodPost, "/orders/calculate", strings.NewReader(cases["overflowing"]))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"code":"too_many_items"`) {
+		t.Fatalf("expected 422 too_many_items without a limit got %d, body=%s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestOrderCalculateHandler_UnknownSKU(t *testing.T) {
+	srv := setupServer()
+	payload := []byte(`{"lines":[{"sku":"nope","items":10}]}`)
+	req := httptest.NewRequest(http.MethodPost, "/orders/calculate", bytes.NewReader(payload))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 got %d", rec.Code)
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"code":"unknown_sku"`)) {
+		t.Fatalf("expected unknown_sku code, body=%s", rec.Body.String())
+	}
+}
+
+func TestCalculationsHandler_Pagination(t *testing.T) {
+	srv := setupServer()
+	h := srv.Routes()
+	for _, items := range []string{"10", "20", "30"} {
+		req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":`+items+`}`)))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/calculations?limit=2", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var page struct {
+		Calculations []struct {
+			ID    int `json:"id"`
+			Items int `json:"items"`
+		} `json:"calculations"`
+		NextCursor *int `json:"next_cursor"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(page.Calculations) != 2 || page.Calculations[0].Items != 30 || page.NextCursor == nil {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/calculations?limit=2&cursor="+strconv.Itoa(*page.NextCursor), nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	page.NextCursor = nil
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(page.Calculations) != 1 || page.Calculations[0].Items != 10 || page.NextCursor != nil {
+		t.Fatalf("unexpected last page: %+v", page)
+	}
+}
+
+func TestCalculationsHandler_RequestID(t *testing.T) {
+	h := setupServer().Routes()
+	for _, id := range []string{"order-1", "order-2"} {
+		req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":10}`)))
+		req.Header.Set("X-Request-ID", id)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculations?request_id=order-1", nil))
+	var page struct {
+		Calculations []struct {
+			RequestID string `json:"request_id"`
+		} `json:"calculations"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(page.Calculations) != 1 || page.Calculations[0].RequestID != "order-1" {
+		t.Fatalf("expected the calculation of order-1 got %+v", page)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculations?request_id=a%20b", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid request_id got %d", rec.Code)
+	}
+}
+
+func TestCalculationHandler(t *testing.T) {
+	srv := setupServer()
+	h := srv.Routes()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":53}`))))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculations/1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	var resp struct {
+		Counts map[string]int `json:"counts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp.Counts["53"] != 1 {
+		t.Fatalf("unexpected breakdown: %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculations/99", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", rec.Code)
+	}
+}
+
+func TestPackVersionsDiffAndRollback(t *testing.T) {
+	srv := setupServer()
+	h := srv.Routes()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/packs", bytes.NewReader([]byte(`{"packs":[23,31,60]}`))))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/packs/versions", nil))
+	var list struct {
+		Versions []struct {
+			Version int   `json:"version"`
+			Active  bool  `json:"active"`
+			Packs   []int `json:"packs"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(list.Versions) != 2 || list.Versions[0].Version != 2 || !list.Versions[0].Active {
+		t.Fatalf("unexpected versions: %+v", list)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/packs/diff?from=1&to=2", nil))
+	var diff struct {
+		Added   []int `json:"added"`
+		Removed []int `json:"removed"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &diff); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0] != 60 || len(diff.Removed) != 1 || diff.Removed[0] != 53 {
+		t.Fatalf("unexpected diff: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/packs/rollback", bytes.NewReader([]byte(`{"version":1}`))))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d, body=%s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewReader([]byte(`{"items":53}`))))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/calculations/1", nil))
+	var calc struct {
+		CatalogVersion int            `json:"catalog_version"`
+		Counts         map[string]int `json:"counts"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &calc); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if calc.CatalogVersion != 1 || calc.Counts["53"] != 1 {
+		t.Fatalf("expected calculation on rolled back catalog, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/packs/rollback", bytes.NewReader([]byte(`{"version":9}`))))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/packs/diff?from=1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 got %d", rec.Code)
+	}
+}
+
 // mock para simular erro interno
 type failingStore struct{}
 
-func (f *failingStore) GetPacks() ([]int, error)                         { return []int{10}, nil }
-func (f *failingStore) SetPacks(packs []int) error                       { return errors.New("db fail") }
-func (f *failingStore) SaveCalculation(int, int, int, map[int]int) error { return nil }
+func (f *failingStore) GetPacks(context.Context) ([]int, error) { return []int{10}, nil }
+func (f *failingStore) SetPacks(context.Context, []int) error   { return errors.New("db fail") }
+func (f *failingStore) SaveCalculation(context.Context, int, int, int, int, map[int]int) error {
+	return nil
+}
+func (f *failingStore) GetPackCosts(context.Context) (map[int]float64, error) { return nil, nil }
+func (f *failingStore) SetPackCosts(context.Context, map[int]float64) error {
+	return errors.New("db fail")
+}
+func (f *failingStore) GetSKUPacks(context.Context, string) ([]int, error) {
+	return nil, store.ErrNotFound
+}
+func (f *failingStore) SetSKUPacks(context.Context, string, []int) error {
+	return errors.New("db fail")
+}
+func (f *failingStore) SaveOrder(context.Context, []store.OrderLine) error { return nil }
+func (f *failingStore) ListCalculations(context.Context, store.CalculationFilter) ([]store.Calculation, error) {
+	return nil, nil
+}
+func (f *failingStore) GetCalculation(context.Context, int) (store.Calculation, error) {
+	return store.Calculation{}, store.ErrNotFound
+}
+func (f *failingStore) ListPackCatalogs(context.Context) ([]store.PackCatalog, error) {
+	return nil, errors.New("fail ListPackCatalogs")
+}
+func (f *failingStore) GetPackCatalog(context.Context, int) (store.PackCatalog, error) {
+	return store.PackCatalog{}, store.ErrNotFound
+}
+func (f *failingStore) GetActivePackCatalog(context.Context) (store.PackCatalog, error) {
+	return store.PackCatalog{Version: 1, Packs: []int{10}}, nil
+}
+func (f *failingStore) ActivatePackCatalog(context.Context, int) error { return errors.New("db fail") }
+func (f *failingStore) GetStock(context.Context) (map[int]int, error)  { return nil, nil }
+func (f *failingStore) SetStock(context.Context, map[int]int) error    { return errors.New("db fail") }
+func (f *failingStore) CreateAPIKey(context.Context, store.APIKey, string) (store.APIKey, error) {
+	return store.APIKey{}, errors.New("db fail")
+}
+func (f *failingStore) GetAPIKeyByHash(context.Context, string) (store.APIKey, error) {
+	return store.APIKey{}, errors.New("db fail")
+}
+func (f *failingStore) ListAPIKeys(context.Context) ([]store.APIKey, error) { return nil, nil }
+func (f *failingStore) RevokeAPIKey(context.Context, int) error             { return errors.New("db fail") }
+
+func TestRoutes_CORSOrigins(t *testing.T) {
+	h := setupServer().WithCORSOrigins([]string{"https://shop.example"}).Routes()
+	for origin, want := range map[string]string{
+		"https://shop.example":  "https://shop.example",
+		"https://other.example": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/packs", nil)
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Fatalf("origin %s: expected %q got %q", origin, want, got)
+		}
+	}
+}
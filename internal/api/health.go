@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// defaultReadyTimeout bounds the database checks of /readyz.
+const defaultReadyTimeout = 2 * time.Second
+
+// WithFallback records that s runs on the in-memory store because the
+// database was unavailable, err saying why, and returns s. /readyz then
+// reports the server as degraded.
+func (s *Server) WithFallback(err error) *Server {
+	s.fallback = err
+	return s
+}
+
+// WithReadyTimeout sets how long /readyz waits for the database and returns
+// s. It must be called before Routes.
+func (s *Server) WithReadyTimeout(d time.Duration) *Server {
+	s.readyTimeout = d
+	return s
+}
+
+// Drain makes /readyz answer 503 from now on, so load balancers stop
+// sending requests before the server shuts down. Requests keep being served.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+// WithBackend names the store on the database of s, "postgres" by default,
+// as /readyz reports it, and returns s.
+func (s *Server) WithBackend(name string) *Server {
+	s.backend = name
+	return s
+}
+
+// backendName names the store s runs on.
+func (s *Server) backendName() string {
+	if s.db != nil {
+		return s.backend
+	}
+	return "memory"
+}
+
+// livez reports that the process is up and serving, whatever the state of
+// its dependencies.
+func (s *Server) livez(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "ts": time.Now().Format(time.RFC3339)})
+}
+
+// readyz reports whether s can serve traffic: the database answers a ping
+// and its migrations can be read, within readyTimeout. It answers 503 when
+// any check fails, the server fell back to the in-memory store or it is
+// draining before a shutdown.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeMethodNotAllowed(w)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.readyTimeout)
+	defer cancel()
+
+	if s.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "draining",
+			"ts":     time.Now().Format(time.RFC3339),
+			"checks": map[string]interface{}{},
+		})
+		return
+	}
+
+	ok := true
+	store := map[string]interface{}{"status": "ok", "backend": s.backendName()}
+	checks := map[string]interface{}{"store": store}
+	switch {
+	case s.fallback != nil:
+		ok = false
+		store["status"] = "degraded"
+		store["fallback"] = true
+		store["error"] = s.fallback.Error()
+	case s.db != nil:
+		start := time.Now()
+		err := s.db.PingContext(ctx)
+		store["latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+		if err != nil {
+			ok = false
+			store["status"] = "down"
+			store["error"] = err.Error()
+			break
+		}
+		migration := map[string]interface{}{"status": "ok"}
+		checks["migrations"] = migration
+		name, err := s.migrationVersion(ctx)
+		if err != nil {
+			ok = false
+			migration["status"] = "down"
+			migration["error"] = err.Error()
+			break
+		}
+		migration["name"] = name
+		migration["version"], _, _ = strings.Cut(name, "_")
+	}
+
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status": status,
+		"ts":     time.Now().Format(time.RFC3339),
+		"checks": checks,
+	})
+}
+
+// migrationVersion returns the name of the last migration applied, e.g.
+// "20251207090000_api_keys", or "" before the first one.
+func (s *Server) migrationVersion(ctx context.Context) (string, error) {
+	var name string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(name), '') FROM migrations WHERE success`).Scan(&name)
+	return name, err
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+var migrationQuery = regexp.QuoteMeta(`SELECT COALESCE(MAX(name), '') FROM migrations WHERE success`)
+
+// readyz serves /readyz on srv and returns the status and decoded body.
+func readyz(t *testing.T, srv *Server) (int, map[string]interface{}) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	return rec.Code, body
+}
+
+// check returns one entry of the checks of a /readyz body.
+func check(body map[string]interface{}, name string) map[string]interface{} {
+	checks, _ := body["checks"].(map[string]interface{})
+	c, _ := checks[name].(map[string]interface{})
+	return c
+}
+
+func postgresServer(t *testing.T) (*Server, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	svc := service.NewService(store.NewPostgresStore(db))
+	return NewServer(svc, db), mock
+}
+
+func TestLivez(t *testing.T) {
+	srv, _ := postgresServer(t)
+	rec := httptest.NewRecorder()
+	// no database call is expected
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rec.Code)
+	}
+}
+
+func TestReadyz_Postgres(t *testing.T) {
+	srv, mock := postgresServer(t)
+	mock.ExpectPing()
+	mock.ExpectQuery(migrationQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("20251207090000_api_keys"))
+
+	code, body := readyz(t, srv)
+	if code != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("expected 200 ok got %d %v", code, body)
+	}
+	if s := check(body, "store"); s["backend"] != "postgres" || s["status"] != "ok" {
+		t.Fatalf("unexpected store check %v", s)
+	}
+	if m := check(body, "migrations"); m["version"] != "20251207090000" || m["name"] != "20251207090000_api_keys" {
+		t.Fatalf("unexpected migrations check %v", m)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadyz_Backend(t *testing.T) {
+	srv, mock := postgresServer(t)
+	srv.WithBackend("sqlite")
+	mock.ExpectPing()
+	mock.ExpectQuery(migrationQuery).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("20251214090000_calculation_request_id"))
+
+	code, body := readyz(t, srv)
+	if code != http.StatusOK || check(body, "store")["backend"] != "sqlite" {
+		t.Fatalf("expected 200 from sqlite got %d %v", code, body)
+	}
+}
+
+func TestReadyz_PingFails(t *testing.T) {
+	srv, mock := postgresServer(t)
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	code, body := readyz(t, srv)
+	if code != http.StatusServiceUnavailable || body["status"] != "degraded" {
+		t.Fatalf("expected 503 degraded got %d %v", code, body)
+	}
+	if s := check(body, "store"); s["status"] != "down" || s["error"] != "connection refused" {
+		t.Fatalf("unexpected store check %v", s)
+	}
+}
+
+func TestReadyz_PingTimeout(t *testing.T) {
+	srv, mock := postgresServer(t)
+	srv.readyTimeout = 10 * time.Millisecond
+	mock.ExpectPing().WillDelayFor(time.Second)
+
+	start := time.Now()
+	code, _ := readyz(t, srv)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 got %d", code)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Fatalf("readiness took %v, expected the timeout to cut it short", d)
+	}
+}
+
+func TestReadyz_MigrationsUnreadable(t *testing.T) {
+	srv, mock := postgresServer(t)
+	mock.ExpectPing()
+	mock.ExpectQuery(migrationQuery).WillReturnError(errors.New(`relation "migrations" does not exist`))
+
+	code, body := readyz(t, srv)
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 got %d", code)
+	}
+	if m := check(body, "migrations"); m["status"] != "down" {
+		t.Fatalf("unexpected migrations check %v", m)
+	}
+}
+
+func TestReadyz_Memory(t *testing.T) {
+	code, body := readyz(t, setupServer())
+	if code != http.StatusOK || check(body, "store")["backend"] != "memory" {
+		t.Fatalf("expected 200 on the memory store got %d %v", code, body)
+	}
+
+	srv := setupServer().WithFallback(errors.New("DATABASE_URL not set"))
+	code, body = readyz(t, srv)
+	if code != http.StatusServiceUnavailable || body["status"] != "degraded" {
+		t.Fatalf("expected 503 degraded on fallback got %d %v", code, body)
+	}
+	if s := check(body, "store"); s["fallback"] != true || s["error"] != "DATABASE_URL not set" {
+		t.Fatalf("unexpected store check %v", s)
+	}
+}
+
+func TestReadyz_Draining(t *testing.T) {
+	srv := setupServer()
+	h := srv.Routes()
+	srv.Drain()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining got %d", rec.Code)
+	}
+	// liveness and traffic are unaffected
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /livez got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/packs", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /packs got %d", rec.Code)
+	}
+}
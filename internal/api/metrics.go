@@ -0,0 +1,22 @@
+package api
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounterVec("packcalc_http_requests_total",
+		"HTTP requests by method, route pattern and status.", "method", "route", "status")
+	httpDuration = metrics.Default.NewHistogramVec("packcalc_http_request_duration_seconds",
+		"HTTP request latency by method, route pattern and status.", metrics.DefBuckets, "method", "route", "status")
+)
+
+// observeRequest counts a request and records its latency.
+func observeRequest(method, route string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.Inc(method, route, code)
+	httpDuration.Observe(d.Seconds(), method, route, code)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape returns the value of every series served by /metrics, keyed by
+// name and labels as written.
+func scrape(t *testing.T, h http.Handler) map[string]float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /metrics got %d", rec.Code)
+	}
+	out := make(map[string]float64)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("bad sample %q: %v", line, err)
+		}
+		out[line[:i]] = v
+	}
+	return out
+}
+
+func TestMetricsHandler(t *testing.T) {
+	h := setupServer().Routes()
+	before := scrape(t, h)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"items":500}`)),
+		httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"items":0}`)),
+		httptest.NewRequest(http.MethodGet, "/skus/a/packs", nil),
+		httptest.NewRequest(http.MethodGet, "/skus/b/packs", nil),
+		httptest.NewRequest(http.MethodGet, "/nope", nil),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	after := scrape(t, h)
+
+	for series, want := range map[string]float64{
+		`packcalc_http_requests_total{method="POST",route="/calculate",status="200"}`:                 1,
+		`packcalc_http_requests_total{method="POST",route="/calculate",status="400"}`:                 1,
+		`packcalc_http_request_duration_seconds_count{method="POST",route="/calculate",status="200"}`: 1,
+		`packcalc_http_requests_total{method="GET",route="/skus/{sku}/packs",status="404"}`:           2,
+		`packcalc_http_requests_total{method="GET",route="unmatched",status="404"}`:                   1,
+		`packcalc_solver_duration_seconds_count{solver="table"}`:                                      1,
+	} {
+		if got := after[series] - before[series]; got != want {
+			t.Errorf("%s: expected +%v got +%v", series, want, got)
+		}
+	}
+	if after["packcalc_active_packs"] != 3 {
+		t.Errorf("expected 3 active packs got %v", after["packcalc_active_packs"])
+	}
+	if after["packcalc_solver_table_entries"] <= 0 {
+		t.Errorf("expected cached table entries got %v", after["packcalc_solver_table_entries"])
+	}
+}
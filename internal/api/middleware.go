@@ -0,0 +1,142 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/svvictorelias/shipping-pack-backend/internal/api"
+
+// WithLogger sets the logger of access logs and returns s. It must be
+// called before Routes.
+func (s *Server) WithLogger(l *slog.Logger) *Server {
+	s.logger = l
+	return s
+}
+
+// withRequestID gives every request an ID, the client's X-Request-ID when
+// it is usable or a new one, echoed in the response and carried by the
+// request context.
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		h.ServeHTTP(w, r.WithContext(requestid.NewContext(r.Context(), id)))
+	})
+}
+
+// observe wraps h to trace every request, record its metrics and write its
+// access log line. The span continues the W3C trace context of the request,
+// if any. The route is the pattern the mux matched, so path values such as
+// SKUs do not create a series each; requests no pattern matched share
+// "unmatched".
+func (s *Server) observe(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("request_id", requestid.FromContext(ctx))))
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		d := time.Since(start)
+
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		} else {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			if rec.err != nil {
+				span.RecordError(rec.err)
+			}
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+		span.End()
+		observeRequest(r.Method, route, rec.status, d)
+
+		attrs := []slog.Attr{
+			slog.String("request_id", requestid.FromContext(ctx)),
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("latency_ms", float64(d.Microseconds())/1000),
+		}
+		if rec.items > 0 {
+			attrs = append(attrs, slog.Int("items", rec.items))
+		}
+		if sc := span.SpanContext(); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		level := slog.LevelInfo
+		if rec.err != nil {
+			attrs = append(attrs, slog.String("error", rec.err.Error()))
+		}
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		s.logger.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// statusRecorder remembers the status written through it, and what the
+// handler reported for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	items       int
+	err         error
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, which
+// the batch handler flushes.
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// logItems adds items to the number of items the access log of the
+// request written to w reports.
+func logItems(w http.ResponseWriter, items int) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.items += items
+	}
+}
+
+// logError sets the error the access log of the request written to w
+// reports.
+func logError(w http.ResponseWriter, err error) {
+	if rec, ok := w.(*statusRecorder); ok {
+		rec.err = err
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRequestID(t *testing.T) {
+	h := setupServer().Routes()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if id := rec.Header().Get(requestid.Header); len(id) != 32 {
+		t.Fatalf("expected a generated request ID got %q", id)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(requestid.Header, "checkout-42")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestid.Header); id != "checkout-42" {
+		t.Fatalf("expected the client request ID got %q", id)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(requestid.Header, "two words")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestid.Header); id == "two words" || len(id) != 32 {
+		t.Fatalf("expected an invalid request ID to be replaced got %q", id)
+	}
+}
+
+// accessLogs returns the access log lines written while serving reqs.
+func accessLogs(t *testing.T, reqs ...*http.Request) []map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	h := setupServer().WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))).Routes()
+	for _, req := range reqs {
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("bad log line %q: %v", line, err)
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func TestAccessLog(t *testing.T) {
+	calcReq := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"items":501}`))
+	calcReq.Header.Set(requestid.Header, "req-1")
+	batchReq := httptest.NewRequest(http.MethodPost, "/calculate/batch", bytes.NewBufferString(`{"items":10}`+"\n"+`{"items":20}`))
+	logs := accessLogs(t, calcReq, batchReq,
+		httptest.NewRequest(http.MethodGet, "/skus/a/packs", nil))
+	if len(logs) != 3 {
+		t.Fatalf("expected 3 access log lines got %d", len(logs))
+	}
+
+	calc := logs[0]
+	for k, want := range map[string]interface{}{
+		"msg": "request", "level": "INFO", "request_id": "req-1", "method": "POST",
+		"route": "/calculate", "path": "/calculate", "status": float64(200), "items": float64(501),
+	} {
+		if calc[k] != want {
+			t.Errorf("%s: expected %v got %v", k, want, calc[k])
+		}
+	}
+	if _, ok := calc["latency_ms"].(float64); !ok {
+		t.Errorf("expected latency_ms got %v", calc["latency_ms"])
+	}
+	if logs[1]["items"] != float64(30) {
+		t.Errorf("expected the batch to log 30 items got %v", logs[1]["items"])
+	}
+	sku := logs[2]
+	if sku["route"] != "/skus/{sku}/packs" || sku["path"] != "/skus/a/packs" || sku["status"] != float64(404) {
+		t.Errorf("unexpected sku log %v", sku)
+	}
+	if _, ok := sku["items"]; ok {
+		t.Errorf("expected no items for a request without any got %v", sku["items"])
+	}
+}
+
+func TestAccessLog_ServerError(t *testing.T) {
+	var buf bytes.Buffer
+	srv := NewServer(service.NewService(&failingStore{}), nil)
+	h := srv.WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))).Routes()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/packs", bytes.NewBufferString(`{"packs":[1,2,3]}`)))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("bad log line %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "ERROR" || entry["status"] != float64(500) || entry["error"] != "db fail" {
+		t.Fatalf("expected an error log with the cause got %v", entry)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/calculate", bytes.NewBufferString(`{"items":501}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	var buf bytes.Buffer
+	h := setupServer().WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))).Routes()
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	names := make(map[string]bool)
+	var server sdktrace.ReadOnlySpan
+	for _, s := range sr.Ended() {
+		names[s.Name()] = true
+		if s.SpanContext().TraceID().String() != traceID {
+			t.Errorf("%s: expected trace %s got %s", s.Name(), traceID, s.SpanContext().TraceID())
+		}
+		if s.Name() == "POST /calculate" {
+			server = s
+		}
+	}
+	for _, want := range []string{"POST /calculate", "Service.Calculate", "calc.table"} {
+		if !names[want] {
+			t.Errorf("missing span %s in %v", want, names)
+		}
+	}
+	if server == nil {
+		t.Fatal("missing the HTTP span")
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Errorf("expected the caller's span as remote parent got %v", server.Parent())
+	}
+	attrs := attribute.NewSet(server.Attributes()...)
+	if v, _ := attrs.Value("http.route"); v.AsString() != "/calculate" {
+		t.Errorf("unexpected http.route %q", v.AsString())
+	}
+	if v, _ := attrs.Value("http.response.status_code"); v.AsInt64() != 200 {
+		t.Errorf("unexpected http.response.status_code %d", v.AsInt64())
+	}
+	if !strings.Contains(buf.String(), `"trace_id":"`+traceID+`"`) {
+		t.Errorf("expected the trace ID in the access log got %s", buf.String())
+	}
+}
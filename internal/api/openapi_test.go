@@ -0,0 +1,156 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		t.Fatalf("load spec: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid spec: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	srv := setupServer()
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), openAPISpec) {
+		t.Fatalf("expected the spec, got %d", rec.Code)
+	}
+	loadSpec(t)
+}
+
+// TestOpenAPIResponses runs real requests through the handlers and checks
+// both sides against the spec.
+func TestOpenAPIResponses(t *testing.T) {
+	ctx := context.Background()
+	doc := loadSpec(t)
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatalf("router: %v", err)
+	}
+	srv := setupServer()
+	h := srv.Routes()
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/health", "", 200},
+		{http.MethodGet, "/livez", "", 200},
+		{http.MethodGet, "/readyz", "", 200},
+		{http.MethodGet, "/packs", "", 200},
+		{http.MethodPost, "/packs/costs", `{"costs":{"23":1.5}}`, 200},
+		{http.MethodGet, "/packs/costs", "", 200},
+		{http.MethodPost, "/packs/costs", `{"costs":{"99":1}}`, 422},
+		{http.MethodPost, "/calculate?alternatives=2&explain=true", `{"items":263}`, 200},
+		{http.MethodPost, "/calculate", `{"items":100,"objective":"mixed","item_value":0.1}`, 200},
+		{http.MethodPost, "/calculate", `{"items":100,"stock":{"53":1,"31":0,"23":1}}`, 422},
+		{http.MethodPost, "/calculate", `{"items":0}`, 400},
+		{http.MethodPost, "/inventory", `{"stock":{"53":10}}`, 200},
+		{http.MethodGet, "/inventory", "", 200},
+		{http.MethodPost, "/packs", `{"packs":[0,-5,23,23]}`, 422},
+		{http.MethodPost, "/packs", `{"packs":[23,31,53,60]}`, 200},
+		{http.MethodGet, "/packs/versions", "", 200},
+		{http.MethodGet, "/packs/diff?from=1&to=3", "", 200},
+		{http.MethodGet, "/packs/diff?from=1&to=99", "", 404},
+		{http.MethodPost, "/packs/rollback", `{"version":1}`, 200},
+		{http.MethodPost, "/skus/A/packs", `{"packs":[500,250,250]}`, 200},
+		{http.MethodGet, "/skus/A/packs", "", 200},
+		{http.MethodGet, "/skus/B/packs", "", 404},
+		{http.MethodPost, "/orders/calculate", `{"lines":[{"sku":"A","items":251}]}`, 200},
+		{http.MethodPost, "/orders/calculate", `{"lines":[{"sku":"B","items":1}]}`, 422},
+		{http.MethodGet, "/calculations?limit=2", "", 200},
+		{http.MethodGet, "/calculations/1", "", 200},
+		{http.MethodGet, "/calculations/99", "", 404},
+		{http.MethodGet, "/openapi.json", "", 200},
+		{http.MethodGet, "/metrics", "", 200},
+	}
+	for _, tc := range cases {
+		name := tc.method + " " + tc.path
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		route, params, err := router.FindRoute(req)
+		if err != nil {
+			t.Fatalf("%s: no route in spec: %v", name, err)
+		}
+		in := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: params,
+			Route:      route,
+			// authentication is covered by TestAuthorize
+			Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		// only well-formed requests have to match the request schema
+		if tc.status < 400 {
+			if err := openapi3filter.ValidateRequest(ctx, in); err != nil {
+				t.Fatalf("%s: request does not match spec: %v", name, err)
+			}
+			req.Body = io.NopCloser(strings.NewReader(tc.body))
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.status {
+			t.Fatalf("%s: expected %d got %d, body=%s", name, tc.status, rec.Code, rec.Body.String())
+		}
+		err = openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: in,
+			Status:                 rec.Code,
+			Header:                 rec.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		})
+		if err != nil {
+			t.Fatalf("%s: response does not match spec: %v\nbody=%s", name, err, rec.Body.String())
+		}
+	}
+}
+
+// TestOpenAPIBatchResults checks every NDJSON line of a batch response
+// against the BatchResult schema.
+func TestOpenAPIBatchResults(t *testing.T) {
+	doc := loadSpec(t)
+	schema := doc.Components.Schemas["BatchResult"].Value
+	srv := setupServer()
+
+	body := `[{"id":"a","items":53},{"id":2,"items":0},{"items":"x"}]`
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/calculate/batch", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rec.Code)
+	}
+	dec := json.NewDecoder(rec.Body)
+	lines := 0
+	for dec.More() {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("invalid ndjson: %v", err)
+		}
+		if err := schema.VisitJSON(v); err != nil {
+			t.Fatalf("line does not match BatchResult: %v", err)
+		}
+		lines++
+	}
+	if lines != 3 {
+		t.Fatalf("expected 3 lines got %d", lines)
+	}
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+)
+
+// RateLimit is a token bucket: Burst tokens at most, refilled at Rate
+// tokens per second. Every request takes one token and calculations take
+// more for large orders.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimits configures per-client rate limiting. A client is its API key
+// or, without one, its IP address.
+type RateLimits struct {
+	Default RateLimit
+	// Clients maps API key names and IPs to their limit. Keys sharing a
+	// name each get their own bucket.
+	Clients map[string]RateLimit
+	// CostUnit is how many items, divided by the GCD of the pack sizes,
+	// cost one extra token. Zero charges every request one token.
+	CostUnit int
+	// TrustProxy takes the client IP from X-Forwarded-For, for servers
+	// behind a reverse proxy.
+	TrustProxy bool
+}
+
+// DefaultRateLimits allow 10 requests per second with bursts of 20, and one
+// extra token per 100000 items (divided by the GCD) of a calculation.
+var DefaultRateLimits = RateLimits{Default: RateLimit{Rate: 10, Burst: 20}, CostUnit: 100_000}
+
+// maxBuckets bounds how many clients are tracked before full buckets,
+// which carry no state, are dropped.
+const maxBuckets = 10000
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+type bucket struct {
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+// client identifies the bucket of a request.
+type client struct {
+	id   string // "key:" and the API key ID, or the IP address
+	name string // in RateLimits.Clients: the API key name, or the IP address
+}
+
+// rateLimiter holds one token bucket per client.
+type rateLimiter struct {
+	cfg RateLimits
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(cfg RateLimits) *rateLimiter {
+	return &rateLimiter{cfg: cfg, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// quota is the state of a bucket after a take.
+type quota struct {
+	limit     int
+	remaining int
+	reset     time.Duration // until the bucket is full again
+	retry     time.Duration // until the rejected take would succeed
+}
+
+// take removes n tokens from the bucket of c. A take above the burst
+// needs a full bucket and leaves it in debt, so a large request can pass
+// but is paid in full before the next one.
+func (l *rateLimiter) take(c client, n float64) (quota, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	b := l.buckets[c.id]
+	if b == nil {
+		if len(l.buckets) >= maxBuckets {
+			l.evict(now)
+		}
+		limit, ok := l.cfg.Clients[c.name]
+		if !ok {
+			limit = l.cfg.Default
+		}
+		b = &bucket{limit: limit, tokens: float64(limit.Burst), last: now}
+		l.buckets[c.id] = b
+	}
+	burst := float64(b.limit.Burst)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate)
+	b.last = now
+
+	need := math.Min(n, burst)
+	ok := b.tokens >= need
+	if ok {
+		b.tokens -= n
+	}
+	q := quota{limit: b.limit.Burst, remaining: int(math.Max(b.tokens, 0))}
+	if b.limit.Rate > 0 {
+		q.reset = time.Duration((burst - b.tokens) / b.limit.Rate * float64(time.Second))
+		if !ok {
+			q.retry = time.Duration((need - b.tokens) / b.limit.Rate * float64(time.Second))
+		}
+	}
+	return q, ok
+}
+
+// refund gives n tokens back to the bucket of c, up to its burst.
+func (l *rateLimiter) refund(c client, n float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b := l.buckets[c.id]; b != nil {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+n)
+	}
+}
+
+// evict drops the buckets that have refilled completely.
+func (l *rateLimiter) evict(now time.Time) {
+	for id, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.limit.Rate >= float64(b.limit.Burst) {
+			delete(l.buckets, id)
+		}
+	}
+}
+
+// cost is the number of tokens a calculation of items takes, on top of
+// the one every request takes.
+func (l *rateLimiter) cost(items int, packs []int) float64 {
+	if l.cfg.CostUnit <= 0 || items <= 0 {
+		return 0
+	}
+	if g := calc.GCD(packs); g > 1 {
+		items = (items + g - 1) / g
+	}
+	return float64(items / l.cfg.CostUnit)
+}
+
+type clientCtxKey struct{}
+
+type ipCtxKey struct{}
+
+// limitIP wraps authorize so that every request first takes one token from
+// the bucket of its IP: requests without a valid key, each an API key
+// lookup, are limited too. limit gives the token back once the key is
+// known, leaving keyed clients to the bucket of their key. It returns h
+// unchanged when rate limiting or authentication is off, as limit then
+// already goes by IP.
+func (s *Server) limitIP(h http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil || !s.auth {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := s.clientIP(r)
+		c := client{id: ip, name: ip}
+		if !s.takeTokens(w, c, 1) {
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), ipCtxKey{}, c)))
+	}
+}
+
+// limit wraps h so that every request takes one token from the bucket of
+// its client. It returns h unchanged when rate limiting is off.
+func (s *Server) limit(h http.HandlerFunc) http.HandlerFunc {
+	if s.limiter == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := s.client(r)
+		if ip, ok := r.Context().Value(ipCtxKey{}).(client); ok && ip.id != c.id {
+			s.limiter.refund(ip, 1)
+		}
+		if !s.takeTokens(w, c, 1) {
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), clientCtxKey{}, c)))
+	}
+}
+
+// charge takes the cost of a calculation of items against packs from the
+// bucket of the request's client, writing a 429 and returning false when
+// the client is over its limit.
+func (s *Server) charge(w http.ResponseWriter, r *http.Request, items int, packs []int) bool {
+	if s.limiter == nil {
+		return true
+	}
+	n := s.limiter.cost(items, packs)
+	if n == 0 {
+		return true
+	}
+	c, _ := r.Context().Value(clientCtxKey{}).(client)
+	return s.takeTokens(w, c, n)
+}
+
+// chargeFunc is charge for the orders of a batch, which are answered on
+// their own line: it returns errRateLimited instead of writing a response.
+func (s *Server) chargeFunc(r *http.Request) (func(items int) error, error) {
+	if s.limiter == nil || s.limiter.cfg.CostUnit <= 0 {
+		return func(int) error { return nil }, nil
+	}
+	packs, err := s.svc.GetPacks(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	c, _ := r.Context().Value(clientCtxKey{}).(client)
+	return func(items int) error {
+		n := s.limiter.cost(items, packs)
+		if n == 0 {
+			return nil
+		}
+		if q, ok := s.limiter.take(c, n); !ok {
+			return fmt.Errorf("%w, retry in %ss", errRateLimited, retryAfter(q.retry))
+		}
+		return nil
+	}, nil
+}
+
+func (s *Server) takeTokens(w http.ResponseWriter, c client, n float64) bool {
+	q, ok := s.limiter.take(c, n)
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(q.limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(q.remaining))
+	h.Set("RateLimit-Reset", retryAfter(q.reset))
+	if !ok {
+		h.Set("Retry-After", retryAfter(q.retry))
+		writeProblem(w, http.StatusTooManyRequests, "rate_limited",
+			fmt.Sprintf("%s, retry in %ss", errRateLimited, retryAfter(q.retry)))
+	}
+	return ok
+}
+
+// retryAfter formats d as whole seconds, rounded up.
+func retryAfter(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// client identifies the client of r: its API key, or its IP address.
+func (s *Server) client(r *http.Request) client {
+	if key, ok := apiKeyFromContext(r.Context()); ok {
+		return client{id: "key:" + strconv.Itoa(key.ID), name: key.Name}
+	}
+	ip := s.clientIP(r)
+	return client{id: ip, name: ip}
+}
+
+// clientIP returns the IP address of the client of r.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.limiter.cfg.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			// the proxy appends the address it saw last
+			parts := strings.Split(fwd, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestRateLimiter_Take(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(RateLimits{
+		Default: RateLimit{Rate: 1, Burst: 2},
+		Clients: map[string]RateLimit{"big": {Rate: 10, Burst: 100}},
+	})
+	l.now = func() time.Time { return now }
+	a, big := client{id: "a", name: "a"}, client{id: "key:1", name: "big"}
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.take(a, 1); !ok {
+			t.Fatalf("take %d: expected ok within burst", i)
+		}
+	}
+	q, ok := l.take(a, 1)
+	if ok || q.remaining != 0 || q.retry != time.Second {
+		t.Fatalf("expected rejection with 1s retry, got %+v ok=%v", q, ok)
+	}
+	// other clients have their own bucket and limit
+	if q, ok := l.take(big, 1); !ok || q.limit != 100 {
+		t.Fatalf("expected per-client limit, got %+v", q)
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := l.take(a, 1); !ok {
+		t.Fatal("expected a token refilled after 1s")
+	}
+	// a cost above the burst passes on a full bucket, then is paid in full
+	now = now.Add(10 * time.Second)
+	if _, ok := l.take(a, 50); !ok {
+		t.Fatal("expected a cost above burst to pass on a full bucket")
+	}
+	q, ok = l.take(a, 1)
+	if ok || q.remaining != 0 || q.retry != 49*time.Second {
+		t.Fatalf("expected the debt of 48 tokens to be repaid first, got %+v ok=%v", q, ok)
+	}
+	now = now.Add(48 * time.Second)
+	if _, ok := l.take(a, 50); ok {
+		t.Fatal("expected a cost above burst to wait for a full bucket")
+	}
+}
+
+func TestRateLimiter_Cost(t *testing.T) {
+	l := newRateLimiter(RateLimits{CostUnit: 1000})
+	cases := []struct {
+		items int
+		packs []int
+		want  float64
+	}{
+		{999, []int{23, 31}, 0},
+		{5000, []int{23, 31}, 5},
+		// with a GCD of 250 only every 250th total is reachable
+		{1_000_000, []int{250, 500}, 4},
+	}
+	for _, tc := range cases {
+		if got := l.cost(tc.items, tc.packs); got != tc.want {
+			t.Errorf("cost(%d, %v) = %v, want %v", tc.items, tc.packs, got, tc.want)
+		}
+	}
+}
+
+func TestRateLimit_Handler(t *testing.T) {
+	srv := setupServer().WithRateLimits(RateLimits{Default: RateLimit{Rate: 0.001, Burst: 3}, CostUnit: 1000})
+	h := srv.Routes()
+	do := func(path, body, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("/calculate", `{"items":10}`, "10.0.0.1")
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "3" || rec.Header().Get("RateLimit-Remaining") != "2" {
+		t.Fatalf("unexpected first response %d %v", rec.Code, rec.Header())
+	}
+	// 2500 items cost two more tokens: the bucket is empty afterwards
+	if rec := do("/calculate", `{"items":2500}`, "10.0.0.1"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 for an expensive request, got %d", rec.Code)
+	}
+	rec = do("/calculate", `{"items":10}`, "10.0.0.1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the rejected cost not charged, got %d", rec.Code)
+	}
+	rec = do("/calculate", `{"items":10}`, "10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", rec.Code, rec.Header())
+	}
+	if !bytes.Contains(rec.Body.Bytes(), []byte(`"code":"rate_limited"`)) {
+		t.Fatalf("expected rate_limited code, body=%s", rec.Body.String())
+	}
+	// another IP is another client; public routes are not limited
+	if rec := do("/calculate", `{"items":10}`, "10.0.0.2"); rec.Code != http.StatusOK {
+		t.Fatalf("expected other client unaffected, got %d", rec.Code)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected /health not limited, got %d", rec.Code)
+	}
+}
+
+func TestRateLimit_ByAPIKey(t *testing.T) {
+	ctx := context.Background()
+	svc := service.NewService(store.NewMockStore([]int{23, 31, 53}))
+	secret, _, err := svc.CreateAPIKey(ctx, "checkout", []string{service.ScopePacksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(svc, nil).WithAuth(true).WithRateLimits(RateLimits{
+		Default: RateLimit{Burst: 1},
+		Clients: map[string]RateLimit{"checkout": {Burst: 2}},
+	}).Routes()
+
+	codes := []int{}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		req := httptest.NewRequest(http.MethodGet, "/packs", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set("Authorization", "Bearer "+secret)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	// the key is one client whatever its IP, with its own limit
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != 429 {
+		t.Fatalf("unexpected codes %v", codes)
+	}
+
+	// another key of the same name has its own bucket, with the same limit
+	other, _, err := svc.CreateAPIKey(ctx, "checkout", []string{service.ScopePacksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes = codes[:0]
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/packs", nil)
+		req.Header.Set("Authorization", "Bearer "+other)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != 429 {
+		t.Fatalf("unexpected codes for the second key %v", codes)
+	}
+}
+
+func TestRateLimit_UnauthenticatedByIP(t *testing.T) {
+	ctx := context.Background()
+	svc := service.NewService(store.NewMockStore([]int{23, 31, 53}))
+	secret, _, err := svc.CreateAPIKey(ctx, "checkout", []string{service.ScopePacksRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewServer(svc, nil).WithAuth(true).WithRateLimits(RateLimits{
+		Default: RateLimit{Burst: 2},
+		Clients: map[string]RateLimit{"checkout": {Burst: 5}},
+	}).Routes()
+	do := func(ip, auth string) int {
+		req := httptest.NewRequest(http.MethodGet, "/packs", nil)
+		req.RemoteAddr = ip + ":1234"
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// valid keys give the IP token back: the key's own limit applies
+	for i := 0; i < 5; i++ {
+		if code := do("10.0.0.1", secret); code != http.StatusOK {
+			t.Fatalf("request %d: expected 200 got %d", i, code)
+		}
+	}
+	// missing and unknown keys are limited by IP before the lookup
+	codes := []int{do("10.0.0.2", ""), do("10.0.0.2", "pk_unknown"), do("10.0.0.2", "pk_unknown")}
+	if codes[0] != 401 || codes[1] != 401 || codes[2] != 429 {
+		t.Fatalf("unexpected codes %v", codes)
+	}
+	// other IPs have their own bucket
+	if code := do("10.0.0.3", "pk_unknown"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 got %d", code)
+	}
+}
+
+func TestRateLimit_BatchLines(t *testing.T) {
+	srv := setupServer().WithRateLimits(RateLimits{Default: RateLimit{Burst: 4}, CostUnit: 1000})
+	req := httptest.NewRequest(http.MethodPost, "/calculate/batch", strings.NewReader("{\"items\":2000}\n{\"items\":2000}\n"))
+	rec := httptest.NewRecorder()
+	srv.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 got %d", rec.Code)
+	}
+	// the request takes one token and the first order two, so the second
+	// order is over the limit on its own line
+	if n := bytes.Count(rec.Body.Bytes(), []byte(`"code":"rate_limited"`)); n != 1 {
+		t.Fatalf("expected one rate limited line, body=%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,311 @@
+package calc
+
+import (
+	"context"
+	"maps"
+	"sort"
+)
+
+// MaxAlternatives caps how many solutions TopSolutions can return.
+const MaxAlternatives = 20
+
+// maxAlternativesEntries caps the table TopSolutions builds to bound its
+// search, one int32 per pack size and (GCD-reduced) total: 32MB.
+const maxAlternativesEntries = 1 << 23
+
+// maxAlternativesSteps caps the combinations TopSolutions visits before it
+// gives up with ErrOrderTooLarge, a few hundred milliseconds of work.
+const maxAlternativesSteps = 1 << 25
+
+// Solution is one combination of packs covering a target.
+type Solution struct {
+	Counts    map[int]int
+	Total     int
+	PackCount int
+}
+
+// TopSolutions returns the k best distinct combinations with total >= target,
+// best first by total shipped, then pack count. Ties prefer more of the
+// smaller packs, so the first solution is the one CalculatePacks returns.
+func TopSolutions(ctx context.Context, target int, packs []int, k int) ([]Solution, error) {
+	return TopSolutionsBounded(ctx, target, packs, nil, k)
+}
+
+// TopSolutionsBounded is TopSolutions using at most stock[size] packs of
+// each size in stock; sizes missing from stock are unlimited, as in
+// CalculatePacksBounded, whose combination comes first.
+func TopSolutionsBounded(ctx context.Context, target int, packs []int, stock map[int]int, k int) ([]Solution, error) {
+	if k <= 0 || k > MaxAlternatives {
+		return nil, ErrInvalidAlternatives
+	}
+	counts, best, packCount, err := CalculatePacksBounded(ctx, target, packs, stock, nil)
+	if err != nil {
+		return nil, err
+	}
+	p, g, err := reducePacks(packs)
+	if err != nil {
+		return nil, err
+	}
+
+	avail := availableStock(p, g, stock)
+	// best plus j packs of one size, for j < k, are k distinct solutions, so
+	// nothing beyond that total can make the cut; without k-1 packs to spare
+	// of any size, the stock bounds the totals
+	reducedTarget := (target + g - 1) / g
+	limit := -1
+	for i, pack := range p {
+		if avail[i] < 0 || avail[i]-counts[pack*g] >= k-1 {
+			limit = best/g + (k-1)*pack
+			break
+		}
+	}
+	if limit < 0 {
+		limit = 0
+		for i, pack := range p {
+			if avail[i] > (maxAlternativesEntries-limit)/pack {
+				return nil, ErrOrderTooLarge
+			}
+			limit += avail[i] * pack
+		}
+	}
+	if !fitsSuffix(p, limit) {
+		return nil, ErrOrderTooLarge
+	}
+
+	e := &enumerator{ctx: ctx, p: p, avail: avail, k: k, suffix: suffixMinPacks(p, limit), vec: make([]int, len(p))}
+	for s := reducedTarget; s <= limit; s++ {
+		if e.err != nil {
+			return nil, e.err
+		}
+		if e.suffix[0][s] < 0 {
+			continue
+		}
+		if e.full() && e.worse(s, int(e.suffix[0][s])) {
+			if s > e.found[len(e.found)-1].total {
+				break
+			}
+			continue
+		}
+		e.search(s, int(e.suffix[0][s]))
+	}
+
+	if e.err != nil {
+		return nil, e.err
+	}
+	out := make([]Solution, len(e.found))
+	for i, f := range e.found {
+		out[i] = f.solution(p, g)
+	}
+	// ties of the best may be enumerated in another order than the solver
+	// picked; put its combination first
+	first := Solution{Counts: counts, Total: best, PackCount: packCount}
+	at := len(out) - 1
+	for i, sol := range out {
+		if maps.Equal(sol.Counts, counts) {
+			at = i
+			break
+		}
+	}
+	copy(out[1:at+1], out[:at])
+	out[0] = first
+	return out, nil
+}
+
+// availableStock returns the stock of each of the reduced packs p, -1 when
+// unlimited.
+func availableStock(p []int, g int, stock map[int]int) []int {
+	avail := make([]int, len(p))
+	for i, pack := range p {
+		if qty, ok := stock[pack*g]; ok {
+			avail[i] = qty
+		} else {
+			avail[i] = -1
+		}
+	}
+	return avail
+}
+
+// fitsSuffix reports whether suffixMinPacks(p, limit) stays within
+// maxAlternativesEntries.
+func fitsSuffix(p []int, limit int) bool {
+	return limit < maxAlternativesEntries/(len(p)+1)
+}
+
+// suffixMinPacks returns t where t[i][s] is the fewest packs of sizes p[i:]
+// summing to exactly s, or -1 when s cannot be made from them. It ignores
+// stock, so with stock it is a lower bound.
+func suffixMinPacks(p []int, limit int) [][]int32 {
+	t := make([][]int32, len(p)+1)
+	t[len(p)] = make([]int32, limit+1)
+	for s := 1; s <= limit; s++ {
+		t[len(p)][s] = -1
+	}
+	for i := len(p) - 1; i >= 0; i-- {
+		row := make([]int32, limit+1)
+		copy(row, t[i+1])
+		for s := p[i]; s <= limit; s++ {
+			if row[s-p[i]] >= 0 && (row[s] < 0 || row[s-p[i]]+1 < row[s]) {
+				row[s] = row[s-p[i]] + 1
+			}
+		}
+		t[i] = row
+	}
+	return t
+}
+
+// enumerator walks the combinations of one total, pack size by pack size,
+// keeping the k best found so far in found (sorted best first).
+type enumerator struct {
+	ctx    context.Context
+	err    error // ctx.Err() or ErrOrderTooLarge once the walk was cut short
+	steps  int
+	p      []int
+	avail  []int // stock of p[i], -1 when unlimited
+	k      int
+	suffix [][]int32
+	total  int
+	most   int // pack count walk looks for
+	next   int // smallest pack count walk skipped, -1 if none
+	vec    []int
+	found  []candidate
+}
+
+type candidate struct {
+	total int
+	count int
+	vec   []int
+}
+
+func (e *enumerator) full() bool { return len(e.found) == e.k }
+
+// worse reports whether (total, count) ranks strictly after the current k-th.
+func (e *enumerator) worse(total, count int) bool {
+	last := e.found[len(e.found)-1]
+	return total > last.total || (total == last.total && count > last.count)
+}
+
+// search walks the combinations of total with at least fewest packs, one
+// pack count at a time, until the rest cannot make the cut: a total with
+// millions of combinations only costs the few with the fewest packs.
+func (e *enumerator) search(total, fewest int) {
+	e.total = total
+	for e.most = fewest; e.err == nil; e.most = e.next {
+		if e.full() && e.worse(total, e.most) {
+			return
+		}
+		e.next = -1
+		e.walk(0, total, 0)
+		if e.next < 0 {
+			return
+		}
+	}
+}
+
+// walk adds the combinations of e.total with exactly e.most packs, noting in
+// e.next the fewest packs of those it skips.
+func (e *enumerator) walk(i, remaining, count int) {
+	if !e.step() {
+		return
+	}
+	if i == len(e.p) {
+		if count == e.most {
+			e.add(count)
+		}
+		return
+	}
+	most := remaining / e.p[i]
+	if e.avail[i] >= 0 && e.avail[i] < most {
+		most = e.avail[i]
+	}
+	// the rest takes at least rest/largest packs, so more than cut packs of
+	// p[i] leave too many for e.most
+	if largest := e.p[len(e.p)-1]; e.p[i] < largest {
+		cut := -1
+		if left := largest*(e.most-count) - remaining; left >= 0 {
+			cut = left / (largest - e.p[i])
+		}
+		if cut < most {
+			e.skip(e.most + 1)
+			most = cut
+		}
+	}
+	for n := most; n >= 0 && e.step(); n-- {
+		rest := remaining - n*e.p[i]
+		least := e.suffix[i+1][rest]
+		if least < 0 {
+			continue
+		}
+		if packs := count + n + int(least); packs > e.most {
+			e.skip(packs)
+			continue
+		}
+		e.vec[i] = n
+		e.walk(i+1, rest, count+n)
+	}
+	e.vec[i] = 0
+}
+
+// skip notes a branch of at least packs packs that walk left out.
+func (e *enumerator) skip(packs int) {
+	if e.full() && e.worse(e.total, packs) {
+		return
+	}
+	if e.next < 0 || packs < e.next {
+		e.next = packs
+	}
+}
+
+// step counts one step of the walk and reports whether it may go on: not
+// past maxAlternativesSteps nor once ctx is done.
+func (e *enumerator) step() bool {
+	e.steps++
+	if e.err == nil {
+		if e.steps > maxAlternativesSteps {
+			e.err = ErrOrderTooLarge
+		} else if e.steps%checkEvery == 0 {
+			e.err = e.ctx.Err()
+		}
+	}
+	return e.err == nil
+}
+
+func (e *enumerator) add(count int) {
+	f := candidate{total: e.total, count: count, vec: append([]int(nil), e.vec...)}
+	at := sort.Search(len(e.found), func(j int) bool { return f.before(e.found[j]) })
+	if at == e.k {
+		return
+	}
+	e.found = append(e.found, candidate{})
+	copy(e.found[at+1:], e.found[at:])
+	e.found[at] = f
+	if len(e.found) > e.k {
+		e.found = e.found[:e.k]
+	}
+}
+
+// solution scales f back from the reduced packs p.
+func (f candidate) solution(p []int, g int) Solution {
+	counts := make(map[int]int)
+	for j, qty := range f.vec {
+		if qty > 0 {
+			counts[p[j]*g] = qty
+		}
+	}
+	return Solution{Counts: counts, Total: f.total * g, PackCount: f.count}
+}
+
+// before orders by total, then pack count, then more of the smaller packs.
+func (a candidate) before(b candidate) bool {
+	if a.total != b.total {
+		return a.total < b.total
+	}
+	if a.count != b.count {
+		return a.count < b.count
+	}
+	for i := range a.vec {
+		if a.vec[i] != b.vec[i] {
+			return a.vec[i] > b.vec[i]
+		}
+	}
+	return false
+}
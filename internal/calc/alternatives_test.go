@@ -0,0 +1,172 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestTopSolutions_Order(t *testing.T) {
+	ctx := context.Background()
+	sols, err := TopSolutions(ctx, 500, []int{250, 500}, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Solution{
+		{Counts: map[int]int{500: 1}, Total: 500, PackCount: 1},
+		{Counts: map[int]int{250: 2}, Total: 500, PackCount: 2},
+		{Counts: map[int]int{250: 1, 500: 1}, Total: 750, PackCount: 2},
+		{Counts: map[int]int{250: 3}, Total: 750, PackCount: 3},
+	}
+	if !reflect.DeepEqual(sols, want) {
+		t.Fatalf("got %+v want %+v", sols, want)
+	}
+}
+
+func TestTopSolutions_FirstMatchesCalculatePacks(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 200; i++ {
+		packs := []int{1 + rng.Intn(30), 1 + rng.Intn(30), 1 + rng.Intn(30)}
+		target := 1 + rng.Intn(400)
+		counts, total, packCount, err := CalculatePacks(ctx, target, packs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sols, err := TopSolutions(ctx, target, packs, 3)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(sols) != 3 {
+			t.Fatalf("packs=%v target=%d: expected 3 solutions got %d", packs, target, len(sols))
+		}
+		first := sols[0]
+		if first.Total != total || first.PackCount != packCount || !reflect.DeepEqual(first.Counts, counts) {
+			t.Fatalf("packs=%v target=%d: first %+v, CalculatePacks %v %d %d", packs, target, first, counts, total, packCount)
+		}
+		for j := 1; j < len(sols); j++ {
+			a, b := sols[j-1], sols[j]
+			if a.Total > b.Total || (a.Total == b.Total && a.PackCount > b.PackCount) || reflect.DeepEqual(a.Counts, b.Counts) {
+				t.Fatalf("packs=%v target=%d: solutions out of order: %+v", packs, target, sols)
+			}
+		}
+	}
+}
+
+func TestTopSolutions_InvalidK(t *testing.T) {
+	ctx := context.Background()
+	if _, err := TopSolutions(ctx, 10, []int{5}, 0); err == nil {
+		t.Fatal("expected error for k=0")
+	}
+	if _, err := TopSolutions(ctx, 10, []int{5}, MaxAlternatives+1); err == nil {
+		t.Fatal("expected error for k above MaxAlternatives")
+	}
+}
+
+func TestTopSolutions_Budget(t *testing.T) {
+	ctx := context.Background()
+	// few combinations with the fewest packs: searched first, so cheap
+	if sols, err := TopSolutions(ctx, 1_000_000, []int{23, 31, 53}, MaxAlternatives); err != nil || len(sols) != MaxAlternatives {
+		t.Fatalf("expected %d solutions got %d, %v", MaxAlternatives, len(sols), err)
+	}
+	// the table alone would not fit
+	if _, err := TopSolutions(ctx, 4_900_000, []int{23, 31, 53}, MaxAlternatives); !errors.Is(err, ErrOrderTooLarge) {
+		t.Fatalf("expected ErrOrderTooLarge got %v", err)
+	}
+	// too many combinations to rank within the step budget
+	packs := make([]int, 50)
+	for i := range packs {
+		packs[i] = 100 + i
+	}
+	if _, err := TopSolutions(ctx, 100_000, packs, MaxAlternatives); !errors.Is(err, ErrOrderTooLarge) {
+		t.Fatalf("expected ErrOrderTooLarge got %v", err)
+	}
+}
+
+func TestTopSolutionsBounded(t *testing.T) {
+	ctx := context.Background()
+	sols, err := TopSolutionsBounded(ctx, 500, []int{250, 500}, map[int]int{500: 0}, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Solution{
+		{Counts: map[int]int{250: 2}, Total: 500, PackCount: 2},
+		{Counts: map[int]int{250: 3}, Total: 750, PackCount: 3},
+	}
+	if !reflect.DeepEqual(sols, want) {
+		t.Fatalf("got %+v want %+v", sols, want)
+	}
+
+	// fewer than k combinations fit the stock
+	sols, err = TopSolutionsBounded(ctx, 500, []int{250, 500}, map[int]int{250: 1, 500: 1}, 5)
+	if err != nil || len(sols) != 2 || sols[0].Total != 500 || sols[1].Total != 750 {
+		t.Fatalf("got %+v, %v", sols, err)
+	}
+	if _, err := TopSolutionsBounded(ctx, 1000, []int{250, 500}, map[int]int{250: 1, 500: 1}, 2); !errors.Is(err, ErrInsufficientStock) {
+		t.Fatalf("expected ErrInsufficientStock got %v", err)
+	}
+}
+
+func TestTopSolutionsBounded_MatchesBruteForce(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < 300; i++ {
+		packs := []int{1 + rng.Intn(12), 1 + rng.Intn(12), 1 + rng.Intn(12)}
+		stock := map[int]int{}
+		for _, p := range packs {
+			if rng.Intn(2) == 0 {
+				stock[p] = rng.Intn(5)
+			}
+		}
+		target := 1 + rng.Intn(60)
+		sols, err := TopSolutionsBounded(ctx, target, packs, stock, 3)
+		if errors.Is(err, ErrInsufficientStock) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("packs=%v stock=%v target=%d: unexpected error: %v", packs, stock, target, err)
+		}
+		counts, total, packCount, _ := CalculatePacksBounded(ctx, target, packs, stock, nil)
+		if sols[0].Total != total || sols[0].PackCount != packCount || !reflect.DeepEqual(sols[0].Counts, counts) {
+			t.Fatalf("packs=%v stock=%v target=%d: first %+v, CalculatePacksBounded %d %d", packs, stock, target, sols[0], total, packCount)
+		}
+		for _, sol := range sols {
+			for size, qty := range sol.Counts {
+				if limit, ok := stock[size]; ok && qty > limit {
+					t.Fatalf("packs=%v stock=%v target=%d: %+v exceeds the stock", packs, stock, target, sol)
+				}
+			}
+		}
+		// every combination that ranks before the last one is listed
+		last := sols[len(sols)-1]
+		p, g, _ := reducePacks(packs)
+		better := 0
+		var walk func(i, sum, count int)
+		walk = func(i, sum, count int) {
+			if i == len(p) {
+				if sum >= target && (sum < last.Total || (sum == last.Total && count < last.PackCount)) {
+					better++
+				}
+				return
+			}
+			for n := 0; sum+n*p[i]*g <= last.Total; n++ {
+				if limit, ok := stock[p[i]*g]; ok && n > limit {
+					break
+				}
+				walk(i+1, sum+n*p[i]*g, count+n)
+			}
+		}
+		walk(0, 0, 0)
+		listed := 0
+		for _, sol := range sols {
+			if sol.Total < last.Total || sol.PackCount < last.PackCount {
+				listed++
+			}
+		}
+		if better != listed {
+			t.Fatalf("packs=%v stock=%v target=%d: %d better combinations, %d listed in %+v", packs, stock, target, better, listed, sols)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// InsufficientStockError is returned by CalculatePacksBounded when the whole
+// available stock cannot cover the target.
+type InsufficientStockError struct {
+	Target       int
+	MaxReachable int // largest total the stock can ship
+}
+
+func (e *InsufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock: %d items requested, at most %d reachable", e.Target, e.MaxReachable)
+}
+
+// Is lets errors.Is match the error against ErrInsufficientStock.
+func (e *InsufficientStockError) Is(target error) bool { return target == ErrInsufficientStock }
+
+// CalculatePacksBounded is CalculatePacksWithObjective with a limited number
+// of packs per size. stock maps pack size to the quantity available; sizes
+// missing from stock are unlimited. A nil obj keeps the default objectives:
+// minimal total shipped, then minimal number of packs.
+//
+// Returns counts map[packSize]quantity, totalItems, packCount, error.
+func CalculatePacksBounded(ctx context.Context, target int, packs []int, stock map[int]int, obj Objective) (map[int]int, int, int, error) {
+	if target <= 0 {
+		return nil, 0, 0, ErrInvalidTarget
+	}
+	if len(packs) == 0 {
+		return nil, 0, 0, ErrNoPacks
+	}
+
+	p, g, err := reducePacks(packs)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	// avail[i] is the stock of p[i], -1 when unlimited
+	avail := make([]int, len(p))
+	bounded, unlimited := false, false
+	capacity := 0
+	for i, pack := range p {
+		qty, ok := stock[pack*g]
+		if !ok {
+			avail[i] = -1
+			unlimited = true
+			continue
+		}
+		if qty < 0 {
+			return nil, 0, 0, ErrNegativeStock
+		}
+		avail[i] = qty
+		bounded = true
+		// stock comes from clients: saturate rather than overflow, any
+		// capacity above the target is as good
+		if qty > (math.MaxInt-capacity)/(pack*g) {
+			capacity = math.MaxInt
+		} else {
+			capacity += qty * pack * g
+		}
+	}
+	if !bounded {
+		return CalculatePacksWithObjective(ctx, target, packs, obj)
+	}
+	if !unlimited && capacity < target {
+		return nil, 0, 0, &InsufficientStockError{Target: target, MaxReachable: capacity}
+	}
+
+	// the default objective is pack count alone, with the smallest total winning
+	packCost := make([]float64, len(p))
+	if obj != nil {
+		for i, pack := range p {
+			packCost[i] = obj.PackCost(pack * g)
+			if packCost[i] < 0 {
+				return nil, 0, 0, ErrNegativeCost
+			}
+		}
+	}
+
+	reducedTarget := (target + g - 1) / g
+	limit := reducedTarget + p[len(p)-1] - 1
+	if !unlimited && capacity/g < limit {
+		limit = capacity / g
+	}
+
+	cost, count, take, err := boundedDP(ctx, limit, p, avail, packCost)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	bestS := -1
+	var bestScore float64
+	for s := reducedTarget; s <= limit; s++ {
+		if count[s] < 0 {
+			continue
+		}
+		if obj == nil {
+			bestS = s
+			break
+		}
+		score := cost[s] + obj.WasteCost(s*g-target)
+		if bestS == -1 || score < bestScore {
+			bestS, bestScore = s, score
+		}
+	}
+	if bestS == -1 {
+		return nil, 0, 0, ErrNoSolution
+	}
+
+	counts := make(map[int]int)
+	s := bestS
+	for i := len(p) - 1; i >= 0; i-- {
+		n := int(take[i][s])
+		if n > 0 {
+			counts[p[i]*g] = n
+			s -= n * p[i]
+		}
+	}
+	if s != 0 {
+		return nil, 0, 0, errors.New("reconstruction failed")
+	}
+	return counts, bestS * g, count[bestS], nil
+}
+
+// boundedDP computes, one pack size at a time, the cheapest way (then the
+// fewest packs) to reach every total up to limit when at most avail[i] packs
+// of p[i] may be used, unlimited when avail[i] < 0. count[s] is -1 for
+// unreachable totals. take[i][s] records how many packs of p[i] the best way
+// to reach s uses, so the combination can be rebuilt backwards.
+func boundedDP(ctx context.Context, limit int, p []int, avail []int, packCost []float64) ([]float64, []int, [][]int32, error) {
+	cost := make([]float64, limit+1)
+	count := make([]int, limit+1)
+	for s := 1; s <= limit; s++ {
+		count[s] = -1
+	}
+	nextCost := make([]float64, limit+1)
+	nextCount := make([]int, limit+1)
+	take := make([][]int32, len(p))
+
+	// Within a residue class of pack, using t-u packs on top of position u
+	// gives (cost[u] - u*pc + t*pc, count[u] - u + t). The t terms are shared,
+	// so the best u over the last c+1 positions is a sliding-window minimum of
+	// (cost[u] - u*pc, count[u] - u), tracked with a monotonic deque.
+	queue := make([]int, 0, limit/p[0]+1)
+	for i, pack := range p {
+		pc := packCost[i]
+		c := avail[i]
+		if c < 0 || c > limit/pack {
+			c = limit / pack
+		}
+		key := func(s, t int) (float64, int) {
+			return cost[s] - float64(t)*pc, count[s] - t
+		}
+		take[i] = make([]int32, limit+1)
+		for r := 0; r < pack && r <= limit; r++ {
+			if r%checkEvery == 0 {
+				if err := ctx.Err(); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			queue = queue[:0]
+			head := 0
+			for t := 0; r+t*pack <= limit; t++ {
+				s := r + t*pack
+				if count[s] >= 0 {
+					kc, kn := key(s, t)
+					for len(queue) > head {
+						last := queue[len(queue)-1]
+						lc, ln := key(r+last*pack, last)
+						if lc < kc || (lc == kc && ln < kn) {
+							break
+						}
+						queue = queue[:len(queue)-1]
+					}
+					queue = append(queue, t)
+				}
+				for head < len(queue) && queue[head] < t-c {
+					head++
+				}
+				if head == len(queue) {
+					nextCount[s] = -1
+					continue
+				}
+				u := queue[head]
+				from := r + u*pack
+				nextCost[s] = cost[from] + float64(t-u)*pc
+				nextCount[s] = count[from] + t - u
+				take[i][s] = int32(t - u)
+			}
+		}
+		cost, nextCost = nextCost, cost
+		count, nextCount = nextCount, count
+	}
+	return cost, count, take, nil
+}
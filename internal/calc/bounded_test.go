@@ -0,0 +1,126 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestCalculatePacksBounded_LimitedLargePack(t *testing.T) {
+	ctx := context.Background()
+	packs := []int{250, 500, 1000, 2000, 5000}
+	// only 3 boxes of 5000 left: 20000 must use smaller packs for the rest
+	counts, total, packCount, err := CalculatePacksBounded(ctx, 20000, packs, map[int]int{5000: 3}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 20000 {
+		t.Fatalf("expected total 20000 got %d", total)
+	}
+	if counts[5000] != 3 || counts[2000] != 2 || counts[1000] != 1 || packCount != 6 {
+		t.Fatalf("unexpected counts: %#v (packCount %d)", counts, packCount)
+	}
+}
+
+func TestCalculatePacksBounded_Insufficient(t *testing.T) {
+	ctx := context.Background()
+	_, _, _, err := CalculatePacksBounded(ctx, 1000, []int{100, 300}, map[int]int{100: 2, 300: 2}, nil)
+	var stockErr *InsufficientStockError
+	if !errors.As(err, &stockErr) {
+		t.Fatalf("expected InsufficientStockError got %v", err)
+	}
+	if stockErr.MaxReachable != 800 {
+		t.Fatalf("expected max reachable 800 got %d", stockErr.MaxReachable)
+	}
+}
+
+func TestCalculatePacksBounded_HugeStock(t *testing.T) {
+	ctx := context.Background()
+	// the stock values alone overflow an int when multiplied by the sizes
+	stock := map[int]int{250: math.MaxInt / 250, 5000: math.MaxInt / 1000}
+	counts, total, _, err := CalculatePacksBounded(ctx, 10250, []int{250, 5000}, stock, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 10250 || counts[5000] != 2 || counts[250] != 1 {
+		t.Fatalf("unexpected result: total=%d counts=%v", total, counts)
+	}
+}
+
+func TestCalculatePacksBounded_NoLimitsMatchesUnbounded(t *testing.T) {
+	ctx := context.Background()
+	want, wantTotal, wantCount, _ := CalculatePacks(ctx, 12001, []int{250, 500, 1000})
+	got, total, count, err := CalculatePacksBounded(ctx, 12001, []int{250, 500, 1000}, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != wantTotal || count != wantCount || got[1000] != want[1000] {
+		t.Fatalf("got (%v, %d, %d) want (%v, %d, %d)", got, total, count, want, wantTotal, wantCount)
+	}
+}
+
+func TestCalculatePacksBounded_Objective(t *testing.T) {
+	ctx := context.Background()
+	// 1000-boxes are cheapest per item but only one is in stock
+	obj := CostObjective{PackCosts: map[int]float64{250: 3, 1000: 1}}
+	counts, total, packCount, err := CalculatePacksBounded(ctx, 2000, []int{250, 1000}, map[int]int{1000: 1}, obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 2000 || counts[1000] != 1 || counts[250] != 4 || packCount != 5 {
+		t.Fatalf("unexpected result: counts=%v total=%d packCount=%d", counts, total, packCount)
+	}
+}
+
+// Compare against exhaustive enumeration of every stock combination.
+func TestCalculatePacksBounded_MatchesBruteForce(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 300; i++ {
+		packs := []int{1 + rng.Intn(20), 21 + rng.Intn(20), 41 + rng.Intn(30)}
+		stock := map[int]int{packs[0]: rng.Intn(6), packs[1]: rng.Intn(6), packs[2]: rng.Intn(6)}
+		target := 1 + rng.Intn(300)
+
+		bestTotal, bestCount := -1, 0
+		for a := 0; a <= stock[packs[0]]; a++ {
+			for b := 0; b <= stock[packs[1]]; b++ {
+				for c := 0; c <= stock[packs[2]]; c++ {
+					s := a*packs[0] + b*packs[1] + c*packs[2]
+					if s < target {
+						continue
+					}
+					if bestTotal == -1 || s < bestTotal || (s == bestTotal && a+b+c < bestCount) {
+						bestTotal, bestCount = s, a+b+c
+					}
+				}
+			}
+		}
+
+		counts, total, packCount, err := CalculatePacksBounded(ctx, target, packs, stock, nil)
+		if bestTotal == -1 {
+			var stockErr *InsufficientStockError
+			if !errors.As(err, &stockErr) {
+				t.Fatalf("packs=%v stock=%v target=%d: expected insufficient stock, got %v", packs, stock, target, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("packs=%v stock=%v target=%d: unexpected error: %v", packs, stock, target, err)
+		}
+		if total != bestTotal || packCount != bestCount {
+			t.Fatalf("packs=%v stock=%v target=%d: got (%d, %d) want (%d, %d)", packs, stock, target, total, packCount, bestTotal, bestCount)
+		}
+		sum := 0
+		for size, qty := range counts {
+			if qty > stock[size] {
+				t.Fatalf("packs=%v stock=%v: used %d of %d", packs, stock, qty, size)
+			}
+			sum += size * qty
+		}
+		if sum != total {
+			t.Fatalf("counts %v do not add up to %d", counts, total)
+		}
+	}
+}
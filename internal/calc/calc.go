@@ -1,88 +1,157 @@
 package calc
 
 import (
+	"context"
 	"errors"
 	"sort"
 )
 
+// checkEvery is how many solver steps run between ctx cancellation checks.
+const checkEvery = 1 << 14
+
 // CalculatePacks finds a combination of pack sizes that achieves total >= target
 // minimizing two objectives in order:
 // 1) minimal total items shipped (S >= target)
 // 2) among totals with same S, minimal number of packs
 //
+// Pack sizes are first divided by their GCD, then solved modulo the largest
+// pack (see residueTable), so memory depends on the pack sizes only. The
+// result is the same counts the plain DP over totals would return. Callers
+// solving many targets for the same packs should keep a Table instead.
+//
+// The solver stops early with ctx.Err() once ctx is done.
+//
 // Returns counts map[packSize]quantity, totalItems, packCount, error.
-func CalculatePacks(target int, packs []int) (map[int]int, int, int, error) {
+func CalculatePacks(ctx context.Context, target int, packs []int) (map[int]int, int, int, error) {
 	if target <= 0 {
-		return nil, 0, 0, errors.New("target must be positive")
+		return nil, 0, 0, ErrInvalidTarget
 	}
-	if len(packs) == 0 {
-		return nil, 0, 0, errors.New("packs empty")
+	t, err := NewTable(ctx, packs)
+	if err != nil {
+		return nil, 0, 0, err
 	}
+	return t.Solve(ctx, target)
+}
 
-	// copy and sort ascending for DP optimization
+// reducePacks returns the pack sizes sorted ascending, deduplicated and
+// divided by their GCD, together with that GCD.
+func reducePacks(packs []int) ([]int, int, error) {
 	p := make([]int, len(packs))
 	copy(p, packs)
 	sort.Ints(p)
-	maxP := p[len(p)-1]
+	if p[0] <= 0 {
+		return nil, 0, ErrInvalidPackSize
+	}
 
-	// DP only needs to consider totals up to target + maxP - 1
-	limit := target + maxP - 1
-	const INF = int(1e9)
+	g := 0
+	out := p[:0]
+	for i, pack := range p {
+		if i > 0 && pack == p[i-1] {
+			continue
+		}
+		g = gcd(g, pack)
+		out = append(out, pack)
+	}
+	for i := range out {
+		out[i] /= g
+	}
+	return out, g, nil
+}
 
-	dp := make([]int, limit+1)   // dp[s] = minimal number of packs to make exactly s (INF if unreachable)
-	prev := make([]int, limit+1) // prev[s] = last pack size used to reach s
+// GCD returns the greatest common divisor of packs, 0 when there are none.
+// Every reachable total is a multiple of it.
+func GCD(packs []int) int {
+	g := 0
+	for _, p := range packs {
+		if p < 0 {
+			p = -p
+		}
+		g = gcd(g, p)
+	}
+	return g
+}
 
-	for i := 1; i <= limit; i++ {
-		dp[i] = INF
-		prev[i] = -1
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
 	}
-	dp[0] = 0
-	prev[0] = -1
+	return a
+}
 
-	// fill DP
-	for s := 1; s <= limit; s++ {
-		for _, pack := range p {
+// calculatePacksDP is the exhaustive DP over every total up to
+// target + maxPack - 1, kept as the reference the residue solver is tested
+// against. p must be non-empty and sorted ascending.
+func calculatePacksDP(ctx context.Context, target int, p []int) (map[int]int, int, int, error) {
+	t := &dpTable{p: p}
+	if err := t.extend(ctx, target+p[len(p)-1]-1); err != nil {
+		return nil, 0, 0, err
+	}
+	return t.solve(target)
+}
+
+// dpTable holds, for every total up to len(count)-1, the fewest packs that
+// make it exactly (-1 if unreachable) and the last pack used to get there.
+type dpTable struct {
+	p     []int // sorted ascending
+	count []int
+	prev  []int
+}
+
+// extend fills the table up to limit, keeping the totals already computed.
+// On cancellation the table keeps what was complete.
+func (t *dpTable) extend(ctx context.Context, limit int) error {
+	from := len(t.count)
+	if limit < from {
+		return nil
+	}
+	count := append(t.count, make([]int, limit+1-from)...)
+	prev := append(t.prev, make([]int, limit+1-from)...)
+	for s := from; s <= limit; s++ {
+		if s%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				t.count, t.prev = count[:s], prev[:s]
+				return err
+			}
+		}
+		count[s], prev[s] = -1, -1
+		if s == 0 {
+			count[0] = 0
+			continue
+		}
+		for _, pack := range t.p {
 			if pack > s {
 				break
 			}
-			if dp[s-pack] != INF {
-				if dp[s] > dp[s-pack]+1 {
-					dp[s] = dp[s-pack] + 1
-					prev[s] = pack
-				}
+			if c := count[s-pack]; c >= 0 && (count[s] < 0 || c+1 < count[s]) {
+				count[s] = c + 1
+				prev[s] = pack
 			}
 		}
 	}
+	t.count, t.prev = count, prev
+	return nil
+}
 
-	// find minimal reachable total S >= target
+// solve returns the minimal reachable total >= target and its packs. The
+// table must reach target + maxPack - 1.
+func (t *dpTable) solve(target int) (map[int]int, int, int, error) {
 	bestS := -1
-	for s := target; s <= limit; s++ {
-		if dp[s] != INF {
+	for s := target; s < len(t.count); s++ {
+		if t.count[s] >= 0 {
 			bestS = s
 			break
 		}
 	}
 	if bestS == -1 {
-		return nil, 0, 0, errors.New("no solution")
+		return nil, 0, 0, ErrNoSolution
 	}
 
-	// reconstruct counts
 	counts := make(map[int]int)
-	s := bestS
-	packCount := 0
-	for s > 0 {
-		pk := prev[s]
-		if pk <= 0 {
+	for s := bestS; s > 0; s -= t.prev[s] {
+		if t.prev[s] <= 0 {
 			return nil, 0, 0, errors.New("reconstruction failed")
 		}
-		counts[pk]++
-		packCount++
-		s -= pk
-		// safety
-		if packCount > limit+10 {
-			return nil, 0, 0, errors.New("reconstruction loop")
-		}
+		counts[t.prev[s]]++
 	}
-
-	return counts, bestS, packCount, nil
+	return counts, bestS, t.count[bestS], nil
 }
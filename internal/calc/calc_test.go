@@ -1,11 +1,19 @@
 package calc
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
 
 func TestCalculatePacksEdgeCase(t *testing.T) {
+	ctx := context.Background()
 	packs := []int{23, 31, 53}
 	target := 500000
-	counts, total, packCount, err := CalculatePacks(target, packs)
+	counts, total, packCount, err := CalculatePacks(ctx, target, packs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -23,7 +31,8 @@ func TestCalculatePacksEdgeCase(t *testing.T) {
 
 // Target zero deve retornar erro
 func TestCalculatePacks_TargetZero(t *testing.T) {
-	_, _, _, err := CalculatePacks(0, []int{10, 20})
+	ctx := context.Background()
+	_, _, _, err := CalculatePacks(ctx, 0, []int{10, 20})
 	if err == nil {
 		t.Fatalf("expected error for target=0, got nil")
 	}
@@ -31,7 +40,8 @@ func TestCalculatePacks_TargetZero(t *testing.T) {
 
 // Lista vazia de packs deve retornar erro
 func TestCalculatePacks_EmptyPacks(t *testing.T) {
-	_, _, _, err := CalculatePacks(100, []int{})
+	ctx := context.Background()
+	_, _, _, err := CalculatePacks(ctx, 100, []int{})
 	if err == nil {
 		t.Fatalf("expected error for empty packs")
 	}
@@ -39,9 +49,10 @@ func TestCalculatePacks_EmptyPacks(t *testing.T) {
 
 // Target pequeno deve usar o menor pack
 func TestCalculatePacks_SmallTarget(t *testing.T) {
+	ctx := context.Background()
 	packs := []int{10, 20, 50}
 	target := 5
-	counts, total, packCount, err := CalculatePacks(target, packs)
+	counts, total, packCount, err := CalculatePacks(ctx, target, packs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -58,9 +69,10 @@ func TestCalculatePacks_SmallTarget(t *testing.T) {
 
 // Target impossível de atingir deve retornar erro
 func TestCalculatePacks_NoSolution(t *testing.T) {
+	ctx := context.Background()
 	packs := []int{4, 6}
 	target := 7
-	counts, total, packCount, err := CalculatePacks(target, packs)
+	counts, total, packCount, err := CalculatePacks(ctx, target, packs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -77,9 +89,10 @@ func TestCalculatePacks_NoSolution(t *testing.T) {
 
 // Packs únicos (deve ser simples de calcular)
 func TestCalculatePacks_SinglePack(t *testing.T) {
+	ctx := context.Background()
 	packs := []int{100}
 	target := 250
-	counts, total, packCount, err := CalculatePacks(target, packs)
+	counts, total, packCount, err := CalculatePacks(ctx, target, packs)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -93,3 +106,107 @@ func TestCalculatePacks_SinglePack(t *testing.T) {
 		t.Fatalf("expected packCount=3 got %d", packCount)
 	}
 }
+
+// The GCD/residue solver must agree with the plain DP on every input.
+func TestCalculatePacks_MatchesDP(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42))
+	for i := 0; i < 500; i++ {
+		packs := make([]int, 1+rng.Intn(4))
+		mult := 1 + rng.Intn(5)
+		for j := range packs {
+			packs[j] = mult * (1 + rng.Intn(40))
+		}
+		target := 1 + rng.Intn(5000)
+		checkMatchesDP(t, ctx, target, packs)
+	}
+	// large packs with targets below the residue shortcut, where the
+	// residue table has to search for a filling that fits
+	for i := 0; i < 60; i++ {
+		packs := make([]int, 2+rng.Intn(3))
+		for j := range packs {
+			packs[j] = 200 + rng.Intn(1300)
+		}
+		table, err := NewTable(ctx, packs)
+		if err != nil {
+			t.Fatalf("packs=%v: NewTable error: %v", packs, err)
+		}
+		// totals ≡ r in [minSum[r], bestSum[r]) miss the shortcut
+		res := table.residue
+		for j := 0; j < 5; j++ {
+			r := rng.Intn(res.mod)
+			target := 1 + rng.Intn(res.mod*res.mod*table.g)
+			if gap := (res.bestSum[r] - res.minSum[r]) / res.mod; gap > 0 {
+				target = (res.minSum[r] + rng.Intn(gap)*res.mod) * table.g
+			}
+			checkMatchesDP(t, ctx, target, packs)
+		}
+	}
+}
+
+func checkMatchesDP(t *testing.T, ctx context.Context, target int, packs []int) {
+	t.Helper()
+	counts, total, packCount, err := CalculatePacks(ctx, target, packs)
+	if err != nil {
+		t.Fatalf("packs=%v target=%d: unexpected error: %v", packs, target, err)
+	}
+	sorted := append([]int(nil), packs...)
+	sort.Ints(sorted)
+	wantCounts, wantTotal, wantCount, err := calculatePacksDP(ctx, target, sorted)
+	if err != nil {
+		t.Fatalf("packs=%v target=%d: dp error: %v", packs, target, err)
+	}
+	if total != wantTotal || packCount != wantCount || !reflect.DeepEqual(counts, wantCounts) {
+		t.Fatalf("packs=%v target=%d: got (%v, %d, %d) want (%v, %d, %d)",
+			packs, target, counts, total, packCount, wantCounts, wantTotal, wantCount)
+	}
+}
+
+func TestCalculatePacks_LargeOrder(t *testing.T) {
+	ctx := context.Background()
+	packs := []int{250, 500, 1000, 2000, 5000}
+	counts, total, packCount, err := CalculatePacks(ctx, 500_000_001, packs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 500_000_250 {
+		t.Fatalf("expected total 500000250 got %d", total)
+	}
+	if packCount != 100_001 || counts[5000] != 100_000 || counts[250] != 1 {
+		t.Fatalf("unexpected counts: %#v (packCount %d)", counts, packCount)
+	}
+}
+
+func TestCalculatePacks_NonPositivePack(t *testing.T) {
+	ctx := context.Background()
+	_, _, _, err := CalculatePacks(ctx, 10, []int{5, 0})
+	if err == nil {
+		t.Fatalf("expected error for zero pack size")
+	}
+}
+
+func TestCalculatePacks_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err := CalculatePacks(ctx, 5_000_000, []int{99989, 99991})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled got %v", err)
+	}
+}
+
+func TestGCD(t *testing.T) {
+	cases := []struct {
+		packs []int
+		want  int
+	}{
+		{nil, 0},
+		{[]int{250, 500, 1000}, 250},
+		{[]int{23, 31, 53}, 1},
+		{[]int{6, 9}, 3},
+	}
+	for _, tc := range cases {
+		if got := GCD(tc.packs); got != tc.want {
+			t.Errorf("GCD(%v) = %d, want %d", tc.packs, got, tc.want)
+		}
+	}
+}
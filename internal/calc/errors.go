@@ -0,0 +1,20 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned by the solvers for input they cannot solve. Callers match
+// them with errors.Is; InsufficientStockError also matches ErrInsufficientStock.
+var (
+	ErrInvalidTarget       = errors.New("target must be positive")
+	ErrNoPacks             = errors.New("packs empty")
+	ErrInvalidPackSize     = errors.New("pack sizes must be positive")
+	ErrNegativeStock       = errors.New("stock must not be negative")
+	ErrNegativeCost        = errors.New("pack cost must not be negative")
+	ErrNoSolution          = errors.New("no solution")
+	ErrInsufficientStock   = errors.New("insufficient stock")
+	ErrInvalidAlternatives = fmt.Errorf("k must be between 1 and %d", MaxAlternatives)
+	ErrOrderTooLarge       = errors.New("order too large for alternatives")
+)
@@ -0,0 +1,49 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	ctx := context.Background()
+	solve := func(target int, packs []int) error {
+		_, _, _, err := CalculatePacks(ctx, target, packs)
+		return err
+	}
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"target zero", solve(0, []int{10}), ErrInvalidTarget},
+		{"no packs", solve(10, nil), ErrNoPacks},
+		{"zero pack", solve(10, []int{5, 0}), ErrInvalidPackSize},
+		{"negative stock", func() error {
+			_, _, _, err := CalculatePacksBounded(ctx, 10, []int{5}, map[int]int{5: -1}, nil)
+			return err
+		}(), ErrNegativeStock},
+		{"negative cost", func() error {
+			_, _, _, err := CalculatePacksWithObjective(ctx, 10, []int{10}, CostObjective{PackCosts: map[int]float64{10: -1}})
+			return err
+		}(), ErrNegativeCost},
+		{"insufficient stock", func() error {
+			_, _, _, err := CalculatePacksBounded(ctx, 1000, []int{100}, map[int]int{100: 2}, nil)
+			return err
+		}(), ErrInsufficientStock},
+		{"invalid k", func() error {
+			_, err := TopSolutions(ctx, 10, []int{5}, 0)
+			return err
+		}(), ErrInvalidAlternatives},
+		{"order too large", func() error {
+			_, err := TopSolutions(ctx, maxAlternativesEntries, []int{1}, 2)
+			return err
+		}(), ErrOrderTooLarge},
+	}
+	for _, tc := range cases {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: expected %v got %v", tc.name, tc.want, tc.err)
+		}
+	}
+}
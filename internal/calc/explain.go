@@ -0,0 +1,102 @@
+package calc
+
+import (
+	"context"
+	"errors"
+)
+
+// maxExplainTotals caps how many unreachable totals Explain lists.
+const maxExplainTotals = 100
+
+// maxRunnersUp caps how many runner-up combinations Explain lists.
+const maxRunnersUp = 5
+
+// Explanation lists the facts behind the combination CalculatePacks picks.
+type Explanation struct {
+	// MinimalTotal is the smallest reachable total >= target.
+	MinimalTotal int
+	// Unreachable lists the multiples of GCD in [target, MinimalTotal),
+	// which no combination makes, ascending and at most maxExplainTotals.
+	Unreachable []int
+	// RunnersUp are the combinations of MinimalTotal with more packs than
+	// the one picked, fewest packs first. Nil when the order is too large
+	// to enumerate them.
+	RunnersUp []Solution
+	// GCD of the pack sizes: only its multiples can be shipped.
+	GCD int
+	// LargestUnreachable is the largest multiple of GCD no combination
+	// makes, 0 when every multiple is reachable.
+	LargestUnreachable int
+}
+
+// Explain returns why CalculatePacks picks its combination for target.
+func Explain(ctx context.Context, target int, packs []int) (Explanation, error) {
+	if target <= 0 {
+		return Explanation{}, ErrInvalidTarget
+	}
+	table, err := NewTable(ctx, packs)
+	if err != nil {
+		return Explanation{}, err
+	}
+	return table.Explain(ctx, target, nil)
+}
+
+// Explain returns why CalculatePacksBounded picks its combination for
+// target within stock, which is CalculatePacks when stock limits none of
+// the packs of t. LargestUnreachable ignores stock.
+func (t *Table) Explain(ctx context.Context, target int, stock map[int]int) (Explanation, error) {
+	if target <= 0 {
+		return Explanation{}, ErrInvalidTarget
+	}
+	g := t.g
+	limited := false
+	for _, pack := range t.p {
+		if _, ok := stock[pack*g]; ok {
+			limited = true
+		}
+	}
+	var best, packCount int
+	var err error
+	if limited {
+		_, best, packCount, err = CalculatePacksBounded(ctx, target, t.packs(), stock, nil)
+	} else {
+		_, best, packCount, err = t.Solve(ctx, target)
+	}
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	e := Explanation{MinimalTotal: best, Unreachable: []int{}, GCD: g}
+	// every multiple of g between target and best would have been picked
+	// had some combination made it
+	for s := (target + g - 1) / g * g; s < best && len(e.Unreachable) < maxExplainTotals; s += g {
+		e.Unreachable = append(e.Unreachable, s)
+	}
+	// reachable totals of residue r are minSum[r] plus any number of the
+	// largest pack, so the largest gap sits one pack below the largest minSum
+	for _, m := range t.residue.minSum {
+		if gap := (m - t.residue.mod) * g; gap > e.LargestUnreachable {
+			e.LargestUnreachable = gap
+		}
+	}
+
+	// the runners-up ship as much as best but need more packs; ties on
+	// packs would have been as good a pick
+	limit := best / g
+	if !fitsSuffix(t.p, limit) {
+		return e, nil
+	}
+	en := &enumerator{ctx: ctx, p: t.p, avail: availableStock(t.p, g, stock), k: maxRunnersUp, suffix: suffixMinPacks(t.p, limit), vec: make([]int, len(t.p))}
+	en.search(limit, packCount+1)
+	if errors.Is(en.err, ErrOrderTooLarge) {
+		return e, nil
+	}
+	if en.err != nil {
+		return Explanation{}, en.err
+	}
+	e.RunnersUp = make([]Solution, len(en.found))
+	for i, f := range en.found {
+		e.RunnersUp[i] = f.solution(t.p, g)
+	}
+	return e, nil
+}
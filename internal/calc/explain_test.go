@@ -0,0 +1,113 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestExplain_UnreachableTotals(t *testing.T) {
+	ctx := context.Background()
+	e, err := Explain(ctx, 43, []int{6, 9, 20})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.MinimalTotal != 44 || !reflect.DeepEqual(e.Unreachable, []int{43}) {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+	if e.GCD != 1 || e.LargestUnreachable != 43 {
+		t.Fatalf("expected gcd 1 and largest unreachable 43, got %+v", e)
+	}
+}
+
+func TestExplain_RunnersUpAndGCD(t *testing.T) {
+	ctx := context.Background()
+	e, err := Explain(ctx, 11, []int{4, 6})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.MinimalTotal != 12 || e.GCD != 2 || e.LargestUnreachable != 2 || len(e.Unreachable) != 0 {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+	want := []Solution{{Counts: map[int]int{4: 3}, Total: 12, PackCount: 3}}
+	if !reflect.DeepEqual(e.RunnersUp, want) {
+		t.Fatalf("runners up: got %+v want %+v", e.RunnersUp, want)
+	}
+}
+
+func TestExplain_RunnersUpNeedMorePacks(t *testing.T) {
+	ctx := context.Background()
+	// 1+3 is picked; 2+2 ties it on packs and is no runner-up
+	e, err := Explain(ctx, 4, []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Solution{
+		{Counts: map[int]int{1: 2, 2: 1}, Total: 4, PackCount: 3},
+		{Counts: map[int]int{1: 4}, Total: 4, PackCount: 4},
+	}
+	if !reflect.DeepEqual(e.RunnersUp, want) {
+		t.Fatalf("runners up: got %+v want %+v", e.RunnersUp, want)
+	}
+}
+
+func TestExplain_LargeOrderSkipsRunnersUp(t *testing.T) {
+	ctx := context.Background()
+	e, err := Explain(ctx, 100_000_000, []int{23, 31, 53})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.MinimalTotal != 100_000_000 || e.RunnersUp != nil {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+
+	// small enough for the table but not for the step budget
+	packs := make([]int, 50)
+	for i := range packs {
+		packs[i] = 100 + i
+	}
+	e, err = Explain(ctx, 100_000, packs)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.MinimalTotal != 100_000 || e.RunnersUp != nil {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+}
+
+func TestTableExplain_Stock(t *testing.T) {
+	ctx := context.Background()
+	table, err := NewTable(ctx, []int{23, 31, 53})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := table.Explain(ctx, 53, map[int]int{53: 0})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e.MinimalTotal != 54 || !reflect.DeepEqual(e.Unreachable, []int{53}) || len(e.RunnersUp) != 0 {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+
+	// runners-up respect the stock too: 6+6 does not fit, so 6+4+2 is
+	// picked and the runners-up use at most one 6-pack
+	table, _ = NewTable(ctx, []int{2, 4, 6})
+	e, err = table.Explain(ctx, 12, map[int]int{6: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Solution{
+		{Counts: map[int]int{2: 3, 6: 1}, Total: 12, PackCount: 4},
+		{Counts: map[int]int{2: 2, 4: 2}, Total: 12, PackCount: 4},
+		{Counts: map[int]int{2: 4, 4: 1}, Total: 12, PackCount: 5},
+		{Counts: map[int]int{2: 6}, Total: 12, PackCount: 6},
+	}
+	if e.MinimalTotal != 12 || !reflect.DeepEqual(e.RunnersUp, want) {
+		t.Fatalf("unexpected explanation: %+v", e)
+	}
+
+	if _, err := table.Explain(ctx, 12, map[int]int{2: -1}); !errors.Is(err, ErrNegativeStock) {
+		t.Fatalf("expected ErrNegativeStock got %v", err)
+	}
+}
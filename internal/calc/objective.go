@@ -0,0 +1,120 @@
+package calc
+
+import (
+	"context"
+)
+
+// Objective scores a combination of packs. CalculatePacksWithObjective picks
+// the combination with the lowest sum of PackCost over every pack shipped plus
+// WasteCost of the overshipped items. PackCost must not be negative and
+// WasteCost must not decrease as n grows.
+type Objective interface {
+	// PackCost returns the cost of shipping one pack of the given size.
+	PackCost(size int) float64
+	// WasteCost returns the cost of shipping n items more than ordered.
+	WasteCost(n int) float64
+}
+
+// CostObjective charges a fixed cost per pack size (box price plus handling)
+// and ItemValue for every overshipped item. With ItemValue zero it minimises
+// pack cost alone. Sizes missing from PackCosts cost nothing.
+type CostObjective struct {
+	PackCosts map[int]float64
+	ItemValue float64
+}
+
+func (o CostObjective) PackCost(size int) float64 { return o.PackCosts[size] }
+func (o CostObjective) WasteCost(n int) float64   { return float64(n) * o.ItemValue }
+
+// TotalCost returns the score obj gives to counts shipping total items for target.
+func TotalCost(obj Objective, target int, counts map[int]int, total int) float64 {
+	cost := obj.WasteCost(total - target)
+	for size, qty := range counts {
+		cost += obj.PackCost(size) * float64(qty)
+	}
+	return cost
+}
+
+// CalculatePacksWithObjective finds a combination of pack sizes with total >= target
+// minimizing obj. Ties are broken by fewer overshipped items, then fewer packs.
+// A nil obj is the default objective of CalculatePacks.
+//
+// Returns counts map[packSize]quantity, totalItems, packCount, error.
+func CalculatePacksWithObjective(ctx context.Context, target int, packs []int, obj Objective) (map[int]int, int, int, error) {
+	if obj == nil {
+		return CalculatePacks(ctx, target, packs)
+	}
+	if target <= 0 {
+		return nil, 0, 0, ErrInvalidTarget
+	}
+	if len(packs) == 0 {
+		return nil, 0, 0, ErrNoPacks
+	}
+
+	p, g, err := reducePacks(packs)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	packCost := make([]float64, len(p))
+	for i, pack := range p {
+		packCost[i] = obj.PackCost(pack * g)
+		if packCost[i] < 0 {
+			return nil, 0, 0, ErrNegativeCost
+		}
+	}
+
+	// with non-negative costs, dropping a pack from any total above
+	// target + maxP - 1 never costs more, so the same bound as the DP applies
+	reducedTarget := (target + g - 1) / g
+	limit := reducedTarget + p[len(p)-1] - 1
+
+	cost := make([]float64, limit+1) // cost[s] = cheapest way to make exactly s
+	count := make([]int, limit+1)    // count[s] = packs used by cost[s], -1 if unreachable
+	prev := make([]int, limit+1)     // prev[s] = last pack size used to reach s
+	for s := 1; s <= limit; s++ {
+		count[s] = -1
+	}
+
+	for s := 1; s <= limit; s++ {
+		if s%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, 0, 0, err
+			}
+		}
+		for i, pack := range p {
+			if pack > s {
+				break
+			}
+			if count[s-pack] < 0 {
+				continue
+			}
+			c := cost[s-pack] + packCost[i]
+			n := count[s-pack] + 1
+			if count[s] < 0 || c < cost[s] || (c == cost[s] && n < count[s]) {
+				cost[s], count[s], prev[s] = c, n, pack
+			}
+		}
+	}
+
+	bestS := -1
+	var bestScore float64
+	for s := reducedTarget; s <= limit; s++ {
+		if count[s] < 0 {
+			continue
+		}
+		score := cost[s] + obj.WasteCost(s*g-target)
+		// ascending s with a strict comparison keeps the lower waste on ties
+		if bestS == -1 || score < bestScore {
+			bestS, bestScore = s, score
+		}
+	}
+	if bestS == -1 {
+		return nil, 0, 0, ErrNoSolution
+	}
+
+	counts := make(map[int]int)
+	for s := bestS; s > 0; s -= prev[s] {
+		counts[prev[s]*g]++
+	}
+	return counts, bestS * g, count[bestS], nil
+}
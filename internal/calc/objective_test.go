@@ -0,0 +1,65 @@
+package calc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCalculatePacksWithObjective_NilIsDefault(t *testing.T) {
+	ctx := context.Background()
+	want, wantTotal, wantCount, _ := CalculatePacks(ctx, 501, []int{250, 500, 1000})
+	got, total, count, err := CalculatePacksWithObjective(ctx, 501, []int{250, 500, 1000}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != wantTotal || count != wantCount || got[250] != want[250] || got[500] != want[500] {
+		t.Fatalf("got (%v, %d, %d) want (%v, %d, %d)", got, total, count, want, wantTotal, wantCount)
+	}
+}
+
+func TestCalculatePacksWithObjective_PackCost(t *testing.T) {
+	ctx := context.Background()
+	// a 1000 box costs more than four 250 boxes
+	obj := CostObjective{PackCosts: map[int]float64{250: 1, 1000: 5}}
+	counts, total, packCount, err := CalculatePacksWithObjective(ctx, 1000, []int{250, 1000}, obj)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 1000 || packCount != 4 || counts[250] != 4 {
+		t.Fatalf("unexpected result: counts=%v total=%d packCount=%d", counts, total, packCount)
+	}
+	if cost := TotalCost(obj, 1000, counts, total); cost != 4 {
+		t.Fatalf("expected cost 4 got %v", cost)
+	}
+}
+
+func TestCalculatePacksWithObjective_Mixed(t *testing.T) {
+	ctx := context.Background()
+	// cheap big box vs exact fit: waste of 499 items outweighs one box price
+	packs := []int{250, 1000}
+	costs := map[int]float64{250: 2, 1000: 2}
+
+	counts, total, _, err := CalculatePacksWithObjective(ctx, 501, packs, CostObjective{PackCosts: costs})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 1000 || counts[1000] != 1 {
+		t.Fatalf("cost only: expected one 1000 box, got %v", counts)
+	}
+
+	counts, total, _, err = CalculatePacksWithObjective(ctx, 501, packs, CostObjective{PackCosts: costs, ItemValue: 0.1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 750 || counts[250] != 3 {
+		t.Fatalf("mixed: expected three 250 boxes, got %v", counts)
+	}
+}
+
+func TestCalculatePacksWithObjective_NegativeCost(t *testing.T) {
+	ctx := context.Background()
+	obj := CostObjective{PackCosts: map[int]float64{10: -1}}
+	if _, _, _, err := CalculatePacksWithObjective(ctx, 10, []int{10}, obj); err == nil {
+		t.Fatalf("expected error for negative pack cost")
+	}
+}
@@ -0,0 +1,310 @@
+package calc
+
+import (
+	"container/heap"
+	"context"
+)
+
+// residueTable solves large targets without a table indexed by total.
+//
+// Let L be the largest pack. Any total splits into some packs of size L plus
+// a filling made of the smaller packs, and only the filling's residue modulo
+// L matters for which totals it can complete. For each residue r the table
+// keeps:
+//
+//   - minSum[r]: the smallest total ≡ r (mod L) that can be built at all;
+//   - best[r]:   the filling of r that needs the fewest packs overall.
+//
+// A filling with n packs summing to R completes total S with (S-R)/L packs of
+// size L, i.e. (S + n*L - R)/L packs in total. Minimising n*L - R, where every
+// small pack p contributes L-p > 0, is a shortest path over L residues, so
+// both columns come from Dijkstra. Ties are broken by preferring more of the
+// smaller packs, which is the combination the DP reconstructs.
+//
+// best[r] is only valid for totals S >= bestSum[r]. Below that, solve runs
+// the same search again for the one query, keeping only fillings that fit
+// in S (see fill), so nothing is ever indexed by total.
+type residueTable struct {
+	mod     int
+	small   []int
+	minSum  []int
+	best    [][]int
+	bestWt  []int
+	bestSum []int
+}
+
+// newResidueTable builds the table for p, sorted ascending and deduplicated.
+func newResidueTable(ctx context.Context, p []int) (*residueTable, error) {
+	t := &residueTable{
+		mod:   p[len(p)-1],
+		small: p[:len(p)-1],
+	}
+	if err := t.fillMinSum(ctx); err != nil {
+		return nil, err
+	}
+	if err := t.fillBest(ctx); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// solve returns the minimal reachable total >= target and its packs.
+func (t *residueTable) solve(ctx context.Context, target int) (map[int]int, int, int, error) {
+	// totals ≡ r (mod L) are reachable exactly from minSum[r] on, so the
+	// minimal reachable total is the lowest of one candidate per residue
+	bestS := -1
+	for s := target; s < target+t.mod; s++ {
+		cand := s
+		if m := t.minSum[s%t.mod]; m < 0 {
+			continue
+		} else if m > s {
+			cand = m
+		}
+		if bestS == -1 || cand < bestS {
+			bestS = cand
+		}
+	}
+	if bestS == -1 {
+		return nil, 0, 0, ErrNoSolution
+	}
+
+	r := bestS % t.mod
+	filling, sum := t.best[r], t.bestSum[r]
+	if bestS < sum {
+		var err error
+		if filling, sum, err = t.fill(ctx, bestS); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	counts := make(map[int]int)
+	packCount := 0
+	for i, qty := range filling {
+		if qty > 0 {
+			counts[t.small[i]] = qty
+			packCount += qty
+		}
+	}
+	if big := (bestS - sum) / t.mod; big > 0 {
+		counts[t.mod] = big
+		packCount += big
+	}
+	return counts, bestS, packCount, nil
+}
+
+// fill returns the best filling of total whose sum fits in total, for
+// totals below bestSum. It is fillBest with a filling kept per residue for
+// every sum it improves on: a filling popped later at the same residue has
+// at least the weight of an earlier one, so it is only worth extending when
+// its sum is smaller. The first filling popped at the residue of total is
+// the answer. Fillings are kept as a tree of their last pack so the search
+// costs a few words per filling, not a count per pack size.
+func (t *residueTable) fill(ctx context.Context, total int) ([]int, int, error) {
+	target := total % t.mod
+	minSum := make([]int, t.mod)
+	for r := range minSum {
+		minSum[r] = -1
+	}
+	f := &fillSearch{
+		small: t.small,
+		nodes: []fillNode{{parent: -1}},
+		heap:  []fillLabel{{}},
+		a:     make([]int, len(t.small)),
+		b:     make([]int, len(t.small)),
+	}
+	for step := 1; f.Len() > 0; step++ {
+		if step%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, 0, err
+			}
+		}
+		cur := heap.Pop(f).(fillLabel)
+		if minSum[cur.residue] >= 0 && cur.sum >= minSum[cur.residue] {
+			continue
+		}
+		minSum[cur.residue] = cur.sum
+		if cur.residue == target {
+			counts := make([]int, len(t.small))
+			f.counts(cur.node, counts)
+			return counts, cur.sum, nil
+		}
+		for i, p := range t.small {
+			next, sum := (cur.residue+p)%t.mod, cur.sum+p
+			if sum > total || (minSum[next] >= 0 && sum >= minSum[next]) {
+				continue
+			}
+			f.nodes = append(f.nodes, fillNode{parent: cur.node, pack: i})
+			heap.Push(f, fillLabel{
+				residue: next,
+				weight:  cur.weight + t.mod - p,
+				sum:     sum,
+				node:    len(f.nodes) - 1,
+			})
+		}
+	}
+	return nil, 0, ErrNoSolution
+}
+
+// fillNode is one pack of a filling; the filling is the path to the root.
+type fillNode struct {
+	parent int
+	pack   int
+}
+
+// fillLabel is a filling reached by fill.
+type fillLabel struct {
+	residue int
+	weight  int
+	sum     int
+	node    int
+}
+
+// fillSearch is the heap of fill, ordered like labelHeap. Counts are only
+// rebuilt from the tree to break ties on weight.
+type fillSearch struct {
+	small []int
+	nodes []fillNode
+	heap  []fillLabel
+	a, b  []int
+}
+
+// counts sets dst to the per-pack counts of the filling ending at node.
+func (f *fillSearch) counts(node int, dst []int) {
+	clear(dst)
+	for ; node > 0; node = f.nodes[node].parent {
+		dst[f.nodes[node].pack]++
+	}
+}
+
+func (f *fillSearch) Len() int { return len(f.heap) }
+func (f *fillSearch) Less(i, j int) bool {
+	a, b := f.heap[i], f.heap[j]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	f.counts(a.node, f.a)
+	f.counts(b.node, f.b)
+	return label{counts: f.a}.less(label{counts: f.b})
+}
+func (f *fillSearch) Swap(i, j int) { f.heap[i], f.heap[j] = f.heap[j], f.heap[i] }
+func (f *fillSearch) Push(x any)    { f.heap = append(f.heap, x.(fillLabel)) }
+func (f *fillSearch) Pop() any {
+	old := f.heap
+	n := len(old)
+	x := old[n-1]
+	f.heap = old[:n-1]
+	return x
+}
+
+// fillMinSum runs Dijkstra on residues with edge weight p for every small pack.
+func (t *residueTable) fillMinSum(ctx context.Context) error {
+	t.minSum = make([]int, t.mod)
+	for r := range t.minSum {
+		t.minSum[r] = -1
+	}
+	t.minSum[0] = 0
+
+	done := make([]bool, t.mod)
+	h := &labelHeap{{residue: 0}}
+	for step := 1; h.Len() > 0; step++ {
+		if step%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		cur := heap.Pop(h).(label)
+		if done[cur.residue] {
+			continue
+		}
+		done[cur.residue] = true
+		for _, p := range t.small {
+			next := (cur.residue + p) % t.mod
+			sum := cur.weight + p
+			if t.minSum[next] < 0 || sum < t.minSum[next] {
+				t.minSum[next] = sum
+				heap.Push(h, label{residue: next, weight: sum})
+			}
+		}
+	}
+	return nil
+}
+
+// fillBest runs Dijkstra on residues with edge weight L-p, breaking ties on
+// the per-pack counts in ascending pack order.
+func (t *residueTable) fillBest(ctx context.Context) error {
+	t.best = make([][]int, t.mod)
+	t.bestWt = make([]int, t.mod)
+	t.bestSum = make([]int, t.mod)
+	t.best[0] = make([]int, len(t.small))
+
+	done := make([]bool, t.mod)
+	h := &labelHeap{{residue: 0, counts: t.best[0]}}
+	for step := 1; h.Len() > 0; step++ {
+		if step%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		cur := heap.Pop(h).(label)
+		if done[cur.residue] {
+			continue
+		}
+		done[cur.residue] = true
+		for i, p := range t.small {
+			next := (cur.residue + p) % t.mod
+			if done[next] {
+				continue
+			}
+			cand := label{
+				residue: next,
+				weight:  cur.weight + t.mod - p,
+				sum:     cur.sum + p,
+				counts:  make([]int, len(cur.counts)),
+			}
+			copy(cand.counts, cur.counts)
+			cand.counts[i]++
+			if t.best[next] == nil || cand.less(label{weight: t.bestWt[next], counts: t.best[next]}) {
+				t.best[next] = cand.counts
+				t.bestWt[next] = cand.weight
+				t.bestSum[next] = cand.sum
+				heap.Push(h, cand)
+			}
+		}
+	}
+	return nil
+}
+
+// label is a tentative Dijkstra distance for one residue.
+type label struct {
+	residue int
+	weight  int
+	sum     int
+	counts  []int
+}
+
+// less orders by weight, then by more packs of the smaller sizes.
+func (a label) less(b label) bool {
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	for i := range a.counts {
+		if a.counts[i] != b.counts[i] {
+			return a.counts[i] > b.counts[i]
+		}
+	}
+	return false
+}
+
+type labelHeap []label
+
+func (h labelHeap) Len() int           { return len(h) }
+func (h labelHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+func (h labelHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *labelHeap) Push(x any)        { *h = append(*h, x.(label)) }
+func (h *labelHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,65 @@
+package calc
+
+import "context"
+
+// Table answers CalculatePacks for one set of pack sizes, keeping everything
+// that depends on the packs alone between calls: the residue table is built
+// once and never grows. A query then costs O(largest pack) plus the size of
+// the answer, or a search bounded by the target when it is too small for the
+// residue shortcut. It is safe for concurrent use.
+type Table struct {
+	g       int
+	p       []int
+	residue *residueTable
+}
+
+// NewTable builds the Table of packs.
+func NewTable(ctx context.Context, packs []int) (*Table, error) {
+	if len(packs) == 0 {
+		return nil, ErrNoPacks
+	}
+	p, g, err := reducePacks(packs)
+	if err != nil {
+		return nil, err
+	}
+	residue, err := newResidueTable(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return &Table{g: g, p: p, residue: residue}, nil
+}
+
+// Solve is CalculatePacks for the packs of t.
+func (t *Table) Solve(ctx context.Context, target int) (map[int]int, int, int, error) {
+	if target <= 0 {
+		return nil, 0, 0, ErrInvalidTarget
+	}
+	// every reachable total is a multiple of g
+	reducedTarget := (target + t.g - 1) / t.g
+
+	counts, total, packCount, err := t.residue.solve(ctx, reducedTarget)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	scaled := make(map[int]int, len(counts))
+	for size, qty := range counts {
+		scaled[size*t.g] = qty
+	}
+	return scaled, total * t.g, packCount, nil
+}
+
+// packs returns the pack sizes of t.
+func (t *Table) packs() []int {
+	out := make([]int, len(t.p))
+	for i, pack := range t.p {
+		out[i] = pack * t.g
+	}
+	return out
+}
+
+// Entries is the number of residues t keeps, one per unit of the largest
+// pack. It is fixed once t is built.
+func (t *Table) Entries() int {
+	return t.residue.mod
+}
@@ -0,0 +1,194 @@
+package calc
+
+import (
+	"context"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTable_MatchesCalculatePacks(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(11))
+	for i := 0; i < 50; i++ {
+		packs := []int{1 + rng.Intn(60), 1 + rng.Intn(60), 1 + rng.Intn(60), 1 + rng.Intn(60)}
+		table, err := NewTable(ctx, packs)
+		if err != nil {
+			t.Fatalf("NewTable error: %v", err)
+		}
+		for j := 0; j < 40; j++ {
+			target := 1 + rng.Intn(5000)
+			wantCounts, wantTotal, wantCount, err := CalculatePacks(ctx, target, packs)
+			if err != nil {
+				t.Fatalf("CalculatePacks error: %v", err)
+			}
+			counts, total, packCount, err := table.Solve(ctx, target)
+			if err != nil {
+				t.Fatalf("Solve error: %v", err)
+			}
+			if total != wantTotal || packCount != wantCount || !reflect.DeepEqual(counts, wantCounts) {
+				t.Fatalf("packs=%v target=%d: got %v %d %d want %v %d %d", packs, target, counts, total, packCount, wantCounts, wantTotal, wantCount)
+			}
+		}
+	}
+}
+
+func TestTable_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	packs := []int{23, 31, 53}
+	table, err := NewTable(ctx, packs)
+	if err != nil {
+		t.Fatalf("NewTable error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for target := 1 + w; target < 3000; target += 8 {
+				_, want, _, _ := CalculatePacks(ctx, target, packs)
+				if _, total, _, err := table.Solve(ctx, target); err != nil || total != want {
+					t.Errorf("target=%d: got %d, %v want %d", target, total, err, want)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+func TestTable_FillCanceled(t *testing.T) {
+	ctx := context.Background()
+	packs := []int{34147, 74078, 74324}
+	table, err := NewTable(ctx, packs)
+	if err != nil {
+		t.Fatalf("NewTable error: %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, _, err := table.Solve(canceled, 219_999_892); err != context.Canceled {
+		t.Fatalf("expected context.Canceled got %v", err)
+	}
+}
+
+// Targets below the residue shortcut with large packs, checked against every
+// count of the two smaller packs; a DP over these totals would need GBs.
+func TestTable_LargePacks(t *testing.T) {
+	ctx := context.Background()
+	x, y, l := 34147, 74078, 74324
+	table, err := NewTable(ctx, []int{x, y, l})
+	if err != nil {
+		t.Fatalf("NewTable error: %v", err)
+	}
+	for _, target := range []int{20_000_000, 219_999_892} {
+		counts, total, packCount, err := table.Solve(ctx, target)
+		if err != nil {
+			t.Fatalf("target=%d: Solve error: %v", target, err)
+		}
+		wantTotal, wantCount, wantA, wantB := -1, 0, 0, 0
+		for a := 0; a*x < target+l; a++ {
+			for b := 0; a*x+b*y < target+l; b++ {
+				sum := a*x + b*y
+				c := 0
+				if sum < target {
+					c = (target - sum + l - 1) / l
+				}
+				sum += c * l
+				n := a + b + c
+				if wantTotal == -1 || sum < wantTotal || (sum == wantTotal && n <= wantCount) {
+					wantTotal, wantCount, wantA, wantB = sum, n, a, b
+				}
+			}
+		}
+		if total != wantTotal || packCount != wantCount || counts[x] != wantA || counts[y] != wantB {
+			t.Fatalf("target=%d: got %v %d %d want %d×%d %d×%d total %d packs %d",
+				target, counts, total, packCount, wantA, x, wantB, y, wantTotal, wantCount)
+		}
+	}
+	if n := table.Entries(); n != l {
+		t.Fatalf("expected %d entries got %d", l, n)
+	}
+}
+
+func TestTable_Entries(t *testing.T) {
+	ctx := context.Background()
+	table, err := NewTable(ctx, []int{3, 5})
+	if err != nil {
+		t.Fatalf("NewTable error: %v", err)
+	}
+	if n := table.Entries(); n != 5 {
+		t.Fatalf("expected 5 residue entries got %d", n)
+	}
+	// small targets do not grow the table
+	if _, _, _, err := table.Solve(ctx, 4); err != nil {
+		t.Fatalf("Solve error: %v", err)
+	}
+	if n := table.Entries(); n != 5 {
+		t.Fatalf("expected 5 entries got %d", n)
+	}
+}
+
+var benchPacks = []int{250, 500, 1000, 2000, 5000}
+
+func benchTargets() []int {
+	rng := rand.New(rand.NewSource(1))
+	targets := make([]int, 1024)
+	for i := range targets {
+		targets[i] = 1 + rng.Intn(1_000_000)
+	}
+	return targets
+}
+
+func BenchmarkCalculatePacks(b *testing.B) {
+	ctx := context.Background()
+	targets := benchTargets()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := CalculatePacks(ctx, targets[i%len(targets)], benchPacks); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTableSolve(b *testing.B) {
+	ctx := context.Background()
+	targets := benchTargets()
+	table, err := NewTable(ctx, benchPacks)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := table.Solve(ctx, targets[i%len(targets)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCalculatePacks_PrimePacks(b *testing.B) {
+	ctx := context.Background()
+	targets := benchTargets()
+	packs := []int{997, 1009, 4999}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := CalculatePacks(ctx, targets[i%len(targets)], packs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTableSolve_PrimePacks(b *testing.B) {
+	ctx := context.Background()
+	targets := benchTargets()
+	table, err := NewTable(ctx, []int{997, 1009, 4999})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := table.Solve(ctx, targets[i%len(targets)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+// Package config loads the configuration of packcalc from defaults, a
+// YAML, TOML or JSON file, environment variables and flags, each layer
+// overriding the previous one. It depends on none of the packages it
+// configures: cmd/packcalc maps the settings onto them.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the whole configuration. Field names are the keys of the
+// configuration file.
+type Config struct {
+	Server      Server      `json:"server"`
+	Database    Database    `json:"database"`
+	Packs       Packs       `json:"packs"`
+	Solver      Solver      `json:"solver"`
+	Auth        Auth        `json:"auth"`
+	RateLimit   RateLimit   `json:"rate_limit"`
+	Log         Log         `json:"log"`
+	Tracing     Tracing     `json:"tracing"`
+	Persistence Persistence `json:"persistence"`
+}
+
+// Server configures the HTTP server and its lifecycle.
+type Server struct {
+	Port              int      `json:"port"`
+	ReadTimeout       Duration `json:"read_timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	WriteTimeout      Duration `json:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout"`
+	ReadyTimeout      Duration `json:"ready_timeout"`    // database checks of /readyz
+	ShutdownDelay     Duration `json:"shutdown_delay"`   // /readyz fails this long before the listener closes
+	ShutdownTimeout   Duration `json:"shutdown_timeout"` // for in-flight requests to finish
+	CORSOrigins       []string `json:"cors_origins"`
+}
+
+// Database configures the store: Postgres, whose connection and pool are
+// set here, or SQLite. Zero pool values keep the database/sql defaults.
+type Database struct {
+	// Store is "postgres", or "sqlite://PATH" for the SQLite database file
+	// at PATH, e.g. sqlite:///var/lib/packcalc.db.
+	Store           string   `json:"store"`
+	URL             string   `json:"url"`
+	MaxOpenConns    int      `json:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+	ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+	// AllowFallback serves from an in-memory store when Postgres is
+	// unavailable instead of exiting. For development only: the store has
+	// no API keys, so only auth.disabled makes its API usable.
+	AllowFallback bool `json:"allow_fallback"`
+}
+
+// SQLitePath returns the database file of a SQLite store, ok is false for
+// Postgres.
+func (d Database) SQLitePath() (path string, ok bool) {
+	return strings.CutPrefix(d.Store, "sqlite://")
+}
+
+// Packs configures the pack sets the service accepts.
+type Packs struct {
+	Default  []int `json:"default"` // pack sizes of the in-memory store
+	MinSize  int   `json:"min_size"`
+	MaxSize  int   `json:"max_size"`
+	MaxCount int   `json:"max_count"`
+}
+
+// Solver configures how calculations run.
+type Solver struct {
+	// BatchWorkers is how many orders of a batch are calculated at once,
+	// 0 for one per CPU.
+	BatchWorkers int `json:"batch_workers"`
+	// MaxItems is the largest order accepted.
+	MaxItems int `json:"max_items"`
+	// MaxTarget is the largest order accepted with stock limits or a cost
+	// objective, whose solvers need memory proportional to the order.
+	MaxTarget int `json:"max_target"`
+}
+
+// Auth configures API key authentication.
+type Auth struct {
+	Disabled bool `json:"disabled"`
+}
+
+// RateLimit configures per-client rate limiting. Limits are written
+// "RATE:BURST"; Default "off" turns rate limiting off.
+type RateLimit struct {
+	Default    string            `json:"default"`
+	Clients    map[string]string `json:"clients"` // by API key name or IP
+	CostUnit   int               `json:"cost_unit"`
+	TrustProxy bool              `json:"trust_proxy"`
+}
+
+// ParseRateLimit parses a limit written "RATE:BURST", e.g. "10:20": rate
+// tokens per second, burst tokens at most.
+func ParseRateLimit(v string) (rate float64, burst int, err error) {
+	r, b, ok := strings.Cut(v, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate limit %q: want RATE:BURST", v)
+	}
+	rate, err = strconv.ParseFloat(r, 64)
+	if err != nil || rate < 0 {
+		return 0, 0, fmt.Errorf("rate limit %q: rate must be a non-negative number", v)
+	}
+	burst, err = strconv.Atoi(b)
+	if err != nil || burst < 1 {
+		return 0, 0, fmt.Errorf("rate limit %q: burst must be a positive integer", v)
+	}
+	return rate, burst, nil
+}
+
+// Log configures the logs written to standard output.
+type Log struct {
+	Level  string `json:"level"`  // debug, info, warn or error
+	Format string `json:"format"` // json or text
+}
+
+// Handler returns the slog handler writing logs to w at the level and in
+// the format of l. l must be valid.
+func (l Log) Handler(w io.Writer) slog.Handler {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(l.Level))
+	opts := &slog.HandlerOptions{Level: level}
+	if l.Format == "text" {
+		return slog.NewTextHandler(w, opts)
+	}
+	return slog.NewJSONHandler(w, opts)
+}
+
+// Exporters accepted in Tracing.Exporter.
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// Tracing configures where OpenTelemetry spans are exported.
+type Tracing struct {
+	Exporter    string  `json:"exporter"` // none, stdout or file
+	File        string  `json:"file"`
+	SampleRatio float64 `json:"sample_ratio"` // of new traces, from 0 to 1
+}
+
+// Persistence policies accepted in Persistence.Policy.
+const (
+	PersistStrict     = "strict"
+	PersistBestEffort = "best-effort"
+	PersistAsync      = "async"
+)
+
+// Persistence configures how calculation results are saved: strict fails
+// the request when saving fails, best-effort answers anyway and async saves
+// in the background.
+type Persistence struct {
+	Policy         string   `json:"policy"`
+	QueueSize      int      `json:"queue_size"`
+	MaxAttempts    int      `json:"max_attempts"`
+	Backoff        Duration `json:"backoff"` // before the first retry, doubling each retry
+	MaxBackoff     Duration `json:"max_backoff"`
+	DeadLetterFile string   `json:"dead_letter_file"`
+	FlushTimeout   Duration `json:"flush_timeout"` // for queued results on shutdown
+}
+
+// Duration is a time.Duration written like "5s" in files and flags.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// MarshalText writes d like "1m30s".
+func (d Duration) MarshalText() ([]byte, error) { return []byte(d.String()), nil }
+
+// UnmarshalText reads a duration like "1m30s".
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q, want e.g. 5s or 1m30s", b)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Default returns the configuration used when nothing overrides it. The
+// limits and persistence settings are the defaults of the packages they
+// configure.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:              8080,
+			ReadTimeout:       Duration(5 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(20 * time.Second),
+			IdleTimeout:       Duration(60 * time.Second),
+			ReadyTimeout:      Duration(2 * time.Second),
+			ShutdownDelay:     Duration(5 * time.Second),
+			ShutdownTimeout:   Duration(15 * time.Second),
+			CORSOrigins:       []string{"*"},
+		},
+		Database: Database{Store: "postgres"},
+		Packs: Packs{
+			Default:  []int{250, 500, 1000, 2000, 5000},
+			MinSize:  1,
+			MaxSize:  1_000_000,
+			MaxCount: 50,
+		},
+		Solver:    Solver{MaxItems: 1_000_000_000, MaxTarget: 1_000_000},
+		RateLimit: RateLimit{Default: "10:20", CostUnit: 100_000},
+		Log:       Log{Level: "info", Format: "json"},
+		Tracing:   Tracing{Exporter: ExporterNone, SampleRatio: 1},
+		Persistence: Persistence{
+			Policy:       PersistStrict,
+			QueueSize:    1000,
+			MaxAttempts:  5,
+			Backoff:      Duration(100 * time.Millisecond),
+			MaxBackoff:   Duration(5 * time.Second),
+			FlushTimeout: Duration(10 * time.Second),
+		},
+	}
+}
+
+// Validate returns every invalid setting, one per line, or nil.
+func (c Config) Validate() error {
+	var errs []error
+	bad := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		bad("server.port", "%d is not between 1 and 65535", c.Server.Port)
+	}
+	for _, d := range []struct {
+		key string
+		d   Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.read_header_timeout", c.Server.ReadHeaderTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_delay", c.Server.ShutdownDelay},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"database.conn_max_lifetime", c.Database.ConnMaxLifetime},
+		{"database.conn_max_idle_time", c.Database.ConnMaxIdleTime},
+	} {
+		if d.d < 0 {
+			bad(d.key, "%s must not be negative", d.d)
+		}
+	}
+	if c.Server.ReadyTimeout <= 0 {
+		bad("server.ready_timeout", "%s must be positive", c.Server.ReadyTimeout)
+	}
+	if len(c.Server.CORSOrigins) == 0 {
+		bad("server.cors_origins", "at least one origin required, \"*\" allows any")
+	}
+
+	if c.Database.MaxOpenConns < 0 {
+		bad("database.max_open_conns", "%d must not be negative", c.Database.MaxOpenConns)
+	}
+	if c.Database.MaxIdleConns < 0 {
+		bad("database.max_idle_conns", "%d must not be negative", c.Database.MaxIdleConns)
+	}
+	path, sqlite := c.Database.SQLitePath()
+	switch {
+	case sqlite && path == "":
+		bad("database.store", "sqlite:// needs a file path, e.g. sqlite:///var/lib/packcalc.db")
+	case !sqlite && c.Database.Store != "postgres":
+		bad("database.store", "%q is not postgres or sqlite://PATH", c.Database.Store)
+	case !sqlite && c.Database.URL == "" && !c.Database.AllowFallback:
+		bad("database.url", "required unless database.allow_fallback is true")
+	}
+
+	if c.Packs.MinSize < 1 {
+		bad("packs.min_size", "%d must be at least 1", c.Packs.MinSize)
+	}
+	if c.Packs.MaxSize < c.Packs.MinSize {
+		bad("packs.max_size", "%d is below packs.min_size %d", c.Packs.MaxSize, c.Packs.MinSize)
+	}
+	if c.Packs.MaxCount < 1 {
+		bad("packs.max_count", "%d must be at least 1", c.Packs.MaxCount)
+	}
+	if c.Database.AllowFallback {
+		c.Packs.validateDefault(bad)
+	}
+	if c.Solver.BatchWorkers < 0 {
+		bad("solver.batch_workers", "%d must not be negative", c.Solver.BatchWorkers)
+	}
+	if c.Solver.MaxItems < 1 {
+		bad("solver.max_items", "%d must be at least 1", c.Solver.MaxItems)
+	}
+	if c.Solver.MaxTarget < 1 {
+		bad("solver.max_target", "%d must be at least 1", c.Solver.MaxTarget)
+	} else if c.Solver.MaxTarget > c.Solver.MaxItems {
+		bad("solver.max_target", "%d is above solver.max_items %d", c.Solver.MaxTarget, c.Solver.MaxItems)
+	}
+
+	if c.RateLimit.Default != "off" {
+		if _, _, err := ParseRateLimit(c.RateLimit.Default); err != nil {
+			bad("rate_limit.default", "%v, or off", err)
+		}
+	}
+	clients := make([]string, 0, len(c.RateLimit.Clients))
+	for client := range c.RateLimit.Clients {
+		clients = append(clients, client)
+	}
+	sort.Strings(clients)
+	for _, client := range clients {
+		if _, _, err := ParseRateLimit(c.RateLimit.Clients[client]); err != nil {
+			bad("rate_limit.clients."+client, "%v", err)
+		}
+	}
+	if c.RateLimit.CostUnit < 0 {
+		bad("rate_limit.cost_unit", "%d must not be negative", c.RateLimit.CostUnit)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		bad("log.level", "%q is not debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != "json" && c.Log.Format != "text" {
+		bad("log.format", "%q is not json or text", c.Log.Format)
+	}
+
+	switch c.Tracing.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterFile:
+		if c.Tracing.File == "" {
+			bad("tracing.file", "required by the file exporter")
+		}
+	default:
+		bad("tracing.exporter", "%q is not none, stdout or file", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		bad("tracing.sample_ratio", "%g is not between 0 and 1", c.Tracing.SampleRatio)
+	}
+
+	switch c.Persistence.Policy {
+	case PersistStrict, PersistBestEffort, PersistAsync:
+	default:
+		bad("persistence.policy", "%q is not strict, best-effort or async", c.Persistence.Policy)
+	}
+	if c.Persistence.QueueSize < 1 {
+		bad("persistence.queue_size", "%d must be at least 1", c.Persistence.QueueSize)
+	}
+	if c.Persistence.MaxAttempts < 1 {
+		bad("persistence.max_attempts", "%d must be at least 1", c.Persistence.MaxAttempts)
+	}
+	if c.Persistence.Backoff <= 0 {
+		bad("persistence.backoff", "%s must be positive", c.Persistence.Backoff)
+	}
+	if c.Persistence.MaxBackoff < c.Persistence.Backoff {
+		bad("persistence.max_backoff", "%s is below persistence.backoff %s", c.Persistence.MaxBackoff, c.Persistence.Backoff)
+	}
+	if c.Persistence.FlushTimeout < 0 {
+		bad("persistence.flush_timeout", "%s must not be negative", c.Persistence.FlushTimeout)
+	}
+	return errors.Join(errs...)
+}
+
+// validateDefault reports the default pack sizes outside the limits of p,
+// with the rules the service applies to stored pack sets.
+func (p Packs) validateDefault(bad func(key, format string, args ...any)) {
+	if len(p.Default) == 0 {
+		bad("packs.default", "at least one size required by database.allow_fallback")
+	}
+	distinct := map[int]bool{}
+	for _, size := range p.Default {
+		if size < p.MinSize || size > p.MaxSize {
+			bad("packs.default", "size %d is not between packs.min_size %d and packs.max_size %d", size, p.MinSize, p.MaxSize)
+		}
+		distinct[size] = true
+	}
+	if len(distinct) > p.MaxCount {
+		bad("packs.default", "%d distinct sizes, at most packs.max_count %d", len(distinct), p.MaxCount)
+	}
+}
+
+// dsnPassword matches the password of a libpq key/value DSN, quoted or not.
+var dsnPassword = regexp.MustCompile(`(\bpassword\s*=\s*)('(?:[^'\\]|\\.)*'|[^\s']\S*)`)
+
+// Redacted returns c with the password of the database URL masked, for
+// printing. Both URLs and libpq key/value DSNs are masked.
+func (c Config) Redacted() Config {
+	u, err := url.Parse(c.Database.URL)
+	if err != nil || u.Scheme == "" {
+		c.Database.URL = dsnPassword.ReplaceAllString(c.Database.URL, "${1}xxxxx")
+		return c
+	}
+	masked := false
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+			masked = true
+		}
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", "xxxxx")
+		u.RawQuery = q.Encode()
+		masked = true
+	}
+	if masked {
+		c.Database.URL = u.String()
+	}
+	return c
+}
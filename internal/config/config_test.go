@@ -0,0 +1,185 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/api"
+	"github.com/svvictorelias/shipping-pack-backend/internal/service"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+)
+
+func TestDefault_Valid(t *testing.T) {
+	c := Default()
+	// the in-memory fallback is opt-in, so only the database is missing
+	if err := c.Validate(); err == nil || err.Error() != "database.url: required unless database.allow_fallback is true" {
+		t.Fatalf("expected only database.url to be required got %v", err)
+	}
+	c.Database.URL = "postgres://localhost/packcalc"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("defaults are invalid: %v", err)
+	}
+
+	// config imports none of the packages it configures, so keep its
+	// defaults in step with theirs here
+	pl := service.DefaultPackLimits
+	if c.Packs.MinSize != pl.MinSize || c.Packs.MaxSize != pl.MaxSize || c.Packs.MaxCount != pl.MaxPacks {
+		t.Fatalf("expected service default pack limits %+v got %+v", pl, c.Packs)
+	}
+	if sl := service.DefaultSolverLimits; c.Solver.MaxItems != sl.MaxItems || c.Solver.MaxTarget != sl.MaxTarget {
+		t.Fatalf("expected service default solver limits %+v got %+v", sl, c.Solver)
+	}
+	p := service.DefaultPersistence
+	if c.Persistence.Policy != p.Policy || c.Persistence.QueueSize != p.QueueSize || c.Persistence.MaxAttempts != p.MaxAttempts ||
+		time.Duration(c.Persistence.Backoff) != p.Backoff || time.Duration(c.Persistence.MaxBackoff) != p.MaxBackoff {
+		t.Fatalf("expected service default persistence %+v got %+v", p, c.Persistence)
+	}
+	rate, burst, err := ParseRateLimit(c.RateLimit.Default)
+	rl := api.DefaultRateLimits
+	if err != nil || rate != rl.Default.Rate || burst != rl.Default.Burst || c.RateLimit.CostUnit != rl.CostUnit {
+		t.Fatalf("expected api default rate limits %+v got %+v", rl, c.RateLimit)
+	}
+	if ExporterNone != tracing.ExporterNone || ExporterStdout != tracing.ExporterStdout || ExporterFile != tracing.ExporterFile {
+		t.Fatal("exporter names differ from tracing")
+	}
+	if PersistStrict != service.PersistStrict || PersistBestEffort != service.PersistBestEffort || PersistAsync != service.PersistAsync {
+		t.Fatal("persistence policies differ from service")
+	}
+}
+
+func TestValidate_ReportsEverything(t *testing.T) {
+	c := Default()
+	c.Server.Port = 70000
+	c.Server.WriteTimeout = Duration(-time.Second)
+	c.Database.AllowFallback = false
+	c.Packs.MinSize = 10
+	c.Packs.MaxSize = 5
+	c.RateLimit.Clients = map[string]string{"b": "1", "a": "x:1"}
+	c.Log.Format = "xml"
+	c.Tracing = Tracing{Exporter: "file", SampleRatio: 2}
+	c.Persistence.Policy = "later"
+	c.Persistence.MaxBackoff = Duration(time.Millisecond)
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	want := []string{
+		"server.port: 70000 is not between 1 and 65535",
+		"server.write_timeout: -1s must not be negative",
+		"database.url: required unless database.allow_fallback is true",
+		"packs.max_size: 5 is below packs.min_size 10",
+		`rate_limit.clients.a: rate limit "x:1": rate must be a non-negative number`,
+		`rate_limit.clients.b: rate limit "1": want RATE:BURST`,
+		`log.format: "xml" is not json or text`,
+		"tracing.file: required by the file exporter",
+		"tracing.sample_ratio: 2 is not between 0 and 1",
+		`persistence.policy: "later" is not strict, best-effort or async`,
+		"persistence.max_backoff: 1ms is below persistence.backoff 100ms",
+	}
+	if got := err.Error(); got != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s\nwant\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestValidate_DefaultPacksOnlyWithFallback(t *testing.T) {
+	c := Default()
+	c.Database.AllowFallback = true
+	c.Packs.Default = []int{0}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "packs.default") {
+		t.Fatalf("expected packs.default error got %v", err)
+	}
+	c.Database.AllowFallback = false
+	c.Database.URL = "postgres://localhost/packcalc"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("default packs are unused without fallback, got %v", err)
+	}
+}
+
+func TestValidate_Store(t *testing.T) {
+	c := Default()
+	c.Database.AllowFallback = false
+	c.Database.Store = "sqlite:///var/lib/packcalc.db"
+	if err := c.Validate(); err != nil {
+		t.Fatalf("SQLite needs no database.url, got %v", err)
+	}
+	if path, ok := c.Database.SQLitePath(); !ok || path != "/var/lib/packcalc.db" {
+		t.Fatalf("unexpected SQLite path %q %v", path, ok)
+	}
+
+	for _, store := range []string{"sqlite://", "mysql://localhost"} {
+		c.Database.Store = store
+		if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "database.store") {
+			t.Errorf("%s: expected database.store error got %v", store, err)
+		}
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	if rate, burst, err := ParseRateLimit("2.5:10"); err != nil || rate != 2.5 || burst != 10 {
+		t.Fatalf("unexpected %g %d %v", rate, burst, err)
+	}
+	for _, v := range []string{"10", "x:1", "1:0", "-1:5"} {
+		if _, _, err := ParseRateLimit(v); err == nil {
+			t.Errorf("expected %q rejected", v)
+		}
+	}
+}
+
+func TestValidate_Solver(t *testing.T) {
+	c := Default()
+	c.Database.URL = "postgres://localhost/packcalc"
+	c.Solver.MaxTarget = c.Solver.MaxItems + 1
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "solver.max_target") {
+		t.Fatalf("expected solver.max_target error got %v", err)
+	}
+	c.Solver.MaxItems = 0
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "solver.max_items: 0 must be at least 1") {
+		t.Fatalf("expected solver.max_items error got %v", err)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Database.URL = "postgres://app:s3cret@db:5432/packcalc?sslmode=disable"
+	if got := c.Redacted().Database.URL; strings.Contains(got, "s3cret") || !strings.Contains(got, "app:xxxxx@db:5432") {
+		t.Fatalf("password not masked: %s", got)
+	}
+	if c.Database.URL != "postgres://app:s3cret@db:5432/packcalc?sslmode=disable" {
+		t.Fatal("Redacted modified its receiver")
+	}
+
+	for dsn, want := range map[string]string{
+		"host=db user=app password=s3cret dbname=packcalc":       "host=db user=app password=xxxxx dbname=packcalc",
+		"host=db password = 's3 c\\'ret' dbname=packcalc":        "host=db password = xxxxx dbname=packcalc",
+		"postgres://db/packcalc?password=s3cret&sslmode=disable": "postgres://db/packcalc?password=xxxxx&sslmode=disable",
+		"host=db user=app dbname=packcalc":                       "host=db user=app dbname=packcalc",
+	} {
+		c.Database.URL = dsn
+		if got := c.Redacted().Database.URL; got != want {
+			t.Errorf("Redacted(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := Log{Level: "warn", Format: "json"}.Handler(&buf)
+	if h.Enabled(context.Background(), slog.LevelInfo) || !h.Enabled(context.Background(), slog.LevelWarn) {
+		t.Fatal("expected warn level")
+	}
+	slog.New(h).Warn("slow", "ms", 12)
+	if !strings.HasPrefix(buf.String(), `{"time":`) || !strings.Contains(buf.String(), `"msg":"slow","ms":12`) {
+		t.Fatalf("expected a JSON line got %s", buf.String())
+	}
+
+	buf.Reset()
+	slog.New(Log{Level: "debug", Format: "text"}.Handler(&buf)).Debug("slow", "ms", 12)
+	if !strings.Contains(buf.String(), "level=DEBUG msg=slow ms=12") {
+		t.Fatalf("expected a text line got %s", buf.String())
+	}
+}
@@ -0,0 +1,338 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the configuration file
+// when -config is not given.
+const FileEnv = "PACKCALC_CONFIG"
+
+// Options are the command line settings that are not configuration.
+type Options struct {
+	File        string // configuration file read, if any
+	PrintConfig bool   // print the effective configuration and exit
+}
+
+// field is one setting, known by its file key, which is also its flag
+// name, and its environment variable.
+type field struct {
+	key   string
+	env   string
+	usage string
+	value func(c *Config) flag.Value
+}
+
+var fields = []field{
+	{"server.port", "PORT", "port to listen on", func(c *Config) flag.Value { return (*intValue)(&c.Server.Port) }},
+	{"server.read_timeout", "HTTP_READ_TIMEOUT", "time to read a whole request", func(c *Config) flag.Value { return &c.Server.ReadTimeout }},
+	{"server.read_header_timeout", "HTTP_READ_HEADER_TIMEOUT", "time to read request headers", func(c *Config) flag.Value { return &c.Server.ReadHeaderTimeout }},
+	{"server.write_timeout", "HTTP_WRITE_TIMEOUT", "time to write a response", func(c *Config) flag.Value { return &c.Server.WriteTimeout }},
+	{"server.idle_timeout", "HTTP_IDLE_TIMEOUT", "time a keep-alive connection stays idle", func(c *Config) flag.Value { return &c.Server.IdleTimeout }},
+	{"server.ready_timeout", "READY_TIMEOUT", "time /readyz waits for the database", func(c *Config) flag.Value { return &c.Server.ReadyTimeout }},
+	{"server.shutdown_delay", "SHUTDOWN_DELAY", "time /readyz fails before the listener closes", func(c *Config) flag.Value { return &c.Server.ShutdownDelay }},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time in-flight requests get to finish on shutdown", func(c *Config) flag.Value { return &c.Server.ShutdownTimeout }},
+	{"server.cors_origins", "CORS_ORIGINS", "comma separated allowed CORS origins", func(c *Config) flag.Value { return (*stringsValue)(&c.Server.CORSOrigins) }},
+	{"database.store", "STORE", "postgres, or sqlite://PATH for a SQLite database file", func(c *Config) flag.Value { return (*stringValue)(&c.Database.Store) }},
+	{"database.url", "DATABASE_URL", "Postgres connection URL", func(c *Config) flag.Value { return (*stringValue)(&c.Database.URL) }},
+	{"database.max_open_conns", "DB_MAX_OPEN_CONNS", "most open connections, 0 for no limit", func(c *Config) flag.Value { return (*intValue)(&c.Database.MaxOpenConns) }},
+	{"database.max_idle_conns", "DB_MAX_IDLE_CONNS", "most idle connections, 0 for the database/sql default", func(c *Config) flag.Value { return (*intValue)(&c.Database.MaxIdleConns) }},
+	{"database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME", "longest a connection is reused, 0 for ever", func(c *Config) flag.Value { return &c.Database.ConnMaxLifetime }},
+	{"database.conn_max_idle_time", "DB_CONN_MAX_IDLE_TIME", "longest a connection stays idle, 0 for ever", func(c *Config) flag.Value { return &c.Database.ConnMaxIdleTime }},
+	{"database.allow_fallback", "DB_ALLOW_FALLBACK", "serve from memory when the database is unavailable", func(c *Config) flag.Value { return (*boolValue)(&c.Database.AllowFallback) }},
+	{"packs.default", "DEFAULT_PACKS", "comma separated pack sizes of the in-memory store", func(c *Config) flag.Value { return (*intsValue)(&c.Packs.Default) }},
+	{"packs.min_size", "PACK_MIN_SIZE", "smallest accepted pack size", func(c *Config) flag.Value { return (*intValue)(&c.Packs.MinSize) }},
+	{"packs.max_size", "PACK_MAX_SIZE", "largest accepted pack size", func(c *Config) flag.Value { return (*intValue)(&c.Packs.MaxSize) }},
+	{"packs.max_count", "PACK_MAX_COUNT", "most distinct sizes in a pack set", func(c *Config) flag.Value { return (*intValue)(&c.Packs.MaxCount) }},
+	{"solver.batch_workers", "BATCH_WORKERS", "orders of a batch calculated at once, 0 for one per CPU", func(c *Config) flag.Value { return (*intValue)(&c.Solver.BatchWorkers) }},
+	{"solver.max_items", "SOLVER_MAX_ITEMS", "largest order accepted", func(c *Config) flag.Value { return (*intValue)(&c.Solver.MaxItems) }},
+	{"solver.max_target", "SOLVER_MAX_TARGET", "largest order with stock limits or a cost objective", func(c *Config) flag.Value { return (*intValue)(&c.Solver.MaxTarget) }},
+	{"auth.disabled", "AUTH_DISABLED", "turn API key authentication off", func(c *Config) flag.Value { return (*boolValue)(&c.Auth.Disabled) }},
+	{"rate_limit.default", "RATE_LIMIT", "RATE:BURST per client, or off", func(c *Config) flag.Value { return (*stringValue)(&c.RateLimit.Default) }},
+	{"rate_limit.clients", "RATE_LIMIT_CLIENTS", "client=RATE:BURST,... by API key name or IP", func(c *Config) flag.Value { return (*clientsValue)(&c.RateLimit.Clients) }},
+	{"rate_limit.cost_unit", "RATE_LIMIT_COST_UNIT", "items, divided by the GCD, per extra token", func(c *Config) flag.Value { return (*intValue)(&c.RateLimit.CostUnit) }},
+	{"rate_limit.trust_proxy", "TRUST_PROXY", "take the client IP from X-Forwarded-For", func(c *Config) flag.Value { return (*boolValue)(&c.RateLimit.TrustProxy) }},
+	{"log.level", "LOG_LEVEL", "debug, info, warn or error", func(c *Config) flag.Value { return (*stringValue)(&c.Log.Level) }},
+	{"log.format", "LOG_FORMAT", "json or text", func(c *Config) flag.Value { return (*stringValue)(&c.Log.Format) }},
+	{"tracing.exporter", "TRACING_EXPORTER", "none, stdout or file", func(c *Config) flag.Value { return (*stringValue)(&c.Tracing.Exporter) }},
+	{"tracing.file", "TRACING_FILE", "file spans are appended to by the file exporter", func(c *Config) flag.Value { return (*stringValue)(&c.Tracing.File) }},
+	{"tracing.sample_ratio", "TRACING_SAMPLE_RATIO", "share of new traces recorded, from 0 to 1", func(c *Config) flag.Value { return (*floatValue)(&c.Tracing.SampleRatio) }},
+	{"persistence.policy", "PERSIST_POLICY", "strict, best-effort or async", func(c *Config) flag.Value { return (*stringValue)(&c.Persistence.Policy) }},
+	{"persistence.queue_size", "PERSIST_QUEUE_SIZE", "results waiting to be saved in async mode", func(c *Config) flag.Value { return (*intValue)(&c.Persistence.QueueSize) }},
+	{"persistence.max_attempts", "PERSIST_MAX_ATTEMPTS", "saves tried per result in async mode", func(c *Config) flag.Value { return (*intValue)(&c.Persistence.MaxAttempts) }},
+	{"persistence.backoff", "PERSIST_BACKOFF", "time before the first retry, doubling each retry", func(c *Config) flag.Value { return &c.Persistence.Backoff }},
+	{"persistence.max_backoff", "PERSIST_MAX_BACKOFF", "longest time between retries", func(c *Config) flag.Value { return &c.Persistence.MaxBackoff }},
+	{"persistence.dead_letter_file", "PERSIST_DEAD_LETTER_FILE", "file results that could not be saved are appended to", func(c *Config) flag.Value { return (*stringValue)(&c.Persistence.DeadLetterFile) }},
+	{"persistence.flush_timeout", "PERSIST_FLUSH_TIMEOUT", "time queued results get to be saved on shutdown", func(c *Config) flag.Value { return &c.Persistence.FlushTimeout }},
+}
+
+// Load returns the configuration made of the defaults, then the file given
+// by -config or $PACKCALC_CONFIG, then the environment read with getenv,
+// then the flags in args. The result is validated. -h returns
+// flag.ErrHelp after printing the usage to stderr.
+func Load(args []string, getenv func(string) string) (Config, Options, error) {
+	var opts Options
+	// flags are applied last but parsed first, for -config
+	type set struct {
+		f     field
+		value string
+	}
+	var flags []set
+	fs := flag.NewFlagSet("packcalc", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", "", "YAML, TOML or JSON configuration file (env "+FileEnv+")")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration and exit")
+	for _, f := range fields {
+		scratch := Default() // shown as the flag default
+		fs.Var(&deferredValue{Value: f.value(&scratch), record: func(v string) {
+			flags = append(flags, set{f, v})
+		}}, f.key, f.usage+" (env "+f.env+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, opts, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, opts, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	cfg := Default()
+	if opts.File == "" {
+		opts.File = getenv(FileEnv)
+	}
+	if opts.File != "" {
+		if err := readFile(&cfg, opts.File); err != nil {
+			return Config{}, opts, err
+		}
+	}
+	for _, f := range fields {
+		v := getenv(f.env)
+		if v == "" {
+			continue
+		}
+		if err := f.value(&cfg).Set(v); err != nil {
+			return Config{}, opts, fmt.Errorf("%s: %w", f.env, err)
+		}
+	}
+	for _, s := range flags {
+		// already checked by fs.Parse
+		_ = s.f.value(&cfg).Set(s.value)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, opts, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, opts, nil
+}
+
+// readFile decodes the file at path over cfg. The format follows the
+// extension; unknown keys are errors so typos do not go unnoticed.
+func readFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	// YAML and TOML are decoded generically and re-encoded as JSON, so
+	// the json tags are the only ones to keep in sync
+	var raw any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		raw = json.RawMessage(data)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		var m map[string]any
+		_, err = toml.Decode(string(data), &m)
+		raw = m
+	default:
+		return fmt.Errorf("config file %s: unknown format %q, want .yaml, .yml, .toml or .json", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	if raw == nil {
+		return nil // empty file
+	}
+	data, err = json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, jsonError(err))
+	}
+	return nil
+}
+
+// jsonError rewords decoding errors in terms of the configuration keys.
+func jsonError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("%s: %s is not a valid %s", typeErr.Field, typeErr.Value, typeErr.Type)
+	}
+	return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+}
+
+// Print writes c, with secrets masked, as JSON, which Load accepts as a
+// configuration file.
+func Print(w io.Writer, c Config) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c.Redacted())
+}
+
+// Usage writes the environment variable of every setting, for help texts.
+func Usage(w io.Writer) {
+	fmt.Fprintf(w, "environment:\n  %-26s %s\n", FileEnv, "configuration file")
+	for _, f := range fields {
+		fmt.Fprintf(w, "  %-26s %s\n", f.env, f.key)
+	}
+}
+
+// deferredValue checks a flag when it is parsed and records it to be
+// applied after the file and environment layers.
+type deferredValue struct {
+	flag.Value
+	record func(string)
+}
+
+func (d *deferredValue) String() string {
+	if d.Value == nil {
+		return ""
+	}
+	return d.Value.String()
+}
+
+func (d *deferredValue) Set(v string) error {
+	if err := d.Value.Set(v); err != nil {
+		return err
+	}
+	d.record(v)
+	return nil
+}
+
+func (d *deferredValue) IsBoolFlag() bool {
+	b, ok := d.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// Set parses a duration like "1m30s", for flags and the environment.
+func (d *Duration) Set(v string) error { return d.UnmarshalText([]byte(v)) }
+
+type intValue int
+
+func (i *intValue) String() string { return strconv.Itoa(int(*i)) }
+func (i *intValue) Set(v string) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid integer %q", v)
+	}
+	*i = intValue(n)
+	return nil
+}
+
+type floatValue float64
+
+func (f *floatValue) String() string { return strconv.FormatFloat(float64(*f), 'g', -1, 64) }
+func (f *floatValue) Set(v string) error {
+	x, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("invalid number %q", v)
+	}
+	*f = floatValue(x)
+	return nil
+}
+
+type boolValue bool
+
+func (b *boolValue) String() string   { return strconv.FormatBool(bool(*b)) }
+func (b *boolValue) IsBoolFlag() bool { return true }
+func (b *boolValue) Set(v string) error {
+	x, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid boolean %q, want true or false", v)
+	}
+	*b = boolValue(x)
+	return nil
+}
+
+type stringValue string
+
+func (s *stringValue) String() string     { return string(*s) }
+func (s *stringValue) Set(v string) error { *s = stringValue(v); return nil }
+
+// stringsValue is a comma separated list.
+type stringsValue []string
+
+func (s *stringsValue) String() string { return strings.Join(*s, ",") }
+func (s *stringsValue) Set(v string) error {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	*s = out
+	return nil
+}
+
+// intsValue is a comma separated list of integers.
+type intsValue []int
+
+func (s *intsValue) String() string {
+	items := make([]string, len(*s))
+	for i, n := range *s {
+		items[i] = strconv.Itoa(n)
+	}
+	return strings.Join(items, ",")
+}
+
+func (s *intsValue) Set(v string) error {
+	var out []int
+	for _, item := range strings.Split(v, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil {
+			return fmt.Errorf("invalid integer %q in list", item)
+		}
+		out = append(out, n)
+	}
+	*s = out
+	return nil
+}
+
+// clientsValue is a comma separated list of client=RATE:BURST.
+type clientsValue map[string]string
+
+func (m *clientsValue) String() string {
+	items := make([]string, 0, len(*m))
+	for client, limit := range *m {
+		items = append(items, client+"="+limit)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func (m *clientsValue) Set(v string) error {
+	out := make(clientsValue)
+	for _, entry := range strings.Split(v, ",") {
+		client, limit, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || client == "" {
+			return fmt.Errorf("%q: want client=RATE:BURST", entry)
+		}
+		out[client] = limit
+	}
+	*m = out
+	return nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns a getenv reading vars.
+func env(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+// dbEnv sets the one setting without a usable default.
+var dbEnv = map[string]string{"DATABASE_URL": "postgres://localhost/packcalc"}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, opts, err := Load(nil, env(dbEnv))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	want := Default()
+	want.Database.URL = dbEnv["DATABASE_URL"]
+	if !reflect.DeepEqual(cfg, want) || opts != (Options{}) {
+		t.Fatalf("expected defaults got %+v %+v", cfg, opts)
+	}
+}
+
+func TestLoad_Formats(t *testing.T) {
+	files := map[string]string{
+		"c.yaml": "server:\n  port: 9000\n  write_timeout: 30s\n  cors_origins: [https://shop.example]\npacks:\n  default: [10, 20]\nrate_limit:\n  clients:\n    checkout: \"100:200\"\n",
+		"c.toml": "[server]\nport = 9000\nwrite_timeout = \"30s\"\ncors_origins = [\"https://shop.example\"]\n[packs]\ndefault = [10, 20]\n[rate_limit.clients]\ncheckout = \"100:200\"\n",
+		"c.json": `{"server":{"port":9000,"write_timeout":"30s","cors_origins":["https://shop.example"]},"packs":{"default":[10,20]},"rate_limit":{"clients":{"checkout":"100:200"}}}`,
+	}
+	for name, content := range files {
+		cfg, _, err := Load([]string{"-config", writeFile(t, name, content)}, env(dbEnv))
+		if err != nil {
+			t.Fatalf("%s: Load error: %v", name, err)
+		}
+		if cfg.Server.Port != 9000 || cfg.Server.WriteTimeout != Duration(30*time.Second) ||
+			!reflect.DeepEqual(cfg.Server.CORSOrigins, []string{"https://shop.example"}) ||
+			!reflect.DeepEqual(cfg.Packs.Default, []int{10, 20}) || cfg.RateLimit.Clients["checkout"] != "100:200" {
+			t.Fatalf("%s: unexpected config %+v", name, cfg)
+		}
+		// keys the file leaves out keep their defaults
+		if cfg.Server.ReadTimeout != Default().Server.ReadTimeout || cfg.Packs.MaxCount != Default().Packs.MaxCount {
+			t.Fatalf("%s: defaults lost: %+v", name, cfg)
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "c.yaml", "server:\n  port: 9000\n  idle_timeout: 2m\npacks:\n  max_count: 10\n")
+	vars := map[string]string{
+		FileEnv:          path,
+		"PORT":           "9001",
+		"PACK_MAX_COUNT": "20",
+		"AUTH_DISABLED":  "true",
+		"DATABASE_URL":   dbEnv["DATABASE_URL"],
+	}
+	cfg, opts, err := Load([]string{"-server.port", "9002", "-auth.disabled=false"}, env(vars))
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if opts.File != path {
+		t.Fatalf("expected file from %s got %q", FileEnv, opts.File)
+	}
+	// flag over env over file over default
+	if cfg.Server.Port != 9002 || cfg.Packs.MaxCount != 20 || cfg.Server.IdleTimeout != Duration(2*time.Minute) || cfg.Auth.Disabled {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		vars map[string]string
+		want string
+	}{
+		{"bad env", nil, map[string]string{"PORT": "http"}, `PORT: invalid integer "http"`},
+		{"bad env duration", nil, map[string]string{"SHUTDOWN_DELAY": "5"}, `SHUTDOWN_DELAY: invalid duration "5"`},
+		{"bad env number", nil, map[string]string{"TRACING_SAMPLE_RATIO": "half"}, `TRACING_SAMPLE_RATIO: invalid number "half"`},
+		{"bad flag", []string{"-packs.default", "1,x"}, nil, `invalid integer "x" in list`},
+		{"unknown flag", []string{"-prot", "1"}, nil, "flag provided but not defined: -prot"},
+		{"unknown key", []string{"-config", writeFile(t, "c.yaml", "server:\n  prot: 1\n")}, nil, `unknown field "prot"`},
+		{"wrong type", []string{"-config", writeFile(t, "c.json", `{"server":{"port":"x"}}`)}, nil, "server.port: string is not a valid int"},
+		{"bad duration in file", []string{"-config", writeFile(t, "c.toml", "[server]\nread_timeout = \"soon\"\n")}, nil, `invalid duration "soon"`},
+		{"unknown format", []string{"-config", writeFile(t, "c.ini", "")}, nil, `unknown format ".ini"`},
+		{"missing file", []string{"-config", "/nonexistent/c.yaml"}, nil, "no such file"},
+		{"invalid", []string{"-database.allow_fallback=false"}, nil, "invalid configuration:\ndatabase.url: required"},
+	}
+	for _, tc := range cases {
+		_, _, err := Load(tc.args, env(tc.vars))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: expected error containing %q got %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestLoad_Help(t *testing.T) {
+	// the usage goes to stderr
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+	if _, _, err := Load([]string{"-h"}, env(nil)); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected flag.ErrHelp got %v", err)
+	}
+}
+
+func TestPrint_RoundTrip(t *testing.T) {
+	cfg := Default()
+	cfg.Database.URL = "postgres://app:s3cret@db/packcalc"
+	cfg.RateLimit.Clients = map[string]string{"checkout": "100:200"}
+	var b bytes.Buffer
+	if err := Print(&b, cfg); err != nil {
+		t.Fatalf("Print error: %v", err)
+	}
+	if strings.Contains(b.String(), "s3cret") {
+		t.Fatalf("password printed:\n%s", b.String())
+	}
+	// the printed configuration is a valid configuration file
+	got, _, err := Load([]string{"-config", writeFile(t, "printed.json", b.String())}, env(nil))
+	if err != nil {
+		t.Fatalf("Load of printed config: %v", err)
+	}
+	want := cfg.Redacted()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("round trip changed the config:\ngot  %+v\nwant %+v", got, want)
+	}
+}
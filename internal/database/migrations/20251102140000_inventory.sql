@@ -0,0 +1,6 @@
+-- Stock available per pack size; sizes without a row are unlimited
+CREATE TABLE IF NOT EXISTS inventory (
+    pack_size INTEGER PRIMARY KEY,
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    updated_at TIMESTAMP DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- Unit cost of each pack size (box price plus handling) for cost objectives
+ALTER TABLE packs ADD COLUMN IF NOT EXISTS cost NUMERIC(12,2) NOT NULL DEFAULT 0;
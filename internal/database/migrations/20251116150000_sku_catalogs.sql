@@ -0,0 +1,30 @@
+-- Per-SKU pack catalogs for multi-line orders
+
+CREATE TABLE IF NOT EXISTS skus (
+    id SERIAL PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS sku_packs (
+    id SERIAL PRIMARY KEY,
+    sku_id INTEGER NOT NULL REFERENCES skus(id) ON DELETE CASCADE,
+    size INTEGER NOT NULL,
+    UNIQUE (sku_id, size)
+);
+
+-- One row per order line; single-SKU calculations have none
+CREATE TABLE IF NOT EXISTS calculation_lines (
+    id SERIAL PRIMARY KEY,
+    calculation_id INTEGER NOT NULL REFERENCES calculations(id) ON DELETE CASCADE,
+    sku TEXT NOT NULL,
+    items INTEGER NOT NULL,
+    total_items INTEGER NOT NULL,
+    pack_count INTEGER NOT NULL
+);
+
+-- Pack items of an order line carry its SKU
+ALTER TABLE calculation_items ADD COLUMN IF NOT EXISTS sku TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_sku_packs_sku_id ON sku_packs(sku_id);
+CREATE INDEX IF NOT EXISTS idx_calculation_lines_calc_id ON calculation_lines(calculation_id);
@@ -0,0 +1,3 @@
+-- Indexes for the calculation history filters
+CREATE INDEX IF NOT EXISTS idx_calculations_created_at ON calculations(created_at);
+CREATE INDEX IF NOT EXISTS idx_calculations_items ON calculations(items);
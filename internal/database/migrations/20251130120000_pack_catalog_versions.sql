@@ -0,0 +1,34 @@
+-- Pack catalogs become immutable versions; every change of sizes or costs
+-- adds a version and moves the active pointer
+
+CREATE TABLE IF NOT EXISTS pack_catalog_versions (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS pack_catalog_sizes (
+    version_id INTEGER NOT NULL REFERENCES pack_catalog_versions(id) ON DELETE CASCADE,
+    size INTEGER NOT NULL,
+    cost NUMERIC(12,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (version_id, size)
+);
+
+-- Single row pointing at the version in use
+CREATE TABLE IF NOT EXISTS pack_catalog_active (
+    singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+    version_id INTEGER NOT NULL REFERENCES pack_catalog_versions(id)
+);
+
+-- The current packs become version 1
+INSERT INTO pack_catalog_versions(created_at) VALUES (NOW());
+INSERT INTO pack_catalog_sizes(version_id, size, cost)
+    SELECT (SELECT MAX(id) FROM pack_catalog_versions), size, cost FROM packs;
+INSERT INTO pack_catalog_active(version_id)
+    SELECT MAX(id) FROM pack_catalog_versions;
+
+DROP TABLE IF EXISTS packs;
+
+-- Catalog version a calculation was made with; NULL for multi-line orders
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS catalog_version INTEGER REFERENCES pack_catalog_versions(id);
+
+CREATE INDEX IF NOT EXISTS idx_calculations_catalog_version ON calculations(catalog_version);
@@ -0,0 +1,10 @@
+-- API keys; only the SHA-256 of the secret is stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL, -- comma separated
+    created_at TIMESTAMP DEFAULT NOW(),
+    revoked_at TIMESTAMP
+);
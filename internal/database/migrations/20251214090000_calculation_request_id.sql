@@ -0,0 +1,3 @@
+-- ID of the HTTP request that produced each calculation, to find it from logs
+ALTER TABLE calculations ADD COLUMN IF NOT EXISTS request_id TEXT;
+CREATE INDEX IF NOT EXISTS idx_calculations_request_id ON calculations(request_id);
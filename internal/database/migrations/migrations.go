@@ -0,0 +1,11 @@
+// Package migrations holds the schema migrations, one .sql file each,
+// written for Postgres. go-migrate applies them from this directory; Files
+// embeds them for the SQLite store, which rewrites them in package sqlite.
+package migrations
+
+import "embed"
+
+// Files holds every migration file of the directory.
+//
+//go:embed *.sql
+var Files embed.FS
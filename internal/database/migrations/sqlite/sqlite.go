@@ -0,0 +1,126 @@
+// Package sqlite runs the migrations of the SQLite store: the Postgres
+// migrations of the parent directory, rewritten for SQLite under the same
+// names. Run applies them and records them in the migrations table
+// go-migrate keeps for Postgres, so /readyz reads both the same way.
+package sqlite
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/database/migrations"
+)
+
+// rewrites turn the Postgres-only parts of the migrations into SQLite.
+var rewrites = strings.NewReplacer(
+	"SERIAL PRIMARY KEY", "INTEGER PRIMARY KEY AUTOINCREMENT",
+	"NOW()", "CURRENT_TIMESTAMP",
+	"ADD COLUMN IF NOT EXISTS", "ADD COLUMN",
+)
+
+// Migration is one migration, named like its file without ".sql".
+type Migration struct {
+	Name     string
+	Checksum string // hex SHA-256 of SQL
+	SQL      string // the file rewritten for SQLite
+}
+
+// Migrations returns every migration, oldest first.
+func Migrations() ([]Migration, error) {
+	names, err := fs.Glob(migrations.Files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	out := make([]Migration, 0, len(names))
+	for _, name := range names {
+		b, err := migrations.Files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		stmts := rewrites.Replace(string(b))
+		sum := sha256.Sum256([]byte(stmts))
+		out = append(out, Migration{
+			Name:     strings.TrimSuffix(name, ".sql"),
+			Checksum: hex.EncodeToString(sum[:]),
+			SQL:      stmts,
+		})
+	}
+	return out, nil
+}
+
+// Run applies the migrations db has not applied yet, each in its own
+// transaction. It fails when an applied migration was edited since.
+func Run(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS migrations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    checksum TEXT NOT NULL,
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`)
+	if err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	applied := map[string]string{}
+	rows, err := db.QueryContext(ctx, "SELECT name, checksum FROM migrations WHERE success")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name, checksum string
+		if err := rows.Scan(&name, &checksum); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[name] = checksum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	all, err := Migrations()
+	if err != nil {
+		return err
+	}
+	for _, m := range all {
+		if checksum, ok := applied[m.Name]; ok {
+			if checksum != m.Checksum {
+				return fmt.Errorf("checksums do not match for migration %s", m.Name)
+			}
+			continue
+		}
+		if err := apply(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, db *sql.DB, m Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO migrations(name, checksum, success) VALUES(?, ?, TRUE) ON CONFLICT (name) DO UPDATE SET checksum = excluded.checksum, success = TRUE, error = NULL",
+		m.Name, m.Checksum)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+package sqlite
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Every Postgres migration has a SQLite one of the same name, so both
+// stores report the same schema version.
+func TestMigrations_MatchPostgres(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no Postgres migrations: %v", err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	if len(migrations) != len(files) {
+		t.Fatalf("expected %d migrations got %d", len(files), len(migrations))
+	}
+	for i, f := range files {
+		name := strings.TrimSuffix(filepath.Base(f), ".sql")
+		if migrations[i].Name != name {
+			t.Errorf("migration %d: expected %s got %s", i, name, migrations[i].Name)
+		}
+		if migrations[i].Checksum == "" || migrations[i].SQL == "" {
+			t.Errorf("migration %s is empty", name)
+		}
+	}
+}
+
+// The rewrites leave none of the Postgres-only syntax SQLite rejects.
+func TestMigrations_Rewritten(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Migrations: %v", err)
+	}
+	for _, m := range migrations {
+		for _, pg := range []string{"SERIAL PRIMARY KEY", "NOW()", "ADD COLUMN IF NOT EXISTS"} {
+			if strings.Contains(m.SQL, pg) {
+				t.Errorf("migration %s still has %q", m.Name, pg)
+			}
+		}
+	}
+}
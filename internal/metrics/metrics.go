@@ -0,0 +1,251 @@
+// Package metrics implements counters, gauges and histograms exposed in
+// the Prometheus text format, without depending on a Prometheus client.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are latency buckets in seconds, from 1ms to 10s.
+var DefBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the packages of this module register on and
+// that /metrics serves.
+var Default = NewRegistry()
+
+// Registry holds metrics in registration order.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*family
+	names   map[string]bool
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// family is one metric name and its series, one per set of label values.
+type family struct {
+	name, help, typ string
+	labels          []string
+	buckets         []float64 // histograms only
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+
+	mu     sync.Mutex
+	value  float64  // counter and gauge
+	counts []uint64 // histogram, per bucket, not cumulative
+	sum    float64  // histogram
+	count  uint64   // histogram
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name] {
+		panic("metrics: duplicate metric " + f.name)
+	}
+	r.names[f.name] = true
+	f.series = make(map[string]*series)
+	r.metrics = append(r.metrics, f)
+	return f
+}
+
+// with returns the series of values, creating it on first use.
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.series[key]
+	if s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		if f.typ == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterVec is a counter per set of label values.
+type CounterVec struct{ f *family }
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, typ: "counter", labels: labels})}
+}
+
+// Inc adds one to the counter of values.
+func (c *CounterVec) Inc(values ...string) { c.Add(1, values...) }
+
+// Add adds v, which must not be negative, to the counter of values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	s := c.f.with(values)
+	s.mu.Lock()
+	s.value += v
+	s.mu.Unlock()
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ s *series }
+
+// NewGauge registers a gauge without labels.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	f := r.register(&family{name: name, help: help, typ: "gauge"})
+	return &Gauge{f.with(nil)}
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.s.mu.Lock()
+	g.s.value = v
+	g.s.mu.Unlock()
+}
+
+// Add adds v, possibly negative, to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.s.mu.Lock()
+	g.s.value += v
+	g.s.mu.Unlock()
+}
+
+// HistogramVec is a histogram per set of label values.
+type HistogramVec struct{ f *family }
+
+// NewHistogramVec registers a histogram with the given upper bounds, sorted
+// ascending, and label names. +Inf is implied.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	b := append([]float64(nil), buckets...)
+	sort.Float64s(b)
+	return &HistogramVec{r.register(&family{name: name, help: help, typ: "histogram", labels: labels, buckets: b})}
+}
+
+// Observe records v in the histogram of values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	s := h.f.with(values)
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	s.mu.Lock()
+	if i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+	s.mu.Unlock()
+}
+
+// WriteText writes every metric in the Prometheus text format 0.0.4.
+// Series are sorted by label values so the output is stable.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := append([]*family(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.mu.Lock()
+		all := make([]*series, 0, len(f.series))
+		for _, s := range f.series {
+			all = append(all, s)
+		}
+		f.mu.Unlock()
+		sort.Slice(all, func(i, j int) bool {
+			return strings.Join(all[i].values, "\xff") < strings.Join(all[j].values, "\xff")
+		})
+
+		fmt.Fprintf(bw, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.name, f.typ)
+		for _, s := range all {
+			f.writeSeries(bw, s)
+		}
+	}
+	return bw.Flush()
+}
+
+func (f *family) writeSeries(w io.Writer, s *series) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f.typ != "histogram" {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, labelPairs(f.labels, s.values, "", ""), formatFloat(s.value))
+		return
+	}
+	var cum uint64
+	for i, le := range f.buckets {
+		cum += s.counts[i]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.values, "le", formatFloat(le)), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, labelPairs(f.labels, s.values, "le", "+Inf"), s.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", f.name, labelPairs(f.labels, s.values, "", ""), formatFloat(s.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", f.name, labelPairs(f.labels, s.values, "", ""), s.count)
+}
+
+// labelPairs formats {name="value",...}, with an extra pair when extra is
+// set, or nothing without labels.
+func labelPairs(names, values []string, extra, extraValue string) string {
+	if len(names) == 0 && extra == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", n, escapeLabel(values[i]))
+	}
+	if extra != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", extra, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
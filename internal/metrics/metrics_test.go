@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Requests.", "route", "status")
+	g := r.NewGauge("size", "Size.")
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+
+	c.Inc("/b", "200")
+	c.Add(2, "/a", "500")
+	c.Inc("/a", "500")
+	g.Set(3)
+	g.Add(-1)
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	var b strings.Builder
+	if err := r.WriteText(&b); err != nil {
+		t.Fatalf("WriteText error: %v", err)
+	}
+	want := `# HELP requests_total Requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 3
+requests_total{route="/b",status="200"} 1
+# HELP size Size.
+# TYPE size gauge
+size 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistry_Escaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("c", "a \\ help\nline", "v").Inc("say \"hi\"\n")
+	var b strings.Builder
+	_ = r.WriteText(&b)
+	if !strings.Contains(b.String(), `# HELP c a \\ help\nline`) || !strings.Contains(b.String(), `c{v="say \"hi\"\n"} 1`) {
+		t.Fatalf("unexpected escaping:\n%s", b.String())
+	}
+}
+
+func TestRegistry_Duplicate(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("g", "")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate metric")
+		}
+	}()
+	r.NewGauge("g", "")
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("g", "G.").Set(1)
+	rr := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	if !strings.Contains(rr.Body.String(), "g 1\n") {
+		t.Fatalf("unexpected body %q", rr.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+// Package requestid carries the ID of the HTTP request a context belongs
+// to, so that logs and stored records can be correlated.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header is the HTTP header requests and responses carry the ID in.
+const Header = "X-Request-ID"
+
+// maxLen bounds IDs accepted from clients.
+const maxLen = 128
+
+type ctxKey struct{}
+
+// New returns a random ID of 32 hex digits.
+func New() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b) // never fails
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether id, received from a client, can be used as is: it
+// is not empty, at most 128 characters long and made of printable ASCII
+// other than spaces, so it is safe to log and to echo in a header.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the ID ctx carries, or "" if it carries none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
@@ -0,0 +1,41 @@
+package requestid
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	a, b := New(), New()
+	if len(a) != 32 || a == b || !Valid(a) {
+		t.Fatalf("unexpected ids %q %q", a, b)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for id, want := range map[string]bool{
+		"":                       false,
+		"abc-123":                true,
+		"3f2b:worker/7":          true,
+		"has space":              false,
+		"line\nbreak":            false,
+		"café":                   false,
+		strings.Repeat("a", 128): true,
+		strings.Repeat("a", 129): false,
+	} {
+		if got := Valid(id); got != want {
+			t.Errorf("Valid(%q) = %v want %v", id, got, want)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if id := FromContext(ctx); id != "" {
+		t.Fatalf("expected no id got %q", id)
+	}
+	if id := FromContext(NewContext(ctx, "abc")); id != "abc" {
+		t.Fatalf("expected abc got %q", id)
+	}
+}
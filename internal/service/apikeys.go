@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+// Scopes an API key can be granted.
+const (
+	ScopeCalculate   = "calculate"
+	ScopePacksRead   = "packs:read"
+	ScopePacksWrite  = "packs:write"
+	ScopeHistoryRead = "history:read"
+	ScopeMetricsRead = "metrics:read"
+)
+
+// Scopes lists every scope, in the order they are documented.
+var Scopes = []string{ScopeCalculate, ScopePacksRead, ScopePacksWrite, ScopeHistoryRead, ScopeMetricsRead}
+
+// ErrInvalidScope is returned by CreateAPIKey for an unknown scope.
+var ErrInvalidScope = errors.New("invalid scope")
+
+// ErrUnauthenticated is returned by Authenticate for a missing, unknown or
+// revoked key.
+var ErrUnauthenticated = errors.New("invalid api key")
+
+// apiKeyPrefix starts every key so leaked keys are easy to find.
+const apiKeyPrefix = "pk_"
+
+// CreateAPIKey creates a key with the given scopes and returns its secret,
+// which is not stored and cannot be recovered.
+func (s *Service) CreateAPIKey(ctx context.Context, name string, scopes []string) (string, store.APIKey, error) {
+	if name == "" {
+		return "", store.APIKey{}, errors.New("name required")
+	}
+	if len(scopes) == 0 {
+		return "", store.APIKey{}, fmt.Errorf("%w: at least one scope required", ErrInvalidScope)
+	}
+	for _, sc := range scopes {
+		if !validScope(sc) {
+			return "", store.APIKey{}, fmt.Errorf("%w %q, want one of %s", ErrInvalidScope, sc, strings.Join(Scopes, ", "))
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", store.APIKey{}, err
+	}
+	secret := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	key := store.APIKey{Name: name, Prefix: secret[:len(apiKeyPrefix)+6], Scopes: scopes}
+	key, err := s.store.CreateAPIKey(ctx, key, hashAPIKey(secret))
+	if err != nil {
+		return "", store.APIKey{}, err
+	}
+	return secret, key, nil
+}
+
+// Authenticate returns the key whose secret is secret. Unknown and revoked
+// keys return ErrUnauthenticated.
+func (s *Service) Authenticate(ctx context.Context, secret string) (store.APIKey, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return store.APIKey{}, ErrUnauthenticated
+	}
+	key, err := s.store.GetAPIKeyByHash(ctx, hashAPIKey(secret))
+	if errors.Is(err, store.ErrNotFound) {
+		return store.APIKey{}, ErrUnauthenticated
+	}
+	return key, err
+}
+
+// ListAPIKeys returns every key, revoked ones included.
+func (s *Service) ListAPIKeys(ctx context.Context) ([]store.APIKey, error) {
+	return s.store.ListAPIKeys(ctx)
+}
+
+// RevokeAPIKey revokes a key. Unknown or already revoked keys return
+// store.ErrNotFound.
+func (s *Service) RevokeAPIKey(ctx context.Context, id int) error {
+	return s.store.RevokeAPIKey(ctx, id)
+}
+
+// HasScope reports whether key was granted scope.
+func HasScope(key store.APIKey, scope string) bool {
+	for _, sc := range key.Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	for _, sc := range Scopes {
+		if sc == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// hashAPIKey hashes a secret for storage. Secrets are random, so a fast
+// hash is enough.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
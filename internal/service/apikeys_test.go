@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestServiceAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(store.NewMockStore([]int{10}))
+
+	secret, key, err := svc.CreateAPIKey(ctx, "ci", []string{ScopeCalculate, ScopePacksRead})
+	if err != nil {
+		t.Fatalf("CreateAPIKey error: %v", err)
+	}
+	if !strings.HasPrefix(secret, key.Prefix) || len(secret) < 40 {
+		t.Fatalf("unexpected secret %q for prefix %q", secret, key.Prefix)
+	}
+
+	got, err := svc.Authenticate(ctx, secret)
+	if err != nil || got.ID != key.ID {
+		t.Fatalf("Authenticate: %+v %v", got, err)
+	}
+	if !HasScope(got, ScopeCalculate) || HasScope(got, ScopePacksWrite) {
+		t.Fatalf("unexpected scopes %v", got.Scopes)
+	}
+	if _, err := svc.Authenticate(ctx, secret+"x"); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected ErrUnauthenticated got %v", err)
+	}
+
+	if err := svc.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey error: %v", err)
+	}
+	if _, err := svc.Authenticate(ctx, secret); !errors.Is(err, ErrUnauthenticated) {
+		t.Fatalf("expected revoked key rejected, got %v", err)
+	}
+}
+
+func TestServiceCreateAPIKey_InvalidScope(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(store.NewMockStore([]int{10}))
+	if _, _, err := svc.CreateAPIKey(ctx, "ci", []string{"admin"}); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope got %v", err)
+	}
+	if _, _, err := svc.CreateAPIKey(ctx, "ci", nil); !errors.Is(err, ErrInvalidScope) {
+		t.Fatalf("expected ErrInvalidScope got %v", err)
+	}
+}
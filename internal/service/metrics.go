@@ -0,0 +1,47 @@
+package service
+
+import (
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+)
+
+// Solvers, as labelled in packcalc_solver_duration_seconds.
+const (
+	solverTable        = "table"
+	solverObjective    = "objective"
+	solverBounded      = "bounded"
+	solverAlternatives = "alternatives"
+	solverExplain      = "explain"
+)
+
+var (
+	solverDuration = metrics.Default.NewHistogramVec("packcalc_solver_duration_seconds",
+		"Time spent in the pack solver, by solver.", metrics.DefBuckets, "solver")
+	tableEntries = metrics.Default.NewGauge("packcalc_solver_table_entries",
+		"Residues kept by the cached solution tables.")
+	activePacks = metrics.Default.NewGauge("packcalc_active_packs",
+		"Number of pack sizes in the active catalog, as last read or written.")
+)
+
+// observeSolver records the time since start for solver.
+func observeSolver(solver string, start time.Time) {
+	solverDuration.Observe(time.Since(start).Seconds(), solver)
+}
+
+// updateTableEntries sets packcalc_solver_table_entries from the cached
+// tables.
+func (s *Service) updateTableEntries() {
+	s.mu.Lock()
+	tables := make([]*calc.Table, 0, len(s.tables))
+	for _, t := range s.tables {
+		tables = append(tables, t)
+	}
+	s.mu.Unlock()
+	n := 0
+	for _, t := range tables {
+		n += t.Entries()
+	}
+	tableEntries.Set(float64(n))
+}
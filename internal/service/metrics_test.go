@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestServiceMetrics(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(store.NewMockStore([]int{23, 31, 53}))
+
+	if _, _, _, err := svc.Calculate(ctx, 263, packCatalog(23, 31, 53)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	if _, err := svc.Explain(ctx, 263, []int{23, 31, 53}, nil); err != nil {
+		t.Fatalf("explain err: %v", err)
+	}
+	out := scrape()
+	for _, want := range []string{
+		`packcalc_solver_duration_seconds_count{solver="table"}`,
+		`packcalc_solver_duration_seconds_count{solver="explain"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %s in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "packcalc_solver_table_entries 0\n") {
+		t.Fatalf("expected table entries after a calculation:\n%s", out)
+	}
+
+	if _, err := svc.SetPacks(ctx, []int{250, 500}); err != nil {
+		t.Fatalf("SetPacks err: %v", err)
+	}
+	out = scrape()
+	if !strings.Contains(out, "packcalc_solver_table_entries 0\n") || !strings.Contains(out, "packcalc_active_packs 2\n") {
+		t.Fatalf("expected tables dropped and 2 active packs:\n%s", out)
+	}
+}
+
+func scrape() string {
+	var b strings.Builder
+	_ = metrics.Default.WriteText(&b)
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+)
+
+// PackLimits bounds the pack sets SetPacks and SetSKUPacks accept. Large
+// sizes make the solver allocate tables proportional to them.
+type PackLimits struct {
+	MinSize  int // smallest accepted size, at least 1
+	MaxSize  int // largest accepted size
+	MaxPacks int // most distinct sizes in one set
+}
+
+// DefaultPackLimits are the limits of a new Service.
+var DefaultPackLimits = PackLimits{MinSize: 1, MaxSize: 1_000_000, MaxPacks: 50}
+
+// ErrInvalidPackSet is matched by every *PackSetError.
+var ErrInvalidPackSet = errors.New("invalid pack set")
+
+// PackViolation is one reason a pack set was rejected. Index is the
+// position of the offending size in the request, or -1 for the whole set.
+type PackViolation struct {
+	Index   int
+	Message string
+}
+
+// PackSetError lists every violation of a rejected pack set.
+type PackSetError struct {
+	Violations []PackViolation
+}
+
+func (e *PackSetError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+	return "invalid pack set: " + strings.Join(msgs, "; ")
+}
+
+// Is lets errors.Is match the error against ErrInvalidPackSet.
+func (e *PackSetError) Is(target error) bool { return target == ErrInvalidPackSet }
+
+// PackSet is a pack set as stored, sorted and without duplicates, with
+// warnings about sets that are valid but probably not intended.
+type PackSet struct {
+	Packs    []int
+	Warnings []string
+}
+
+// NormalizePacks checks packs against l and returns them sorted and
+// deduplicated. Every violation is reported in one *PackSetError.
+func NormalizePacks(packs []int, l PackLimits) (PackSet, error) {
+	var violations []PackViolation
+	if len(packs) == 0 {
+		violations = append(violations, PackViolation{-1, "packs required"})
+	}
+	seen := make(map[int]bool, len(packs))
+	out := make([]int, 0, len(packs))
+	for i, p := range packs {
+		switch {
+		case p <= 0:
+			violations = append(violations, PackViolation{i, fmt.Sprintf("packs[%d]: size %d must be positive", i, p)})
+		case p < l.MinSize:
+			violations = append(violations, PackViolation{i, fmt.Sprintf("packs[%d]: size %d is below the minimum %d", i, p, l.MinSize)})
+		case l.MaxSize > 0 && p > l.MaxSize:
+			violations = append(violations, PackViolation{i, fmt.Sprintf("packs[%d]: size %d is above the maximum %d", i, p, l.MaxSize)})
+		case !seen[p]:
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	if l.MaxPacks > 0 && len(out) > l.MaxPacks {
+		violations = append(violations, PackViolation{-1, fmt.Sprintf("%d distinct sizes, at most %d allowed", len(out), l.MaxPacks)})
+	}
+	if violations != nil {
+		return PackSet{}, &PackSetError{Violations: violations}
+	}
+
+	sort.Ints(out)
+	set := PackSet{Packs: out}
+	if g := calc.GCD(out); g > 1 {
+		set.Warnings = append(set.Warnings, fmt.Sprintf("every size is a multiple of %d, so orders are rounded up to a multiple of %d", g, g))
+	}
+	return set, nil
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+func TestNormalizePacks(t *testing.T) {
+	set, err := NormalizePacks([]int{53, 23, 31, 23}, DefaultPackLimits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(set.Packs, []int{23, 31, 53}) || set.Warnings != nil {
+		t.Fatalf("unexpected set %+v", set)
+	}
+
+	set, err = NormalizePacks([]int{500, 250, 1000}, DefaultPackLimits)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(set.Warnings) != 1 {
+		t.Fatalf("expected a gcd warning, got %v", set.Warnings)
+	}
+}
+
+func TestNormalizePacks_AllViolations(t *testing.T) {
+	limits := PackLimits{MinSize: 5, MaxSize: 100, MaxPacks: 2}
+	_, err := NormalizePacks([]int{0, 3, 200, 10, 20, 30, -1}, limits)
+	var setErr *PackSetError
+	if !errors.As(err, &setErr) || !errors.Is(err, ErrInvalidPackSet) {
+		t.Fatalf("expected PackSetError got %v", err)
+	}
+	want := []int{0, 1, 2, 6, -1}
+	if len(setErr.Violations) != len(want) {
+		t.Fatalf("expected %d violations got %+v", len(want), setErr.Violations)
+	}
+	for i, v := range setErr.Violations {
+		if v.Index != want[i] {
+			t.Fatalf("violation %d: expected index %d got %+v", i, want[i], v)
+		}
+	}
+
+	if _, err := NormalizePacks(nil, limits); !errors.Is(err, ErrInvalidPackSet) {
+		t.Fatalf("expected empty set rejected, got %v", err)
+	}
+}
+
+func TestServiceSetPacks_Normalizes(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{10})
+	svc := NewService(mock).WithPackLimits(PackLimits{MinSize: 1, MaxSize: 1000, MaxPacks: 3})
+
+	if _, err := svc.SetPacks(ctx, []int{20, 10, 20}); err != nil {
+		t.Fatalf("SetPacks err: %v", err)
+	}
+	got, _ := svc.GetPacks(ctx)
+	if !reflect.DeepEqual(got, []int{10, 20}) {
+		t.Fatalf("expected normalized packs stored, got %v", got)
+	}
+
+	if _, err := svc.SetPacks(ctx, []int{5000}); !errors.Is(err, ErrInvalidPackSet) {
+		t.Fatalf("expected size above maximum rejected, got %v", err)
+	}
+	if got, _ := svc.GetPacks(ctx); !reflect.DeepEqual(got, []int{10, 20}) {
+		t.Fatalf("rejected set must not be stored, got %v", got)
+	}
+}
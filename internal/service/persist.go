@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Persistence policies, as accepted in Persistence.Policy.
+const (
+	// PersistStrict fails a calculation whose result cannot be saved.
+	PersistStrict = "strict"
+	// PersistBestEffort answers even when saving fails, logging the failure.
+	PersistBestEffort = "best-effort"
+	// PersistAsync answers at once and saves in the background, retrying
+	// failures and writing what cannot be saved to a dead-letter file.
+	PersistAsync = "async"
+)
+
+// Persistence configures how calculation results are saved.
+type Persistence struct {
+	Policy string
+	// The settings below apply to PersistAsync only.
+	QueueSize   int           // results waiting to be saved; more are dead-lettered
+	MaxAttempts int           // saves tried per result
+	Backoff     time.Duration // before the first retry, doubling each retry
+	MaxBackoff  time.Duration
+	// DeadLetter is the file results that could not be saved are appended
+	// to, one JSON object per line. Without one they are only logged.
+	DeadLetter string
+}
+
+// DefaultPersistence is the persistence of a new Service.
+var DefaultPersistence = Persistence{
+	Policy:      PersistStrict,
+	QueueSize:   1000,
+	MaxAttempts: 5,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  5 * time.Second,
+}
+
+var (
+	persistErrors = metrics.Default.NewCounterVec("packcalc_persist_errors_total",
+		"Failed attempts to save a calculation, by persistence policy.", "policy")
+	persistDeadLetters = metrics.Default.NewCounterVec("packcalc_persist_dead_letters_total",
+		"Calculations given up on by the async writer, by reason.", "reason")
+	persistQueued = metrics.Default.NewGauge("packcalc_persist_queue_length",
+		"Calculations waiting for the async writer.")
+)
+
+// WithPersistence sets how calculation results are saved and returns s. It
+// must be called before s is used. With PersistAsync, Flush must be called
+// before exiting.
+func (s *Service) WithPersistence(p Persistence) *Service {
+	s.persistence = p
+	if p.Policy == PersistAsync {
+		s.writer = newAsyncWriter(s.store, p)
+	}
+	return s
+}
+
+// Flush waits until the async writer has saved every queued result, then
+// stops it; results saved later are dead-lettered. When ctx ends first, the
+// results still queued are dead-lettered without further attempts. Flush
+// does nothing for other policies.
+func (s *Service) Flush(ctx context.Context) error {
+	if s.writer == nil {
+		return nil
+	}
+	return s.writer.flush(ctx)
+}
+
+// record is a result to save: a calculation or, when lines is set, an
+// order.
+type record struct {
+	catalog                 int // version the calculation used, 0 for orders
+	items, total, packCount int
+	counts                  map[int]int
+	lines                   []store.OrderLine
+
+	requestID string
+	link      trace.Link // to the request that calculated it
+}
+
+func (r record) save(ctx context.Context, st store.Store) error {
+	if r.lines != nil {
+		return st.SaveOrder(ctx, r.lines)
+	}
+	return st.SaveCalculation(ctx, r.catalog, r.items, r.total, r.packCount, r.counts)
+}
+
+// persist saves rec according to the persistence policy. Only PersistStrict
+// returns the error of the store.
+func (s *Service) persist(ctx context.Context, rec record) error {
+	switch s.persistence.Policy {
+	case PersistBestEffort:
+		if err := rec.save(ctx, s.store); err != nil {
+			persistErrors.Inc(PersistBestEffort)
+			slog.WarnContext(ctx, "calculation not saved", "request_id", requestid.FromContext(ctx), "error", err)
+		}
+		return nil
+	case PersistAsync:
+		rec.requestID = requestid.FromContext(ctx)
+		rec.link = trace.LinkFromContext(ctx)
+		s.writer.enqueue(rec)
+		return nil
+	default:
+		return rec.save(ctx, s.store)
+	}
+}
+
+// asyncWriter saves records in the background, one at a time.
+type asyncWriter struct {
+	store store.Store
+	opts  Persistence
+	queue chan record
+	done  chan struct{} // closed once run returns
+
+	// base is the context of every save; canceling it makes the writer
+	// give up on retries
+	base   context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex // guards closed against sends on a closed queue
+	closed bool
+
+	deadMu sync.Mutex // serializes writes to the dead-letter file
+}
+
+func newAsyncWriter(st store.Store, p Persistence) *asyncWriter {
+	w := &asyncWriter{store: st, opts: p, queue: make(chan record, p.QueueSize), done: make(chan struct{})}
+	w.base, w.cancel = context.WithCancel(context.Background())
+	go w.run()
+	return w
+}
+
+// enqueue queues rec, or dead-letters it when the queue is full or the
+// writer is flushed: the response does not wait for the database.
+func (w *asyncWriter) enqueue(rec record) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.deadLetter(rec, "closed", 0, nil)
+		return
+	}
+	// count the record before the send, as run may take it at once
+	persistQueued.Add(1)
+	select {
+	case w.queue <- rec:
+	default:
+		persistQueued.Add(-1)
+		w.deadLetter(rec, "queue_full", 0, nil)
+	}
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	for rec := range w.queue {
+		persistQueued.Add(-1)
+		w.write(rec)
+	}
+}
+
+// write saves rec, retrying with exponential backoff, and dead-letters it
+// after the last attempt.
+func (w *asyncWriter) write(rec record) {
+	ctx := requestid.NewContext(w.base, rec.requestID)
+	ctx, span := startSpan(ctx, "Service.persist", attribute.String("request_id", rec.requestID))
+	span.AddLink(rec.link)
+
+	delay := w.opts.Backoff
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		if err = rec.save(ctx, w.store); err == nil {
+			tracing.End(span, nil)
+			return
+		}
+		persistErrors.Inc(PersistAsync)
+		if attempt >= w.opts.MaxAttempts {
+			break
+		}
+		select {
+		case <-time.After(delay):
+		case <-w.base.Done():
+		}
+		if w.base.Err() != nil {
+			break
+		}
+		delay = min(2*delay, w.opts.MaxBackoff)
+	}
+	span.SetAttributes(attribute.Int("attempts", attempt))
+	tracing.End(span, err)
+	reason := "attempts"
+	if w.base.Err() != nil {
+		reason = "flush_timeout"
+	}
+	w.deadLetter(rec, reason, attempt, err)
+}
+
+// flush closes the queue and waits for the writer to drain it, giving up
+// on retries once ctx ends.
+func (w *asyncWriter) flush(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return fmt.Errorf("flush calculations: %w", ctx.Err())
+	}
+}
+
+// deadLetter is the line written for a result that could not be saved.
+type deadLetter struct {
+	Time       time.Time        `json:"time"`
+	Reason     string           `json:"reason"`
+	Error      string           `json:"error,omitempty"`
+	Attempts   int              `json:"attempts"`
+	RequestID  string           `json:"request_id,omitempty"`
+	Catalog    int              `json:"catalog_version,omitempty"`
+	Items      int              `json:"items,omitempty"`
+	TotalItems int              `json:"total_items,omitempty"`
+	PackCount  int              `json:"pack_count,omitempty"`
+	Counts     map[int]int      `json:"counts,omitempty"`
+	Lines      []deadLetterLine `json:"lines,omitempty"`
+}
+
+type deadLetterLine struct {
+	SKU        string      `json:"sku"`
+	Items      int         `json:"items"`
+	TotalItems int         `json:"total_items"`
+	PackCount  int         `json:"pack_count"`
+	Counts     map[int]int `json:"counts"`
+}
+
+// deadLetter appends rec to the dead-letter file, or logs it when there is
+// none or it cannot be written.
+func (w *asyncWriter) deadLetter(rec record, reason string, attempts int, err error) {
+	persistDeadLetters.Inc(reason)
+	line := deadLetter{
+		Time: time.Now().UTC(), Reason: reason, Attempts: attempts, RequestID: rec.requestID,
+		Catalog: rec.catalog, Items: rec.items, TotalItems: rec.total, PackCount: rec.packCount, Counts: rec.counts,
+	}
+	for _, l := range rec.lines {
+		line.Lines = append(line.Lines, deadLetterLine{l.SKU, l.Items, l.TotalItems, l.PackCount, l.Counts})
+	}
+	if err != nil {
+		line.Error = err.Error()
+	}
+	b, _ := json.Marshal(line)
+
+	if w.opts.DeadLetter != "" {
+		w.deadMu.Lock()
+		werr := appendLine(w.opts.DeadLetter, b)
+		w.deadMu.Unlock()
+		if werr == nil {
+			slog.Warn("calculation dead-lettered", "request_id", rec.requestID, "reason", reason, "file", w.opts.DeadLetter)
+			return
+		}
+		slog.Error("dead-letter file not written", "file", w.opts.DeadLetter, "error", werr)
+	}
+	slog.Error("calculation not saved", "request_id", rec.requestID, "reason", reason, "record", json.RawMessage(b))
+}
+
+func appendLine(path string, b []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+// flakyStore fails the first fails saves, then saves to the mock store.
+type flakyStore struct {
+	store.Store
+	mu    sync.Mutex
+	fails int
+	calls int
+}
+
+func (f *flakyStore) SaveCalculation(ctx context.Context, catalog, items, total, packCount int, counts map[int]int) error {
+	f.mu.Lock()
+	f.calls++
+	fail := f.calls <= f.fails
+	f.mu.Unlock()
+	if fail {
+		return errors.New("connection reset")
+	}
+	return f.Store.SaveCalculation(ctx, catalog, items, total, packCount, counts)
+}
+
+// blockingStore holds every save until release is closed.
+type blockingStore struct {
+	store.Store
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) SaveCalculation(ctx context.Context, catalog, items, total, packCount int, counts map[int]int) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Store.SaveCalculation(ctx, catalog, items, total, packCount, counts)
+}
+
+func asyncPersistence(deadLetter string) Persistence {
+	p := DefaultPersistence
+	p.Policy = PersistAsync
+	p.Backoff = time.Millisecond
+	p.MaxBackoff = 2 * time.Millisecond
+	p.DeadLetter = deadLetter
+	return p
+}
+
+// readDeadLetters returns the lines of the dead-letter file at path.
+func readDeadLetters(t *testing.T, path string) []deadLetter {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read dead letters: %v", err)
+	}
+	var out []deadLetter
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		var d deadLetter
+		if err := json.Unmarshal([]byte(line), &d); err != nil {
+			t.Fatalf("bad dead letter %q: %v", line, err)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func TestPersist_BestEffort(t *testing.T) {
+	p := DefaultPersistence
+	p.Policy = PersistBestEffort
+	svc := NewService(&errStore{}).WithPersistence(p)
+	counts, total, _, err := svc.Calculate(context.Background(), 501, packCatalog(250, 500))
+	if err != nil || total != 750 || counts[500] != 1 {
+		t.Fatalf("expected the answer despite the failed save got %v %d %v", counts, total, err)
+	}
+}
+
+func TestPersist_AsyncRetries(t *testing.T) {
+	st := &flakyStore{Store: store.NewMockStore([]int{250, 500}), fails: 2}
+	svc := NewService(st).WithPersistence(asyncPersistence(""))
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	if _, _, _, err := svc.Calculate(ctx, 501, packCatalog(250, 500)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	if err := svc.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	calcs, err := st.ListCalculations(context.Background(), store.CalculationFilter{})
+	if err != nil || len(calcs) != 1 {
+		t.Fatalf("expected one saved calculation got %v %v", calcs, err)
+	}
+	if calcs[0].Items != 501 || calcs[0].RequestID != "req-1" {
+		t.Fatalf("expected the calculation of req-1 got %+v", calcs[0])
+	}
+	if st.calls != 3 {
+		t.Fatalf("expected 3 attempts got %d", st.calls)
+	}
+}
+
+func TestPersist_AsyncDeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	p := asyncPersistence(path)
+	p.MaxAttempts = 2
+	svc := NewService(&errStore{}).WithPersistence(p)
+	ctx := requestid.NewContext(context.Background(), "req-2")
+	if _, _, _, err := svc.Calculate(ctx, 501, store.PackCatalog{Version: 2, Packs: []int{250, 500}}); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	if err := svc.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	// results calculated after the flush are not queued
+	if _, _, _, err := svc.Calculate(context.Background(), 10, packCatalog(250, 500)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+
+	dead := readDeadLetters(t, path)
+	if len(dead) != 2 {
+		t.Fatalf("expected 2 dead letters got %+v", dead)
+	}
+	d := dead[0]
+	if d.Reason != "attempts" || d.Attempts != 2 || d.Error != "fail SaveCalculation" || d.RequestID != "req-2" ||
+		d.Catalog != 2 || d.Items != 501 || d.TotalItems != 750 || d.Counts[500] != 1 {
+		t.Fatalf("unexpected dead letter %+v", d)
+	}
+	if dead[1].Reason != "closed" || dead[1].Items != 10 {
+		t.Fatalf("expected the late result dead-lettered got %+v", dead[1])
+	}
+}
+
+func TestPersist_AsyncKeepsCatalogVersion(t *testing.T) {
+	ctx := context.Background()
+	st := &blockingStore{Store: store.NewMockStore([]int{250, 500}), started: make(chan struct{}, 1), release: make(chan struct{})}
+	svc := NewService(st).WithPersistence(asyncPersistence(""))
+	catalog, err := svc.ActiveCatalog(ctx)
+	if err != nil {
+		t.Fatalf("ActiveCatalog err: %v", err)
+	}
+	if _, _, _, err := svc.Calculate(ctx, 501, catalog); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	<-st.started
+	// a new version activated before the save does not relink the result
+	if _, err := svc.SetPacks(ctx, []int{100}); err != nil {
+		t.Fatalf("SetPacks err: %v", err)
+	}
+	close(st.release)
+	if err := svc.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	calcs, _ := st.ListCalculations(ctx, store.CalculationFilter{})
+	if len(calcs) != 1 || calcs[0].CatalogVersion != catalog.Version {
+		t.Fatalf("expected the calculation linked to version %d got %+v", catalog.Version, calcs)
+	}
+}
+
+func TestPersist_AsyncFlushTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	p := asyncPersistence(path)
+	p.Backoff, p.MaxBackoff = time.Hour, time.Hour
+	svc := NewService(&errStore{}).WithPersistence(p)
+	if _, _, _, err := svc.Calculate(context.Background(), 501, packCatalog(250, 500)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := svc.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the flush to time out got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("flush waited for the backoff")
+	}
+	if dead := readDeadLetters(t, path); len(dead) != 1 || dead[0].Reason != "flush_timeout" || dead[0].Attempts != 1 {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+}
+
+func TestPersist_AsyncQueueFull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	st := &blockingStore{Store: store.NewMockStore([]int{250, 500}), started: make(chan struct{}, 3), release: make(chan struct{})}
+	p := asyncPersistence(path)
+	p.QueueSize = 1
+	svc := NewService(st).WithPersistence(p)
+
+	calculate := func(items int) {
+		t.Helper()
+		if _, _, _, err := svc.Calculate(context.Background(), items, packCatalog(250, 500)); err != nil {
+			t.Fatalf("calculate err: %v", err)
+		}
+	}
+	calculate(1)
+	<-st.started // the writer holds the first result
+	calculate(2) // queued
+	calculate(3) // over the queue size
+	if out := scrape(); !strings.Contains(out, "packcalc_persist_queue_length 1\n") {
+		t.Fatalf("expected the rejected record not counted:\n%s", out)
+	}
+	close(st.release)
+	if err := svc.Flush(context.Background()); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	if out := scrape(); !strings.Contains(out, "packcalc_persist_queue_length 0\n") {
+		t.Fatalf("expected an empty queue after the flush:\n%s", out)
+	}
+
+	calcs, _ := st.ListCalculations(context.Background(), store.CalculationFilter{})
+	if len(calcs) != 2 {
+		t.Fatalf("expected 2 saved calculations got %d", len(calcs))
+	}
+	if dead := readDeadLetters(t, path); len(dead) != 1 || dead[0].Reason != "queue_full" || dead[0].Items != 3 {
+		t.Fatalf("unexpected dead letters %+v", dead)
+	}
+}
@@ -1,38 +1,542 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
 	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
 	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Objective names accepted by Service.Objective.
+const (
+	ObjectiveWaste = "waste"
+	ObjectiveCost  = "cost"
+	ObjectiveMixed = "mixed"
 )
 
+// ErrInvalidObjective is returned by Service.Objective for bad client input.
+var ErrInvalidObjective = errors.New("invalid objective")
+
+// maxTables caps how many pack sets keep a cached calc.Table.
+const maxTables = 64
+
+// SolverLimits bounds the orders the service calculates. The stock-limited
+// and cost-weighted solvers allocate tables proportional to the order,
+// unlike the residue solver behind Calculate, so they accept smaller orders.
+type SolverLimits struct {
+	MaxItems  int // most items of any order
+	MaxTarget int // most items with stock limits or an objective
+}
+
+// DefaultSolverLimits are the limits of a new Service.
+var DefaultSolverLimits = SolverLimits{MaxItems: 1_000_000_000, MaxTarget: 1_000_000}
+
+// ErrTooManyItems is returned for orders above the SolverLimits.
+var ErrTooManyItems = errors.New("too many items")
+
 // Service holds business logic and interacts with the store.
 type Service struct {
-	store store.Store
+	store       store.Store
+	limits      PackLimits
+	solver      SolverLimits
+	persistence Persistence
+	writer      *asyncWriter // PersistAsync only
+
+	mu     sync.Mutex
+	tables map[string]*calc.Table // keyed by packsKey
 }
 
 // NewService constructs service with given store.
 func NewService(s store.Store) *Service {
-	return &Service{store: s}
+	return &Service{store: s, limits: DefaultPackLimits, solver: DefaultSolverLimits, persistence: DefaultPersistence}
+}
+
+// WithPackLimits sets the limits of pack sets and returns s. It must be
+// called before s is used.
+func (s *Service) WithPackLimits(l PackLimits) *Service {
+	s.limits = l
+	return s
+}
+
+// WithSolverLimits sets the limits of the orders s calculates and returns
+// s. It must be called before s is used.
+func (s *Service) WithSolverLimits(l SolverLimits) *Service {
+	s.solver = l
+	return s
+}
+
+// SolverLimits returns the limits of the orders s calculates.
+func (s *Service) SolverLimits() SolverLimits {
+	return s.solver
 }
 
 // GetPacks returns pack sizes from persistence.
-func (s *Service) GetPacks() ([]int, error) {
-	return s.store.GetPacks()
+func (s *Service) GetPacks(ctx context.Context) ([]int, error) {
+	packs, err := s.store.GetPacks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	activePacks.Set(float64(len(packs)))
+	return packs, nil
+}
+
+// ActiveCatalog returns the active pack catalog. Calculations against its
+// packs pass it on so they are saved with the version they used, even when
+// another version is activated before the save.
+func (s *Service) ActiveCatalog(ctx context.Context) (store.PackCatalog, error) {
+	c, err := s.store.GetActivePackCatalog(ctx)
+	if err != nil {
+		return store.PackCatalog{}, err
+	}
+	activePacks.Set(float64(len(c.Packs)))
+	return c, nil
+}
+
+// SetPacks validates and normalizes packs, stores them and drops the cached
+// solution tables. A rejected set returns a *PackSetError.
+func (s *Service) SetPacks(ctx context.Context, packs []int) (PackSet, error) {
+	set, err := NormalizePacks(packs, s.limits)
+	if err != nil {
+		return PackSet{}, err
+	}
+	defer s.resetTables()
+	if err := s.store.SetPacks(ctx, set.Packs); err != nil {
+		return PackSet{}, err
+	}
+	activePacks.Set(float64(len(set.Packs)))
+	return set, nil
+}
+
+// GetPackCosts returns the unit cost of each pack size.
+func (s *Service) GetPackCosts(ctx context.Context) (map[int]float64, error) {
+	return s.store.GetPackCosts(ctx)
+}
+
+// SetPackCosts stores unit costs for existing pack sizes.
+func (s *Service) SetPackCosts(ctx context.Context, costs map[int]float64) error {
+	return s.store.SetPackCosts(ctx, costs)
+}
+
+// ListPackCatalogs returns every pack catalog version, newest first.
+func (s *Service) ListPackCatalogs(ctx context.Context) ([]store.PackCatalog, error) {
+	return s.store.ListPackCatalogs(ctx)
+}
+
+// CostChange is a pack size whose unit cost differs between two catalogs.
+type CostChange struct {
+	Size int
+	From float64
+	To   float64
+}
+
+// CatalogDiff lists what changed from one pack catalog version to another.
+type CatalogDiff struct {
+	From    int
+	To      int
+	Added   []int // sizes only in To, ascending
+	Removed []int // sizes only in From, ascending
+	Costs   []CostChange
+}
+
+// DiffPackCatalogs compares two catalog versions. Unknown versions wrap
+// store.ErrNotFound.
+func (s *Service) DiffPackCatalogs(ctx context.Context, from, to int) (CatalogDiff, error) {
+	a, err := s.store.GetPackCatalog(ctx, from)
+	if err != nil {
+		return CatalogDiff{}, fmt.Errorf("version %d: %w", from, err)
+	}
+	b, err := s.store.GetPackCatalog(ctx, to)
+	if err != nil {
+		return CatalogDiff{}, fmt.Errorf("version %d: %w", to, err)
+	}
+
+	d := CatalogDiff{From: from, To: to, Added: []int{}, Removed: []int{}, Costs: []CostChange{}}
+	for _, size := range b.Packs {
+		old, ok := a.Costs[size]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, size)
+		case old != b.Costs[size]:
+			d.Costs = append(d.Costs, CostChange{Size: size, From: old, To: b.Costs[size]})
+		}
+	}
+	for _, size := range a.Packs {
+		if _, ok := b.Costs[size]; !ok {
+			d.Removed = append(d.Removed, size)
+		}
+	}
+	return d, nil
+}
+
+// RollbackPacks makes a previous catalog version active again. An unknown
+// version returns store.ErrNotFound.
+func (s *Service) RollbackPacks(ctx context.Context, version int) error {
+	defer s.resetTables()
+	return s.store.ActivatePackCatalog(ctx, version)
+}
+
+// Objective builds the calc objective for name: "waste" (or empty) is the
+// default and returns nil, "cost" minimises the pack costs of catalog and
+// "mixed" adds itemValue per overshipped item. The costs come from the same
+// snapshot as the packs, so a concurrent write cannot mix two versions. Bad
+// input wraps ErrInvalidObjective.
+func (s *Service) Objective(name string, itemValue float64, catalog store.PackCatalog) (calc.Objective, error) {
+	switch name {
+	case "", ObjectiveWaste:
+		return nil, nil
+	case ObjectiveCost, ObjectiveMixed:
+	default:
+		return nil, fmt.Errorf("%w: unknown objective %q", ErrInvalidObjective, name)
+	}
+	if itemValue < 0 {
+		return nil, fmt.Errorf("%w: item_value must not be negative", ErrInvalidObjective)
+	}
+	obj := calc.CostObjective{PackCosts: catalog.Costs}
+	if name == ObjectiveMixed {
+		obj.ItemValue = itemValue
+	}
+	return obj, nil
+}
+
+// GetStock returns inventory levels from persistence.
+func (s *Service) GetStock(ctx context.Context) (map[int]int, error) {
+	return s.store.GetStock(ctx)
+}
+
+// SetStock stores new inventory levels.
+func (s *Service) SetStock(ctx context.Context, stock map[int]int) error {
+	return s.store.SetStock(ctx, stock)
+}
+
+// Calculate performs algorithm on the packs of catalog and persists the
+// calculation result, linked to the catalog version, according to the
+// persistence policy. Input the solver rejects wraps one of
+// the calc sentinel errors; orders above SolverLimits.MaxItems wrap
+// ErrTooManyItems.
+func (s *Service) Calculate(ctx context.Context, items int, catalog store.PackCatalog) (counts map[int]int, total, packCount int, err error) {
+	ctx, span := startSpan(ctx, "Service.Calculate", attribute.Int("items", items))
+	defer func() { tracing.End(span, err) }()
+	counts, total, packCount, err = s.solve(ctx, items, catalog.Packs)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("calculate %d items: %w", items, err)
+	}
+	return s.save(ctx, catalog.Version, items, total, packCount, counts)
+}
+
+// CalculateWithObjective is Calculate minimizing obj instead of waste.
+// With a non-nil obj, orders above SolverLimits.MaxTarget wrap
+// ErrTooManyItems.
+func (s *Service) CalculateWithObjective(ctx context.Context, items int, catalog store.PackCatalog, obj calc.Objective) (counts map[int]int, total, packCount int, err error) {
+	ctx, span := startSpan(ctx, "Service.CalculateWithObjective", attribute.Int("items", items))
+	defer func() { tracing.End(span, err) }()
+	why := ""
+	if obj != nil {
+		why = "with an objective"
+	}
+	if err := s.checkItems(items, why); err != nil {
+		return nil, 0, 0, fmt.Errorf("calculate %d items: %w", items, err)
+	}
+	solveCtx, done := startSolver(ctx, solverObjective, items, catalog.Packs)
+	counts, total, packCount, err = calc.CalculatePacksWithObjective(solveCtx, items, catalog.Packs, obj)
+	done(packCount, err)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("calculate %d items: %w", items, err)
+	}
+	return s.save(ctx, catalog.Version, items, total, packCount, counts)
+}
+
+// CalculateBounded is CalculateWithObjective limited to the given stock per
+// pack size. A nil obj minimizes waste. When stock limits any of packs or
+// obj is not nil, orders above SolverLimits.MaxTarget wrap ErrTooManyItems.
+func (s *Service) CalculateBounded(ctx context.Context, items int, catalog store.PackCatalog, stock map[int]int, obj calc.Objective) (counts map[int]int, total, packCount int, err error) {
+	ctx, span := startSpan(ctx, "Service.CalculateBounded", attribute.Int("items", items))
+	defer func() { tracing.End(span, err) }()
+	why := ""
+	switch {
+	case LimitsPacks(stock, catalog.Packs):
+		why = "with stock limits"
+	case obj != nil:
+		why = "with an objective"
+	}
+	if err := s.checkItems(items, why); err != nil {
+		return nil, 0, 0, fmt.Errorf("calculate %d items: %w", items, err)
+	}
+	solveCtx, done := startSolver(ctx, solverBounded, items, catalog.Packs)
+	counts, total, packCount, err = calc.CalculatePacksBounded(solveCtx, items, catalog.Packs, stock, obj)
+	done(packCount, err)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("calculate %d items: %w", items, err)
+	}
+	return s.save(ctx, catalog.Version, items, total, packCount, counts)
+}
+
+// BatchItem is one order of a batch. Ref is opaque and copied to the
+// result; Err marks an order the caller could not read and is reported as is.
+type BatchItem struct {
+	Ref   any
+	Items int
+	Err   error
+}
+
+// BatchResult is the outcome of one BatchItem.
+type BatchResult struct {
+	Ref       any
+	Items     int
+	Counts    map[int]int
+	Total     int
+	PackCount int
+	Err       error
+}
+
+// CalculateBatch calculates every order received on in against the active
+// catalog, fetched once, with at most workers goroutines, persisting each
+// result like Calculate. Results are sent as they complete, in any order,
+// and the channel is closed once in is closed and every order is done. A
+// failing order only fails its own result. Only fetching the pack sizes
+// fails the whole batch.
+func (s *Service) CalculateBatch(ctx context.Context, in <-chan BatchItem, workers int) (<-chan BatchResult, error) {
+	catalog, err := s.store.GetActivePackCatalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	out := make(chan BatchResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range in {
+				out <- s.calculateBatchItem(ctx, item, catalog)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out, nil
+}
+
+func (s *Service) calculateBatchItem(ctx context.Context, item BatchItem, catalog store.PackCatalog) BatchResult {
+	res := BatchResult{Ref: item.Ref, Items: item.Items, Err: item.Err}
+	if res.Err != nil {
+		return res
+	}
+	res.Counts, res.Total, res.PackCount, res.Err = s.Calculate(ctx, item.Items, catalog)
+	return res
+}
+
+// OrderLine is one requested line of a multi-line order.
+type OrderLine struct {
+	SKU   string
+	Items int
+}
+
+// GetSKUPacks returns the pack catalog of a SKU.
+func (s *Service) GetSKUPacks(ctx context.Context, sku string) ([]int, error) {
+	return s.store.GetSKUPacks(ctx, sku)
+}
+
+// SetSKUPacks validates and normalizes packs like SetPacks and stores them
+// as the pack catalog of a SKU.
+func (s *Service) SetSKUPacks(ctx context.Context, sku string, packs []int) (PackSet, error) {
+	set, err := NormalizePacks(packs, s.limits)
+	if err != nil {
+		return PackSet{}, err
+	}
+	if err := s.store.SetSKUPacks(ctx, sku, set.Packs); err != nil {
+		return PackSet{}, err
+	}
+	return set, nil
+}
+
+// CalculateOrder calculates every line against its SKU's pack catalog and
+// persists the whole order as a single calculation, according to the
+// persistence policy. Unknown SKUs wrap store.ErrNotFound.
+func (s *Service) CalculateOrder(ctx context.Context, lines []OrderLine) (_ []store.OrderLine, err error) {
+	ctx, span := startSpan(ctx, "Service.CalculateOrder", attribute.Int("lines", len(lines)))
+	defer func() { tracing.End(span, err) }()
+	out := make([]store.OrderLine, len(lines))
+	for i, l := range lines {
+		packs, err := s.store.GetSKUPacks(ctx, l.SKU)
+		if err != nil {
+			return nil, fmt.Errorf("sku %q: %w", l.SKU, err)
+		}
+		counts, total, packCount, err := s.solve(ctx, l.Items, packs)
+		if err != nil {
+			return nil, fmt.Errorf("sku %q: %w", l.SKU, err)
+		}
+		out[i] = store.OrderLine{SKU: l.SKU, Items: l.Items, TotalItems: total, PackCount: packCount, Counts: counts}
+	}
+	if perr := s.persist(ctx, record{lines: out}); perr != nil {
+		return out, perr
+	}
+	return out, nil
+}
+
+// ListCalculations returns stored calculation summaries, newest first.
+func (s *Service) ListCalculations(ctx context.Context, f store.CalculationFilter) ([]store.Calculation, error) {
+	return s.store.ListCalculations(ctx, f)
+}
+
+// GetCalculation returns one stored calculation with its breakdown.
+func (s *Service) GetCalculation(ctx context.Context, id int) (store.Calculation, error) {
+	return s.store.GetCalculation(ctx, id)
+}
+
+// Alternatives returns the k best combinations for items within stock,
+// ranked by waste then pack count. Nothing is persisted. When stock limits
+// any of packs, orders above SolverLimits.MaxTarget wrap ErrTooManyItems.
+func (s *Service) Alternatives(ctx context.Context, items int, packs []int, stock map[int]int, k int) ([]calc.Solution, error) {
+	why := ""
+	if LimitsPacks(stock, packs) {
+		why = "with stock limits"
+	}
+	if err := s.checkItems(items, why); err != nil {
+		return nil, fmt.Errorf("alternatives for %d items: %w", items, err)
+	}
+	ctx, done := startSolver(ctx, solverAlternatives, items, packs)
+	sols, err := calc.TopSolutionsBounded(ctx, items, packs, stock, k)
+	done(0, err)
+	if err != nil {
+		return nil, fmt.Errorf("alternatives for %d items: %w", items, err)
+	}
+	return sols, nil
 }
 
-// SetPacks stores new pack sizes.
-func (s *Service) SetPacks(packs []int) error {
-	return s.store.SetPacks(packs)
+// Explain returns why Calculate, or CalculateBounded within stock, picks
+// its combination for items, through the cached table of packs. Nothing is
+// persisted. When stock limits any of packs, orders above
+// SolverLimits.MaxTarget wrap ErrTooManyItems.
+func (s *Service) Explain(ctx context.Context, items int, packs []int, stock map[int]int) (calc.Explanation, error) {
+	why := ""
+	if LimitsPacks(stock, packs) {
+		why = "with stock limits"
+	}
+	if err := s.checkItems(items, why); err != nil {
+		return calc.Explanation{}, fmt.Errorf("explain %d items: %w", items, err)
+	}
+	ctx, done := startSolver(ctx, solverExplain, items, packs)
+	e, err := s.explain(ctx, items, packs, stock)
+	done(0, err)
+	if err != nil {
+		return calc.Explanation{}, fmt.Errorf("explain %d items: %w", items, err)
+	}
+	return e, nil
 }
 
-// Calculate performs algorithm and persists the calculation result.
-func (s *Service) Calculate(items int, packs []int) (map[int]int, int, int, error) {
-	counts, total, packCount, err := calc.CalculatePacks(items, packs)
+// solve is calc.CalculatePacks through the cached table of packs.
+func (s *Service) solve(ctx context.Context, items int, packs []int) (counts map[int]int, total, packCount int, err error) {
+	if items <= 0 {
+		return nil, 0, 0, calc.ErrInvalidTarget
+	}
+	if err := s.checkItems(items, ""); err != nil {
+		return nil, 0, 0, err
+	}
+	ctx, done := startSolver(ctx, solverTable, items, packs)
+	defer func() { done(packCount, err) }()
+	t, err := s.table(ctx, packs)
 	if err != nil {
 		return nil, 0, 0, err
 	}
-	// persist result (best-effort; propagate error)
-	if perr := s.store.SaveCalculation(items, total, packCount, counts); perr != nil {
+	return t.Solve(ctx, items)
+}
+
+// explain is calc.Explain through the cached table of packs.
+func (s *Service) explain(ctx context.Context, items int, packs []int, stock map[int]int) (calc.Explanation, error) {
+	t, err := s.table(ctx, packs)
+	if err != nil {
+		return calc.Explanation{}, err
+	}
+	return t.Explain(ctx, items, stock)
+}
+
+// table returns the cached table of packs, building it when missing.
+func (s *Service) table(ctx context.Context, packs []int) (t *calc.Table, err error) {
+	key := packsKey(packs)
+	s.mu.Lock()
+	t = s.tables[key]
+	s.mu.Unlock()
+	if t != nil {
+		return t, nil
+	}
+	// built outside the lock; a concurrent build of the same packs only
+	// wastes work
+	trace.SpanFromContext(ctx).AddEvent("build table")
+	if t, err = calc.NewTable(ctx, packs); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	if s.tables == nil || len(s.tables) >= maxTables {
+		s.tables = make(map[string]*calc.Table)
+	}
+	s.tables[key] = t
+	s.mu.Unlock()
+	s.updateTableEntries()
+	return t, nil
+}
+
+// LimitsPacks reports whether stock limits any of packs; sizes missing from
+// stock are unlimited.
+func LimitsPacks(stock map[int]int, packs []int) bool {
+	for _, p := range packs {
+		if _, ok := stock[p]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkItems rejects orders above SolverLimits.MaxItems and, when why names
+// a solver whose memory grows with the order, above MaxTarget.
+func (s *Service) checkItems(items int, why string) error {
+	if s.solver.MaxItems > 0 && items > s.solver.MaxItems {
+		return fmt.Errorf("%w: %d items, at most %d", ErrTooManyItems, items, s.solver.MaxItems)
+	}
+	if why != "" && s.solver.MaxTarget > 0 && items > s.solver.MaxTarget {
+		return fmt.Errorf("%w: %d items, at most %d %s", ErrTooManyItems, items, s.solver.MaxTarget, why)
+	}
+	return nil
+}
+
+func (s *Service) resetTables() {
+	s.mu.Lock()
+	s.tables = nil
+	s.mu.Unlock()
+	tableEntries.Set(0)
+}
+
+// packsKey identifies a pack set regardless of order and duplicates.
+func packsKey(packs []int) string {
+	sorted := append([]int(nil), packs...)
+	sort.Ints(sorted)
+	var b strings.Builder
+	for i, p := range sorted {
+		if i > 0 && p == sorted[i-1] {
+			continue
+		}
+		b.WriteString(strconv.Itoa(p))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+func (s *Service) save(ctx context.Context, catalog, items, total, packCount int, counts map[int]int) (map[int]int, int, int, error) {
+	// persist result according to the policy; only strict fails here
+	if perr := s.persist(ctx, record{catalog: catalog, items: items, total: total, packCount: packCount, counts: counts}); perr != nil {
 		// return both results and error so caller can decide; here we return error
 		return counts, total, packCount, perr
 	}
@@ -1,17 +1,25 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"testing"
 
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
 	"github.com/svvictorelias/shipping-pack-backend/internal/store"
 )
 
+// packCatalog is an unversioned catalog of packs.
+func packCatalog(packs ...int) store.PackCatalog {
+	return store.PackCatalog{Packs: packs}
+}
+
 func TestServiceCalculatePersists(t *testing.T) {
+	ctx := context.Background()
 	mock := store.NewMockStore([]int{23, 31, 53})
 	svc := NewService(mock)
 
-	counts, total, _, err := svc.Calculate(500000, []int{23, 31, 53})
+	counts, total, _, err := svc.Calculate(ctx, 500000, packCatalog(23, 31, 53))
 	if err != nil {
 		t.Fatalf("calculate err: %v", err)
 	}
@@ -40,11 +48,12 @@ func TestServiceCalculatePersists(t *testing.T) {
 }
 
 func TestServiceGetAndSetPacks(t *testing.T) {
+	ctx := context.Background()
 	mock := store.NewMockStore([]int{100, 200})
 	svc := NewService(mock)
 
 	// GetPacks
-	got, err := svc.GetPacks()
+	got, err := svc.GetPacks(ctx)
 	if err != nil {
 		t.Fatalf("GetPacks err: %v", err)
 	}
@@ -54,10 +63,10 @@ func TestServiceGetAndSetPacks(t *testing.T) {
 
 	// SetPacks alters the state
 	newPacks := []int{10, 20, 30}
-	if err := svc.SetPacks(newPacks); err != nil {
+	if _, err := svc.SetPacks(ctx, newPacks); err != nil {
 		t.Fatalf("SetPacks err: %v", err)
 	}
-	got2, _ := svc.GetPacks()
+	got2, _ := svc.GetPacks(ctx)
 	if len(got2) != 3 {
 		t.Fatalf("expected 3 packs, got %d", len(got2))
 	}
@@ -66,36 +75,318 @@ func TestServiceGetAndSetPacks(t *testing.T) {
 // mock that always returns errors
 type errStore struct{}
 
-func (e *errStore) GetPacks() ([]int, error) { return nil, errors.New("fail GetPacks") }
-func (e *errStore) SetPacks([]int) error     { return errors.New("fail SetPacks") }
-func (e *errStore) SaveCalculation(int, int, int, map[int]int) error {
+func (e *errStore) GetPacks(context.Context) ([]int, error) { return nil, errors.New("fail GetPacks") }
+func (e *errStore) SetPacks(context.Context, []int) error   { return errors.New("fail SetPacks") }
+func (e *errStore) GetPackCosts(context.Context) (map[int]float64, error) {
+	return nil, errors.New("fail GetPackCosts")
+}
+func (e *errStore) SetPackCosts(context.Context, map[int]float64) error {
+	return errors.New("fail SetPackCosts")
+}
+func (e *errStore) GetSKUPacks(context.Context, string) ([]int, error) {
+	return nil, errors.New("fail GetSKUPacks")
+}
+func (e *errStore) SetSKUPacks(context.Context, string, []int) error {
+	return errors.New("fail SetSKUPacks")
+}
+func (e *errStore) SaveOrder(context.Context, []store.OrderLine) error {
+	return errors.New("fail SaveOrder")
+}
+func (e *errStore) ListCalculations(context.Context, store.CalculationFilter) ([]store.Calculation, error) {
+	return nil, errors.New("fail ListCalculations")
+}
+func (e *errStore) GetCalculation(context.Context, int) (store.Calculation, error) {
+	return store.Calculation{}, errors.New("fail GetCalculation")
+}
+func (e *errStore) ListPackCatalogs(context.Context) ([]store.PackCatalog, error) {
+	return nil, errors.New("fail ListPackCatalogs")
+}
+func (e *errStore) GetPackCatalog(context.Context, int) (store.PackCatalog, error) {
+	return store.PackCatalog{}, store.ErrNotFound
+}
+func (e *errStore) GetActivePackCatalog(context.Context) (store.PackCatalog, error) {
+	return store.PackCatalog{}, errors.New("fail GetActivePackCatalog")
+}
+func (e *errStore) ActivatePackCatalog(context.Context, int) error { return errors.New("db fail") }
+func (e *errStore) GetStock(context.Context) (map[int]int, error) {
+	return nil, errors.New("fail GetStock")
+}
+func (e *errStore) SetStock(context.Context, map[int]int) error { return errors.New("fail SetStock") }
+func (e *errStore) SaveCalculation(context.Context, int, int, int, int, map[int]int) error {
 	return errors.New("fail SaveCalculation")
 }
+func (e *errStore) CreateAPIKey(context.Context, store.APIKey, string) (store.APIKey, error) {
+	return store.APIKey{}, errors.New("fail CreateAPIKey")
+}
+func (e *errStore) GetAPIKeyByHash(context.Context, string) (store.APIKey, error) {
+	return store.APIKey{}, errors.New("fail GetAPIKeyByHash")
+}
+func (e *errStore) ListAPIKeys(context.Context) ([]store.APIKey, error) {
+	return nil, errors.New("fail ListAPIKeys")
+}
+func (e *errStore) RevokeAPIKey(context.Context, int) error { return errors.New("fail RevokeAPIKey") }
 
 func TestServiceCalculate_SaveFails(t *testing.T) {
+	ctx := context.Background()
 	svc := NewService(&errStore{})
 	// with errStore, SaveCalculation needs to fails
-	_, _, _, err := svc.Calculate(100, []int{10, 20})
+	_, _, _, err := svc.Calculate(ctx, 100, packCatalog(10, 20))
 	if err == nil {
 		t.Fatalf("expected error from SaveCalculation")
 	}
 }
 
 func TestServiceCalculate_InvalidInput(t *testing.T) {
+	ctx := context.Background()
 	mock := store.NewMockStore([]int{10})
 	svc := NewService(mock)
 	// call with target=0
-	_, _, _, err := svc.Calculate(0, []int{10})
-	if err == nil {
-		t.Fatalf("expected error for target=0")
+	_, _, _, err := svc.Calculate(ctx, 0, packCatalog(10))
+	if !errors.Is(err, calc.ErrInvalidTarget) {
+		t.Fatalf("expected ErrInvalidTarget for target=0, got %v", err)
 	}
 }
 
 func TestServiceCalculate_EmptyPacks(t *testing.T) {
+	ctx := context.Background()
 	mock := store.NewMockStore([]int{})
 	svc := NewService(mock)
-	_, _, _, err := svc.Calculate(100, []int{})
-	if err == nil {
-		t.Fatalf("expected error for empty packs")
+	_, _, _, err := svc.Calculate(ctx, 100, packCatalog())
+	if !errors.Is(err, calc.ErrNoPacks) {
+		t.Fatalf("expected ErrNoPacks for empty packs, got %v", err)
+	}
+}
+
+func TestServiceCalculateBounded(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 500, 1000, 2000, 5000})
+	svc := NewService(mock)
+
+	counts, total, _, err := svc.CalculateBounded(ctx, 20000, packCatalog(250, 500, 1000, 2000, 5000), map[int]int{5000: 3}, nil)
+	if err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	if total != 20000 || counts[5000] != 3 {
+		t.Fatalf("unexpected result: total=%d counts=%v", total, counts)
+	}
+	if mock.CountCalculations() != 1 {
+		t.Fatalf("expected calculation persisted")
+	}
+}
+
+func TestServiceCalculate_MaxItems(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 500})
+	svc := NewService(mock).WithSolverLimits(SolverLimits{MaxItems: 1000, MaxTarget: 1000})
+
+	if _, _, _, err := svc.Calculate(ctx, 1001, packCatalog(250, 500)); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems got %v", err)
+	}
+	if _, err := svc.SetSKUPacks(ctx, "A", []int{250, 500}); err != nil {
+		t.Fatalf("SetSKUPacks: %v", err)
+	}
+	if _, err := svc.CalculateOrder(ctx, []OrderLine{{SKU: "A", Items: 1001}}); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems from the order got %v", err)
+	}
+	if _, err := svc.Alternatives(ctx, 1001, []int{250, 500}, nil, 2); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems from alternatives got %v", err)
+	}
+	if _, err := svc.Explain(ctx, 1001, []int{250, 500}, nil); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems from explain got %v", err)
+	}
+	if _, total, _, err := svc.Calculate(ctx, 1000, packCatalog(250, 500)); err != nil || total != 1000 {
+		t.Fatalf("expected 1000 items to pass got %d, %v", total, err)
+	}
+}
+
+func TestServiceCalculateBounded_MaxTarget(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 500})
+	svc := NewService(mock).WithSolverLimits(SolverLimits{MaxTarget: 1000})
+
+	if _, _, _, err := svc.CalculateBounded(ctx, 1001, packCatalog(250, 500), map[int]int{500: 100}, nil); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems got %v", err)
+	}
+	if _, err := svc.Explain(ctx, 1001, []int{250, 500}, map[int]int{500: 100}); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems from Explain got %v", err)
+	}
+	// stock of sizes outside the set limits nothing, so the residue solver runs
+	if _, total, _, err := svc.CalculateBounded(ctx, 500_000_001, packCatalog(250, 500), map[int]int{1000: 1}, nil); err != nil || total != 500_000_250 {
+		t.Fatalf("expected unlimited order to pass got %d, %v", total, err)
+	}
+	if mock.CountCalculations() != 1 {
+		t.Fatalf("expected only the unlimited calculation persisted")
+	}
+}
+
+func TestServiceCalculateWithObjective_MaxTarget(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 500})
+	svc := NewService(mock).WithSolverLimits(SolverLimits{MaxTarget: 1000})
+	obj := calc.CostObjective{PackCosts: map[int]float64{250: 1, 500: 1.5}}
+
+	if _, _, _, err := svc.CalculateWithObjective(ctx, 1001, packCatalog(250, 500), obj); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems got %v", err)
+	}
+	if _, _, _, err := svc.CalculateBounded(ctx, 1001, packCatalog(250, 500), nil, obj); !errors.Is(err, ErrTooManyItems) {
+		t.Fatalf("expected ErrTooManyItems without stock got %v", err)
+	}
+	if _, total, _, err := svc.CalculateWithObjective(ctx, 1000, packCatalog(250, 500), obj); err != nil || total != 1000 {
+		t.Fatalf("expected 1000 items to pass got %d, %v", total, err)
+	}
+}
+
+func TestServiceObjective(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 1000})
+	_ = mock.SetPackCosts(ctx, map[int]float64{1000: 2})
+	svc := NewService(mock)
+	catalog, err := svc.ActiveCatalog(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// costs written after the snapshot do not leak into it
+	_ = mock.SetPackCosts(ctx, map[int]float64{1000: 7})
+
+	obj, err := svc.Objective("", 0, catalog)
+	if err != nil || obj != nil {
+		t.Fatalf("expected default objective, got %v, %v", obj, err)
+	}
+	obj, err = svc.Objective(ObjectiveMixed, 0.5, catalog)
+	if err != nil {
+		t.Fatalf("Objective err: %v", err)
+	}
+	if obj.PackCost(1000) != 2 || obj.WasteCost(2) != 1 {
+		t.Fatalf("unexpected objective %#v", obj)
+	}
+	if _, err := svc.Objective("cheapest", 0, catalog); !errors.Is(err, ErrInvalidObjective) {
+		t.Fatalf("expected ErrInvalidObjective got %v", err)
+	}
+}
+
+func TestServiceCalculateOrder(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore(nil)
+	_ = mock.SetSKUPacks(ctx, "A", []int{250, 500})
+	_ = mock.SetSKUPacks(ctx, "B", []int{23, 31, 53})
+	svc := NewService(mock)
+
+	lines, err := svc.CalculateOrder(ctx, []OrderLine{{SKU: "A", Items: 251}, {SKU: "B", Items: 53}})
+	if err != nil {
+		t.Fatalf("CalculateOrder err: %v", err)
+	}
+	if lines[0].TotalItems != 500 || lines[1].TotalItems != 53 {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+	if mock.CountCalculations() != 1 {
+		t.Fatalf("expected the order saved as one calculation, got %d", mock.CountCalculations())
+	}
+
+	_, err = svc.CalculateOrder(ctx, []OrderLine{{SKU: "C", Items: 1}})
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown sku, got %v", err)
+	}
+}
+
+func TestServiceDiffPackCatalogs(t *testing.T) {
+	ctx := context.Background()
+	mock := store.NewMockStore([]int{250, 500, 1000})
+	svc := NewService(mock)
+	_ = svc.SetPackCosts(ctx, map[int]float64{500: 1.1})
+	_ = mock.SetPacks(ctx, []int{500, 2000})
+	_ = svc.SetPackCosts(ctx, map[int]float64{500: 1.4})
+
+	d, err := svc.DiffPackCatalogs(ctx, 2, 4)
+	if err != nil {
+		t.Fatalf("DiffPackCatalogs err: %v", err)
+	}
+	if len(d.Added) != 1 || d.Added[0] != 2000 || len(d.Removed) != 2 || d.Removed[0] != 250 {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+	if len(d.Costs) != 1 || d.Costs[0] != (CostChange{Size: 500, From: 1.1, To: 1.4}) {
+		t.Fatalf("unexpected cost changes: %+v", d.Costs)
+	}
+	if _, err := svc.DiffPackCatalogs(ctx, 1, 9); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+// countingStore counts GetActivePackCatalog calls.
+type countingStore struct {
+	*store.MockStore
+	getCatalog int
+}
+
+func (c *countingStore) GetActivePackCatalog(ctx context.Context) (store.PackCatalog, error) {
+	c.getCatalog++
+	return c.MockStore.GetActivePackCatalog(ctx)
+}
+
+func TestServiceCalculateBatch(t *testing.T) {
+	ctx := context.Background()
+	cs := &countingStore{MockStore: store.NewMockStore([]int{250, 500, 1000})}
+	svc := NewService(cs)
+
+	in := make(chan BatchItem)
+	results, err := svc.CalculateBatch(ctx, in, 3)
+	if err != nil {
+		t.Fatalf("CalculateBatch err: %v", err)
+	}
+	go func() {
+		defer close(in)
+		for i, items := range []int{251, 0, 1000, 12001} {
+			in <- BatchItem{Ref: i, Items: items}
+		}
+		in <- BatchItem{Ref: 4, Err: errors.New("bad line")}
+	}()
+
+	got := map[int]BatchResult{}
+	for res := range results {
+		got[res.Ref.(int)] = res
+	}
+	if len(got) != 5 {
+		t.Fatalf("expected 5 results got %d", len(got))
+	}
+	if got[0].Err != nil || got[0].Total != 500 || got[3].Total != 12250 {
+		t.Fatalf("unexpected results: %+v", got)
+	}
+	if got[1].Err == nil || got[4].Err == nil {
+		t.Fatalf("expected per-line errors, got %+v %+v", got[1], got[4])
+	}
+	if cs.getCatalog != 1 || cs.CountCalculations() != 3 {
+		t.Fatalf("expected the catalog fetched once and 3 saves, got %d and %d", cs.getCatalog, cs.CountCalculations())
+	}
+	if calcs, _ := cs.ListCalculations(ctx, store.CalculationFilter{}); calcs[0].CatalogVersion != 1 {
+		t.Fatalf("expected calculations linked to version 1 got %+v", calcs[0])
+	}
+
+	if _, err := NewService(&errStore{}).CalculateBatch(ctx, in, 1); err == nil {
+		t.Fatal("expected error when packs cannot be fetched")
+	}
+}
+
+func TestServiceCalculateReusesTable(t *testing.T) {
+	ctx := context.Background()
+	svc := NewService(store.NewMockStore([]int{23, 31, 53}))
+
+	if _, _, _, err := svc.Calculate(ctx, 263, packCatalog(23, 31, 53)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	_, total, _, err := svc.Calculate(ctx, 500000, packCatalog(53, 31, 23, 53))
+	if err != nil || total != 500000 {
+		t.Fatalf("calculate: got %d, %v", total, err)
+	}
+	if e, err := svc.Explain(ctx, 24, []int{31, 23, 53}, nil); err != nil || e.MinimalTotal != 31 {
+		t.Fatalf("explain: got %+v, %v", e, err)
+	}
+	if len(svc.tables) != 1 {
+		t.Fatalf("expected one cached table got %d", len(svc.tables))
+	}
+
+	if _, err := svc.SetPacks(ctx, []int{250, 500}); err != nil {
+		t.Fatalf("SetPacks err: %v", err)
+	}
+	if len(svc.tables) != 0 {
+		t.Fatalf("expected tables dropped after SetPacks, got %d", len(svc.tables))
 	}
 }
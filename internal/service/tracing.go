@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/svvictorelias/shipping-pack-backend/internal/service"
+
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startSolver starts the span of a run of solver for items against packs,
+// named calc.<solver> and carrying the target and the number of pack sizes.
+// The returned function ends it, adding the pack count of the solution when
+// there is one, and records its duration.
+func startSolver(ctx context.Context, solver string, items int, packs []int) (context.Context, func(packCount int, err error)) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "calc."+solver,
+		attribute.Int("calc.target", items),
+		attribute.Int("calc.pack_sizes", len(packs)))
+	return ctx, func(packCount int, err error) {
+		observeSolver(solver, start)
+		if packCount > 0 {
+			span.SetAttributes(attribute.Int("calc.pack_count", packCount))
+		}
+		tracing.End(span, err)
+	}
+}
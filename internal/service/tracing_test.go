@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/calc"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestServiceSpans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	svc := NewService(store.NewMockStore([]int{23, 31, 53}))
+	if _, _, _, err := svc.Calculate(context.Background(), 263, packCatalog(23, 31, 53)); err != nil {
+		t.Fatalf("calculate err: %v", err)
+	}
+	spans := sr.Ended()
+	if len(spans) != 2 || spans[0].Name() != "calc.table" || spans[1].Name() != "Service.Calculate" {
+		t.Fatalf("expected calc.table within Service.Calculate got %v", spans)
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Fatal("expected calc.table to be a child of Service.Calculate")
+	}
+	attrs := attribute.NewSet(spans[0].Attributes()...)
+	for key, want := range map[attribute.Key]int64{"calc.target": 263, "calc.pack_sizes": 3, "calc.pack_count": 9} {
+		if v, _ := attrs.Value(key); v.AsInt64() != want {
+			t.Errorf("%s: expected %d got %v", key, want, v.Emit())
+		}
+	}
+
+	_, _, _, err := svc.CalculateWithObjective(context.Background(), 10, packCatalog(0), nil)
+	if !errors.Is(err, calc.ErrInvalidPackSize) {
+		t.Fatalf("expected ErrInvalidPackSize got %v", err)
+	}
+	spans = sr.Ended()[2:]
+	if len(spans) != 2 || spans[0].Name() != "calc.objective" || spans[1].Name() != "Service.CalculateWithObjective" {
+		t.Fatalf("expected calc.objective within Service.CalculateWithObjective got %v", spans)
+	}
+	for _, s := range spans {
+		if s.Status().Code != codes.Error {
+			t.Errorf("%s: expected an error status got %+v", s.Name(), s.Status())
+		}
+	}
+}
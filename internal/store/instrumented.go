@@ -0,0 +1,172 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+const tracerName = "github.com/svvictorelias/shipping-pack-backend/internal/store"
+
+var (
+	opDuration = metrics.Default.NewHistogramVec("packcalc_store_operation_duration_seconds",
+		"Store operation latency, by Store method.", metrics.DefBuckets, "method")
+	opErrors = metrics.Default.NewCounterVec("packcalc_store_errors_total",
+		"Failed store operations, by Store method. ErrNotFound is not a failure.", "method")
+)
+
+// Instrument wraps s so that every call is timed and counted in the
+// packcalc_store_* metrics, and traced in a span named Store.<method>.
+func Instrument(s Store) Store {
+	return instrumented{s}
+}
+
+type instrumented struct {
+	s Store
+}
+
+// begin starts a call of method. The returned function ends it with the
+// error the call returned.
+func begin(ctx context.Context, method string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "Store."+method)
+	return ctx, func(err error) {
+		observe(method, start, err)
+		if errors.Is(err, ErrNotFound) {
+			err = nil // an answer, not a failure
+		}
+		tracing.End(span, err)
+	}
+}
+
+// observe records a call of method that started at start and returned err.
+func observe(method string, start time.Time, err error) {
+	opDuration.Observe(time.Since(start).Seconds(), method)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		opErrors.Inc(method)
+	}
+}
+
+func (i instrumented) GetPacks(ctx context.Context) (packs []int, err error) {
+	ctx, done := begin(ctx, "GetPacks")
+	defer func() { done(err) }()
+	return i.s.GetPacks(ctx)
+}
+
+func (i instrumented) SetPacks(ctx context.Context, packs []int) (err error) {
+	ctx, done := begin(ctx, "SetPacks")
+	defer func() { done(err) }()
+	return i.s.SetPacks(ctx, packs)
+}
+
+func (i instrumented) GetPackCosts(ctx context.Context) (costs map[int]float64, err error) {
+	ctx, done := begin(ctx, "GetPackCosts")
+	defer func() { done(err) }()
+	return i.s.GetPackCosts(ctx)
+}
+
+func (i instrumented) SetPackCosts(ctx context.Context, costs map[int]float64) (err error) {
+	ctx, done := begin(ctx, "SetPackCosts")
+	defer func() { done(err) }()
+	return i.s.SetPackCosts(ctx, costs)
+}
+
+func (i instrumented) ListPackCatalogs(ctx context.Context) (catalogs []PackCatalog, err error) {
+	ctx, done := begin(ctx, "ListPackCatalogs")
+	defer func() { done(err) }()
+	return i.s.ListPackCatalogs(ctx)
+}
+
+func (i instrumented) GetPackCatalog(ctx context.Context, version int) (catalog PackCatalog, err error) {
+	ctx, done := begin(ctx, "GetPackCatalog")
+	defer func() { done(err) }()
+	return i.s.GetPackCatalog(ctx, version)
+}
+
+func (i instrumented) GetActivePackCatalog(ctx context.Context) (c PackCatalog, err error) {
+	ctx, done := begin(ctx, "GetActivePackCatalog")
+	defer func() { done(err) }()
+	return i.s.GetActivePackCatalog(ctx)
+}
+
+func (i instrumented) ActivatePackCatalog(ctx context.Context, version int) (err error) {
+	ctx, done := begin(ctx, "ActivatePackCatalog")
+	defer func() { done(err) }()
+	return i.s.ActivatePackCatalog(ctx, version)
+}
+
+func (i instrumented) SaveCalculation(ctx context.Context, catalogVersion int, items int, totalItems int, packCount int, counts map[int]int) (err error) {
+	ctx, done := begin(ctx, "SaveCalculation")
+	defer func() { done(err) }()
+	return i.s.SaveCalculation(ctx, catalogVersion, items, totalItems, packCount, counts)
+}
+
+func (i instrumented) GetSKUPacks(ctx context.Context, sku string) (packs []int, err error) {
+	ctx, done := begin(ctx, "GetSKUPacks")
+	defer func() { done(err) }()
+	return i.s.GetSKUPacks(ctx, sku)
+}
+
+func (i instrumented) SetSKUPacks(ctx context.Context, sku string, packs []int) (err error) {
+	ctx, done := begin(ctx, "SetSKUPacks")
+	defer func() { done(err) }()
+	return i.s.SetSKUPacks(ctx, sku, packs)
+}
+
+func (i instrumented) SaveOrder(ctx context.Context, lines []OrderLine) (err error) {
+	ctx, done := begin(ctx, "SaveOrder")
+	defer func() { done(err) }()
+	return i.s.SaveOrder(ctx, lines)
+}
+
+func (i instrumented) ListCalculations(ctx context.Context, f CalculationFilter) (calcs []Calculation, err error) {
+	ctx, done := begin(ctx, "ListCalculations")
+	defer func() { done(err) }()
+	return i.s.ListCalculations(ctx, f)
+}
+
+func (i instrumented) GetCalculation(ctx context.Context, id int) (c Calculation, err error) {
+	ctx, done := begin(ctx, "GetCalculation")
+	defer func() { done(err) }()
+	return i.s.GetCalculation(ctx, id)
+}
+
+func (i instrumented) GetStock(ctx context.Context) (stock map[int]int, err error) {
+	ctx, done := begin(ctx, "GetStock")
+	defer func() { done(err) }()
+	return i.s.GetStock(ctx)
+}
+
+func (i instrumented) SetStock(ctx context.Context, stock map[int]int) (err error) {
+	ctx, done := begin(ctx, "SetStock")
+	defer func() { done(err) }()
+	return i.s.SetStock(ctx, stock)
+}
+
+func (i instrumented) CreateAPIKey(ctx context.Context, key APIKey, hash string) (created APIKey, err error) {
+	ctx, done := begin(ctx, "CreateAPIKey")
+	defer func() { done(err) }()
+	return i.s.CreateAPIKey(ctx, key, hash)
+}
+
+func (i instrumented) GetAPIKeyByHash(ctx context.Context, hash string) (key APIKey, err error) {
+	ctx, done := begin(ctx, "GetAPIKeyByHash")
+	defer func() { done(err) }()
+	return i.s.GetAPIKeyByHash(ctx, hash)
+}
+
+func (i instrumented) ListAPIKeys(ctx context.Context) (keys []APIKey, err error) {
+	ctx, done := begin(ctx, "ListAPIKeys")
+	defer func() { done(err) }()
+	return i.s.ListAPIKeys(ctx)
+}
+
+func (i instrumented) RevokeAPIKey(ctx context.Context, id int) (err error) {
+	ctx, done := begin(ctx, "RevokeAPIKey")
+	defer func() { done(err) }()
+	return i.s.RevokeAPIKey(ctx, id)
+}
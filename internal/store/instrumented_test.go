@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrument(t *testing.T) {
+	ctx := context.Background()
+	s := Instrument(NewMockStore([]int{100, 200}))
+
+	if packs, err := s.GetPacks(ctx); err != nil || len(packs) != 2 {
+		t.Fatalf("GetPacks through the wrapper: %v %v", packs, err)
+	}
+	if err := s.SetPackCosts(ctx, map[int]float64{300: 1}); err == nil {
+		t.Fatal("expected error for unknown size")
+	}
+	// not found is an answer, not a failure
+	if _, err := s.GetCalculation(ctx, 999); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+
+	var b strings.Builder
+	_ = metrics.Default.WriteText(&b)
+	out := b.String()
+	for _, want := range []string{
+		`packcalc_store_operation_duration_seconds_count{method="GetPacks"} 1`,
+		`packcalc_store_operation_duration_seconds_count{method="GetCalculation"} 1`,
+		`packcalc_store_errors_total{method="SetPackCosts"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `packcalc_store_errors_total{method="GetCalculation"}`) {
+		t.Fatalf("ErrNotFound counted as an error:\n%s", out)
+	}
+}
+
+func TestInstrument_Spans(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	ctx := context.Background()
+	s := Instrument(NewMockStore([]int{100, 200}))
+	_ = s.SaveCalculation(ctx, 1, 150, 200, 1, map[int]int{200: 1})
+	_ = s.SetPackCosts(ctx, map[int]float64{300: 1})
+	_, _ = s.GetCalculation(ctx, 999)
+
+	spans := sr.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans got %d", len(spans))
+	}
+	for i, want := range []struct {
+		name string
+		code codes.Code
+	}{
+		{"Store.SaveCalculation", codes.Unset},
+		{"Store.SetPackCosts", codes.Error},
+		{"Store.GetCalculation", codes.Unset}, // ErrNotFound
+	} {
+		if spans[i].Name() != want.name || spans[i].Status().Code != want.code {
+			t.Errorf("expected %s with status %v got %s with %v", want.name, want.code, spans[i].Name(), spans[i].Status().Code)
+		}
+	}
+}
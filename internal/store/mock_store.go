@@ -1,43 +1,165 @@
 package store
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+)
 
 // MockStore is a simple in-memory implementation of Store for unit tests.
 type MockStore struct {
 	mu           sync.RWMutex
-	packs        []int
+	catalogs     []mockCatalog // version i+1 is catalogs[i]
+	active       int
+	stock        map[int]int
+	skus         map[string][]int
 	calculations []mockCalc
+	apiKeys      []mockAPIKey // id i+1 is apiKeys[i]
+}
+
+type mockAPIKey struct {
+	key  APIKey
+	hash string
+}
+
+type mockCatalog struct {
+	createdAt time.Time
+	packs     []int
+	costs     map[int]float64
 }
 
 type mockCalc struct {
+	id        int
+	createdAt time.Time
 	items     int
 	total     int
 	packCount int
 	counts    map[int]int
+	lines     []OrderLine
+	catalog   int
+	requestID string
 }
 
-// NewMockStore constructs a mock store pre-seeded with packs.
+// NewMockStore constructs a mock store pre-seeded with packs as catalog version 1.
 func NewMockStore(packs []int) *MockStore {
-	return &MockStore{packs: packs}
+	m := &MockStore{}
+	m.addCatalog(packs, nil)
+	return m
+}
+
+func (m *MockStore) GetPacks(ctx context.Context) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	cur := m.catalogs[m.active-1]
+	out := make([]int, len(cur.packs))
+	copy(out, cur.packs)
+	return out, nil
+}
+
+func (m *MockStore) SetPacks(ctx context.Context, packs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur := m.catalogs[m.active-1]
+	costs := make(map[int]float64, len(packs))
+	for _, p := range packs {
+		costs[p] = cur.costs[p]
+	}
+	m.addCatalog(packs, costs)
+	return nil
 }
 
-func (m *MockStore) GetPacks() ([]int, error) {
+func (m *MockStore) GetPackCosts(ctx context.Context) (map[int]float64, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	out := make([]int, len(m.packs))
-	copy(out, m.packs)
+	cur := m.catalogs[m.active-1]
+	out := make(map[int]float64, len(cur.packs))
+	for _, p := range cur.packs {
+		out[p] = cur.costs[p]
+	}
+	return out, nil
+}
+
+func (m *MockStore) SetPackCosts(ctx context.Context, costs map[int]float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur := m.catalogs[m.active-1]
+	next := make(map[int]float64, len(cur.costs))
+	for k, v := range cur.costs {
+		next[k] = v
+	}
+	for size, cost := range costs {
+		if !containsInt(cur.packs, size) {
+			return fmt.Errorf("%w %d", ErrUnknownPackSize, size)
+		}
+		next[size] = cost
+	}
+	m.addCatalog(cur.packs, next)
+	return nil
+}
+
+func (m *MockStore) ListPackCatalogs(ctx context.Context) ([]PackCatalog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]PackCatalog, 0, len(m.catalogs))
+	for v := len(m.catalogs); v >= 1; v-- {
+		out = append(out, m.catalog(v))
+	}
 	return out, nil
 }
 
-func (m *MockStore) SetPacks(packs []int) error {
+func (m *MockStore) GetPackCatalog(ctx context.Context, version int) (PackCatalog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if version < 1 || version > len(m.catalogs) {
+		return PackCatalog{}, ErrNotFound
+	}
+	return m.catalog(version), nil
+}
+
+func (m *MockStore) GetActivePackCatalog(ctx context.Context) (PackCatalog, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.catalog(m.active), nil
+}
+
+func (m *MockStore) ActivatePackCatalog(ctx context.Context, version int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.packs = make([]int, len(packs))
-	copy(m.packs, packs)
+	if version < 1 || version > len(m.catalogs) {
+		return ErrNotFound
+	}
+	m.active = version
 	return nil
 }
 
-func (m *MockStore) SaveCalculation(items int, totalItems int, packCount int, counts map[int]int) error {
+// addCatalog appends a version and makes it active; callers hold mu.
+func (m *MockStore) addCatalog(packs []int, costs map[int]float64) {
+	c := mockCatalog{createdAt: time.Now().UTC(), packs: distinctSorted(packs), costs: costs}
+	m.catalogs = append(m.catalogs, c)
+	m.active = len(m.catalogs)
+}
+
+// catalog builds the PackCatalog of version; callers hold mu.
+func (m *MockStore) catalog(version int) PackCatalog {
+	c := m.catalogs[version-1]
+	out := PackCatalog{
+		Version:   version,
+		CreatedAt: c.createdAt,
+		Active:    version == m.active,
+		Packs:     make([]int, len(c.packs)),
+		Costs:     make(map[int]float64, len(c.packs)),
+	}
+	copy(out.Packs, c.packs)
+	for _, p := range c.packs {
+		out.Costs[p] = c.costs[p]
+	}
+	return out
+}
+
+func (m *MockStore) SaveCalculation(ctx context.Context, catalogVersion int, items int, totalItems int, packCount int, counts map[int]int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	cpy := make(map[int]int)
@@ -45,14 +167,186 @@ func (m *MockStore) SaveCalculation(items int, totalItems int, packCount int, co
 		cpy[k] = v
 	}
 	m.calculations = append(m.calculations, mockCalc{
+		id:        len(m.calculations) + 1,
+		createdAt: time.Now().UTC(),
 		items:     items,
 		total:     totalItems,
 		packCount: packCount,
 		counts:    cpy,
+		catalog:   catalogVersion,
+		requestID: requestid.FromContext(ctx),
 	})
 	return nil
 }
 
+func (m *MockStore) GetStock(ctx context.Context) (map[int]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make(map[int]int, len(m.stock))
+	for k, v := range m.stock {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (m *MockStore) SetStock(ctx context.Context, stock map[int]int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stock = make(map[int]int, len(stock))
+	for k, v := range stock {
+		m.stock[k] = v
+	}
+	return nil
+}
+
+func (m *MockStore) GetSKUPacks(ctx context.Context, sku string) ([]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	packs, ok := m.skus[sku]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	out := make([]int, len(packs))
+	copy(out, packs)
+	return out, nil
+}
+
+func (m *MockStore) SetSKUPacks(ctx context.Context, sku string, packs []int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.skus == nil {
+		m.skus = make(map[string][]int)
+	}
+	m.skus[sku] = distinctSorted(packs)
+	return nil
+}
+
+func (m *MockStore) SaveOrder(ctx context.Context, lines []OrderLine) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := mockCalc{
+		id:        len(m.calculations) + 1,
+		createdAt: time.Now().UTC(),
+		lines:     make([]OrderLine, len(lines)),
+		requestID: requestid.FromContext(ctx),
+	}
+	for i, l := range lines {
+		cpy := make(map[int]int, len(l.Counts))
+		for k, v := range l.Counts {
+			cpy[k] = v
+		}
+		l.Counts = cpy
+		c.lines[i] = l
+		c.items += l.Items
+		c.total += l.TotalItems
+		c.packCount += l.PackCount
+	}
+	m.calculations = append(m.calculations, c)
+	return nil
+}
+
+func (m *MockStore) ListCalculations(ctx context.Context, f CalculationFilter) ([]Calculation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Calculation{}
+	for i := len(m.calculations) - 1; i >= 0; i-- {
+		c := m.calculations[i]
+		switch {
+		case f.Before > 0 && c.id >= f.Before,
+			!f.From.IsZero() && c.createdAt.Before(f.From),
+			!f.To.IsZero() && !c.createdAt.Before(f.To),
+			f.MinItems > 0 && c.items < f.MinItems,
+			f.MaxItems > 0 && c.items > f.MaxItems,
+			f.RequestID != "" && c.requestID != f.RequestID:
+			continue
+		}
+		out = append(out, Calculation{ID: c.id, Items: c.items, TotalItems: c.total, PackCount: c.packCount, CreatedAt: c.createdAt, CatalogVersion: c.catalog, RequestID: c.requestID})
+		if f.Limit > 0 && len(out) == f.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (m *MockStore) GetCalculation(ctx context.Context, id int) (Calculation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if id < 1 || id > len(m.calculations) {
+		return Calculation{}, ErrNotFound
+	}
+	c := m.calculations[id-1]
+	out := Calculation{ID: c.id, Items: c.items, TotalItems: c.total, PackCount: c.packCount, CreatedAt: c.createdAt, CatalogVersion: c.catalog, RequestID: c.requestID}
+	if c.lines != nil {
+		out.Lines = make([]OrderLine, len(c.lines))
+		for i, l := range c.lines {
+			l.Counts = copyCounts(l.Counts)
+			out.Lines[i] = l
+		}
+	} else {
+		out.Counts = copyCounts(c.counts)
+	}
+	return out, nil
+}
+
+func (m *MockStore) CreateAPIKey(ctx context.Context, key APIKey, hash string) (APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range m.apiKeys {
+		if k.hash == hash {
+			return APIKey{}, fmt.Errorf("duplicate api key hash")
+		}
+	}
+	key.ID = len(m.apiKeys) + 1
+	key.CreatedAt = time.Now().UTC()
+	key.RevokedAt = time.Time{}
+	key.Scopes = append([]string(nil), key.Scopes...)
+	m.apiKeys = append(m.apiKeys, mockAPIKey{key: key, hash: hash})
+	return key, nil
+}
+
+func (m *MockStore) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, k := range m.apiKeys {
+		if k.hash == hash && k.key.RevokedAt.IsZero() {
+			return copyAPIKey(k.key), nil
+		}
+	}
+	return APIKey{}, ErrNotFound
+}
+
+func (m *MockStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]APIKey, len(m.apiKeys))
+	for i, k := range m.apiKeys {
+		out[i] = copyAPIKey(k.key)
+	}
+	return out, nil
+}
+
+func (m *MockStore) RevokeAPIKey(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > len(m.apiKeys) || !m.apiKeys[id-1].key.RevokedAt.IsZero() {
+		return ErrNotFound
+	}
+	m.apiKeys[id-1].key.RevokedAt = time.Now().UTC()
+	return nil
+}
+
+// LastOrder returns the lines of the last saved calculation, ok == false
+// when there is none or it was not a multi-line order.
+func (m *MockStore) LastOrder() (lines []OrderLine, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.calculations) == 0 || m.calculations[len(m.calculations)-1].lines == nil {
+		return nil, false
+	}
+	last := m.calculations[len(m.calculations)-1]
+	return append([]OrderLine(nil), last.lines...), true
+}
+
 // CountCalculations returns how many calculations have been saved.
 // Exported so tests in other packages can assert persistence behavior.
 func (m *MockStore) CountCalculations() int {
@@ -77,3 +371,27 @@ func (m *MockStore) LastCalculation() (items int, total int, packCount int, coun
 	}
 	return last.items, last.total, last.packCount, cpy, true
 }
+
+func containsInt(xs []int, v int) bool {
+	for _, x := range xs {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+func copyCounts(counts map[int]int) map[int]int {
+	cpy := make(map[int]int, len(counts))
+	for k, v := range counts {
+		cpy[k] = v
+	}
+	return cpy
+}
+
+// copyAPIKey copies k as read back from the database, where no scopes
+// are an empty list.
+func copyAPIKey(k APIKey) APIKey {
+	k.Scopes = append([]string{}, k.Scopes...)
+	return k
+}
@@ -1,10 +1,17 @@
 package store
 
-import "testing"
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+)
 
 func TestMockStore_GetAndSetPacks(t *testing.T) {
+	ctx := context.Background()
 	ms := NewMockStore([]int{100, 200})
-	packs, err := ms.GetPacks()
+	packs, err := ms.GetPacks(ctx)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -13,21 +20,64 @@ func TestMockStore_GetAndSetPacks(t *testing.T) {
 	}
 
 	newPacks := []int{10, 20, 30}
-	if err := ms.SetPacks(newPacks); err != nil {
+	if err := ms.SetPacks(ctx, newPacks); err != nil {
 		t.Fatalf("SetPacks error: %v", err)
 	}
 
-	got, _ := ms.GetPacks()
+	got, _ := ms.GetPacks(ctx)
 	if len(got) != 3 {
 		t.Fatalf("expected 3 packs got %d", len(got))
 	}
 }
 
+func TestMockStore_PackCosts(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore([]int{100, 200})
+	if err := ms.SetPackCosts(ctx, map[int]float64{200: 1.5}); err != nil {
+		t.Fatalf("SetPackCosts error: %v", err)
+	}
+	costs, _ := ms.GetPackCosts(ctx)
+	if costs[200] != 1.5 || costs[100] != 0 || len(costs) != 2 {
+		t.Fatalf("unexpected costs: %v", costs)
+	}
+	if err := ms.SetPackCosts(ctx, map[int]float64{300: 1}); err == nil {
+		t.Fatal("expected error for unknown pack size")
+	}
+
+	// replacing the pack set keeps the costs of the sizes that stay
+	_ = ms.SetPacks(ctx, []int{200, 400})
+	costs, _ = ms.GetPackCosts(ctx)
+	if costs[200] != 1.5 || costs[400] != 0 || len(costs) != 2 {
+		t.Fatalf("expected costs carried forward, got %v", costs)
+	}
+}
+
+func TestMockStore_GetAndSetStock(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore([]int{100, 200})
+	stock, err := ms.GetStock(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stock) != 0 {
+		t.Fatalf("expected empty stock got %v", stock)
+	}
+
+	if err := ms.SetStock(ctx, map[int]int{200: 3}); err != nil {
+		t.Fatalf("SetStock error: %v", err)
+	}
+	got, _ := ms.GetStock(ctx)
+	if got[200] != 3 || len(got) != 1 {
+		t.Fatalf("unexpected stock: %v", got)
+	}
+}
+
 func TestMockStore_SaveCalculationAndCount(t *testing.T) {
+	ctx := context.Background()
 	ms := NewMockStore([]int{50, 100})
 	counts := map[int]int{50: 2, 100: 3}
 
-	err := ms.SaveCalculation(450, 500, 5, counts)
+	err := ms.SaveCalculation(ctx, 1, 450, 500, 5, counts)
 	if err != nil {
 		t.Fatalf("SaveCalculation error: %v", err)
 	}
@@ -47,3 +97,135 @@ func TestMockStore_SaveCalculationAndCount(t *testing.T) {
 		t.Fatalf("expected 3 of 100, got %v", savedCounts)
 	}
 }
+
+func TestMockStore_SKUPacksAndSaveOrder(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore(nil)
+	if _, err := ms.GetSKUPacks(ctx, "A"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if err := ms.SetSKUPacks(ctx, "A", []int{20, 5}); err != nil {
+		t.Fatalf("SetSKUPacks error: %v", err)
+	}
+	packs, err := ms.GetSKUPacks(ctx, "A")
+	if err != nil || len(packs) != 2 || packs[0] != 5 {
+		t.Fatalf("unexpected packs %v, %v", packs, err)
+	}
+
+	lines := []OrderLine{
+		{SKU: "A", Items: 7, TotalItems: 10, PackCount: 2, Counts: map[int]int{5: 2}},
+		{SKU: "B", Items: 3, TotalItems: 4, PackCount: 1, Counts: map[int]int{4: 1}},
+	}
+	if err := ms.SaveOrder(ctx, lines); err != nil {
+		t.Fatalf("SaveOrder error: %v", err)
+	}
+	items, total, packCount, _, ok := ms.LastCalculation()
+	if !ok || items != 10 || total != 14 || packCount != 3 {
+		t.Fatalf("unexpected aggregate: %d %d %d", items, total, packCount)
+	}
+	saved, ok := ms.LastOrder()
+	if !ok || len(saved) != 2 || saved[1].SKU != "B" {
+		t.Fatalf("unexpected saved lines: %+v", saved)
+	}
+}
+
+func TestMockStore_ListAndGetCalculations(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore([]int{50})
+	for _, items := range []int{10, 60, 110} {
+		_ = ms.SaveCalculation(requestid.NewContext(ctx, fmt.Sprintf("req-%d", items)), 1, items, items+40, 1, map[int]int{50: 1})
+	}
+
+	page, err := ms.ListCalculations(ctx, CalculationFilter{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListCalculations error: %v", err)
+	}
+	if len(page) != 2 || page[0].ID != 3 || page[1].ID != 2 {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page, _ = ms.ListCalculations(ctx, CalculationFilter{Before: 2})
+	if len(page) != 1 || page[0].ID != 1 {
+		t.Fatalf("unexpected second page: %+v", page)
+	}
+	page, _ = ms.ListCalculations(ctx, CalculationFilter{MinItems: 50, MaxItems: 100})
+	if len(page) != 1 || page[0].Items != 60 {
+		t.Fatalf("unexpected filtered page: %+v", page)
+	}
+	page, _ = ms.ListCalculations(ctx, CalculationFilter{RequestID: "req-110"})
+	if len(page) != 1 || page[0].Items != 110 || page[0].RequestID != "req-110" {
+		t.Fatalf("unexpected page for request id: %+v", page)
+	}
+
+	c, err := ms.GetCalculation(ctx, 2)
+	if err != nil {
+		t.Fatalf("GetCalculation error: %v", err)
+	}
+	if c.Items != 60 || c.Counts[50] != 1 || c.RequestID != "req-60" {
+		t.Fatalf("unexpected calculation: %+v", c)
+	}
+	if _, err := ms.GetCalculation(ctx, 9); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func TestMockStore_PackCatalogVersions(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore([]int{100, 200})
+	_ = ms.SetPackCosts(ctx, map[int]float64{200: 1.5})
+	_ = ms.SetPacks(ctx, []int{50})
+	active, _ := ms.GetActivePackCatalog(ctx)
+	_ = ms.SaveCalculation(ctx, active.Version, 40, 50, 1, map[int]int{50: 1})
+
+	catalogs, _ := ms.ListPackCatalogs(ctx)
+	if len(catalogs) != 3 || catalogs[0].Version != 3 || !catalogs[0].Active || catalogs[1].Costs[200] != 1.5 {
+		t.Fatalf("unexpected catalogs: %+v", catalogs)
+	}
+	c, _ := ms.GetCalculation(ctx, 1)
+	if c.CatalogVersion != 3 {
+		t.Fatalf("expected calculation linked to version 3 got %d", c.CatalogVersion)
+	}
+
+	// rolling back restores sizes and costs of the old version
+	if err := ms.ActivatePackCatalog(ctx, 2); err != nil {
+		t.Fatalf("ActivatePackCatalog error: %v", err)
+	}
+	packs, _ := ms.GetPacks(ctx)
+	costs, _ := ms.GetPackCosts(ctx)
+	if len(packs) != 2 || costs[200] != 1.5 {
+		t.Fatalf("unexpected active catalog: %v %v", packs, costs)
+	}
+	if err := ms.ActivatePackCatalog(ctx, 9); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if _, err := ms.GetPackCatalog(ctx, 0); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func TestMockStore_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	ms := NewMockStore([]int{100})
+	key, err := ms.CreateAPIKey(ctx, APIKey{Name: "ci", Scopes: []string{"calculate"}}, "h1")
+	if err != nil || key.ID != 1 || key.CreatedAt.IsZero() {
+		t.Fatalf("CreateAPIKey: %+v %v", key, err)
+	}
+	if _, err := ms.CreateAPIKey(ctx, APIKey{Name: "dup"}, "h1"); err == nil {
+		t.Fatalf("expected duplicate hash rejected")
+	}
+	if got, err := ms.GetAPIKeyByHash(ctx, "h1"); err != nil || got.Name != "ci" {
+		t.Fatalf("GetAPIKeyByHash: %+v %v", got, err)
+	}
+	if err := ms.RevokeAPIKey(ctx, 1); err != nil {
+		t.Fatalf("RevokeAPIKey error: %v", err)
+	}
+	if _, err := ms.GetAPIKeyByHash(ctx, "h1"); err != ErrNotFound {
+		t.Fatalf("expected revoked key not found, got %v", err)
+	}
+	if err := ms.RevokeAPIKey(ctx, 1); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound on second revoke got %v", err)
+	}
+	keys, _ := ms.ListAPIKeys(ctx)
+	if len(keys) != 1 || keys[0].RevokedAt.IsZero() {
+		t.Fatalf("unexpected keys: %+v", keys)
+	}
+}
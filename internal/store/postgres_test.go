@@ -1,13 +1,17 @@
 package store
 
 import (
+	"context"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
 )
 
 func TestPostgresStore_GetPacks(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("error creating sqlmock: %v", err)
@@ -15,10 +19,10 @@ func TestPostgresStore_GetPacks(t *testing.T) {
 	defer db.Close()
 
 	rows := sqlmock.NewRows([]string{"size"}).AddRow(100).AddRow(200)
-	mock.ExpectQuery(regexp.QuoteMeta("SELECT size FROM packs ORDER BY size ASC")).WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size FROM pack_catalog_sizes WHERE version_id = (SELECT version_id FROM pack_catalog_active) ORDER BY size ASC")).WillReturnRows(rows)
 
 	store := NewPostgresStore(db)
-	packs, err := store.GetPacks()
+	packs, err := store.GetPacks(ctx)
 	if err != nil {
 		t.Fatalf("GetPacks error: %v", err)
 	}
@@ -28,6 +32,7 @@ func TestPostgresStore_GetPacks(t *testing.T) {
 }
 
 func TestPostgresStore_SetPacks(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatal(err)
@@ -35,14 +40,24 @@ func TestPostgresStore_SetPacks(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectExec("DELETE FROM packs").WillReturnResult(sqlmock.NewResult(0, 0))
-	mock.ExpectPrepare("INSERT INTO packs").ExpectExec().
-		WithArgs(100, sqlmock.AnyArg()).
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version_id FROM pack_catalog_active FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows([]string{"version_id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"size", "cost"}).AddRow(100, 0.75).AddRow(250, 1.0))
+	mock.ExpectQuery("INSERT INTO pack_catalog_versions").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	// 100 stays and keeps its cost
+	mock.ExpectPrepare("INSERT INTO pack_catalog_sizes").ExpectExec().
+		WithArgs(2, 100, 0.75).
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE pack_catalog_active SET version_id = $1")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	store := NewPostgresStore(db)
-	err = store.SetPacks([]int{100})
+	err = store.SetPacks(ctx, []int{100})
 	if err != nil {
 		t.Fatalf("SetPacks error: %v", err)
 	}
@@ -53,6 +68,7 @@ func TestPostgresStore_SetPacks(t *testing.T) {
 }
 
 func TestPostgresStore_SaveCalculation(t *testing.T) {
+	ctx := context.Background()
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatal(err)
@@ -60,8 +76,8 @@ func TestPostgresStore_SaveCalculation(t *testing.T) {
 	defer db.Close()
 
 	mock.ExpectBegin()
-	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO calculations(items,total_items,pack_count,created_at) VALUES($1,$2,$3,$4) RETURNING id")).
-		WithArgs(450, 500, 5, sqlmock.AnyArg()).
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO calculations(items,total_items,pack_count,created_at,catalog_version,request_id) VALUES($1,$2,$3,$4,NULLIF($5,0),NULLIF($6,'')) RETURNING id")).
+		WithArgs(450, 500, 5, sqlmock.AnyArg(), 3, "req-1").
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	mock.ExpectPrepare("INSERT INTO calculation_items").
@@ -72,7 +88,7 @@ func TestPostgresStore_SaveCalculation(t *testing.T) {
 	mock.ExpectCommit()
 
 	store := NewPostgresStore(db)
-	err = store.SaveCalculation(450, 500, 5, map[int]int{100: 2})
+	err = store.SaveCalculation(requestid.NewContext(ctx, "req-1"), 3, 450, 500, 5, map[int]int{100: 2})
 	if err != nil {
 		t.Fatalf("SaveCalculation error: %v", err)
 	}
@@ -81,3 +97,452 @@ func TestPostgresStore_SaveCalculation(t *testing.T) {
 		t.Errorf("unmet expectations: %v", err)
 	}
 }
+
+func TestPostgresStore_GetStock(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"pack_size", "quantity"}).AddRow(5000, 3)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pack_size, quantity FROM inventory")).WillReturnRows(rows)
+
+	store := NewPostgresStore(db)
+	stock, err := store.GetStock(ctx)
+	if err != nil {
+		t.Fatalf("GetStock error: %v", err)
+	}
+	if len(stock) != 1 || stock[5000] != 3 {
+		t.Fatalf("unexpected stock: %v", stock)
+	}
+}
+
+func TestPostgresStore_SetStock(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM inventory").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectPrepare("INSERT INTO inventory").ExpectExec().
+		WithArgs(5000, 3, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	store := NewPostgresStore(db)
+	if err := store.SetStock(ctx, map[int]int{5000: 3}); err != nil {
+		t.Fatalf("SetStock error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_GetPackCosts(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	rows := sqlmock.NewRows([]string{"size", "cost"}).AddRow(250, 1.25).AddRow(500, 2.0)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = (SELECT version_id FROM pack_catalog_active) ORDER BY size ASC")).WillReturnRows(rows)
+
+	store := NewPostgresStore(db)
+	costs, err := store.GetPackCosts(ctx)
+	if err != nil {
+		t.Fatalf("GetPackCosts error: %v", err)
+	}
+	if len(costs) != 2 || costs[250] != 1.25 || costs[500] != 2 {
+		t.Fatalf("unexpected costs: %v", costs)
+	}
+}
+
+func TestPostgresStore_SetPackCosts(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	expectActive := func() {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT version_id FROM pack_catalog_active FOR UPDATE")).
+			WillReturnRows(sqlmock.NewRows([]string{"version_id"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1")).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"size", "cost"}).AddRow(250, 0.5).AddRow(500, 1.0))
+	}
+	expectActive()
+	mock.ExpectQuery("INSERT INTO pack_catalog_versions").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	prep := mock.ExpectPrepare("INSERT INTO pack_catalog_sizes")
+	prep.ExpectExec().WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	prep.ExpectExec().WithArgs(2, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE pack_catalog_active SET version_id = $1")).
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectActive()
+	mock.ExpectRollback()
+
+	store := NewPostgresStore(db)
+	if err := store.SetPackCosts(ctx, map[int]float64{250: 1.25}); err != nil {
+		t.Fatalf("SetPackCosts error: %v", err)
+	}
+	if err := store.SetPackCosts(ctx, map[int]float64{300: 1}); err == nil {
+		t.Fatal("expected error for unknown pack size")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_GetSKUPacks(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM skus WHERE code = $1")).
+		WithArgs("A").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size FROM sku_packs WHERE sku_id = $1 ORDER BY size ASC")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(5).AddRow(20))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM skus WHERE code = $1")).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	store := NewPostgresStore(db)
+	packs, err := store.GetSKUPacks(ctx, "A")
+	if err != nil {
+		t.Fatalf("GetSKUPacks error: %v", err)
+	}
+	if len(packs) != 2 || packs[0] != 5 || packs[1] != 20 {
+		t.Fatalf("unexpected packs: %v", packs)
+	}
+	if _, err := store.GetSKUPacks(ctx, "missing"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func TestPostgresStore_SetSKUPacks(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO skus").
+		WithArgs("A", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM sku_packs WHERE sku_id = $1")).
+		WithArgs(7).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	// sorted, each size once
+	mock.ExpectPrepare("INSERT INTO sku_packs").ExpectExec().
+		WithArgs(7, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("INSERT INTO sku_packs").
+		WithArgs(7, 5).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
+
+	store := NewPostgresStore(db)
+	if err := store.SetSKUPacks(ctx, "A", []int{5, 2, 5}); err != nil {
+		t.Fatalf("SetSKUPacks error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_SaveOrder(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO calculations(items,total_items,pack_count,created_at,request_id) VALUES($1,$2,$3,$4,NULLIF($5,'')) RETURNING id")).
+		WithArgs(7, 10, 2, sqlmock.AnyArg(), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	lineStmt := mock.ExpectPrepare("INSERT INTO calculation_lines")
+	itemStmt := mock.ExpectPrepare("INSERT INTO calculation_items")
+	lineStmt.ExpectExec().
+		WithArgs(3, "A", 7, 10, 2).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	itemStmt.ExpectExec().
+		WithArgs(3, 5, 2, "A").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	store := NewPostgresStore(db)
+	err = store.SaveOrder(ctx, []OrderLine{{SKU: "A", Items: 7, TotalItems: 10, PackCount: 2, Counts: map[int]int{5: 2}}})
+	if err != nil {
+		t.Fatalf("SaveOrder error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_ListCalculations(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	from := time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	created := time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, items, total_items, pack_count, created_at, catalog_version, request_id FROM calculations WHERE id < $1 AND created_at >= $2 AND items >= $3 AND request_id = $4 ORDER BY id DESC LIMIT $5")).
+		WithArgs(10, from, 100, "req-1", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "items", "total_items", "pack_count", "created_at", "catalog_version", "request_id"}).
+			AddRow(9, 450, 500, 2, created, 3, "req-1"))
+
+	store := NewPostgresStore(db)
+	calcs, err := store.ListCalculations(ctx, CalculationFilter{Before: 10, From: from, MinItems: 100, RequestID: "req-1", Limit: 2})
+	if err != nil {
+		t.Fatalf("ListCalculations error: %v", err)
+	}
+	if len(calcs) != 1 || calcs[0].ID != 9 || !calcs[0].CreatedAt.Equal(created) || calcs[0].CatalogVersion != 3 || calcs[0].RequestID != "req-1" {
+		t.Fatalf("unexpected calculations: %+v", calcs)
+	}
+}
+
+func TestPostgresStore_GetCalculation(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := time.Date(2025, 10, 2, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, items, total_items, pack_count, created_at, catalog_version, request_id FROM calculations WHERE id = $1")).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "items", "total_items", "pack_count", "created_at", "catalog_version", "request_id"}).
+			AddRow(3, 304, 553, 2, created, nil, nil))
+	mock.ExpectQuery("SELECT sku, items, total_items, pack_count FROM calculation_lines").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"sku", "items", "total_items", "pack_count"}).
+			AddRow("A", 251, 500, 1).
+			AddRow("B", 53, 53, 1))
+	mock.ExpectQuery("SELECT pack_size, quantity, sku FROM calculation_items").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"pack_size", "quantity", "sku"}).
+			AddRow(53, 1, "B").
+			AddRow(500, 1, "A"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, items, total_items, pack_count, created_at, catalog_version, request_id FROM calculations WHERE id = $1")).
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "items", "total_items", "pack_count", "created_at", "catalog_version", "request_id"}))
+
+	store := NewPostgresStore(db)
+	c, err := store.GetCalculation(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetCalculation error: %v", err)
+	}
+	if len(c.Lines) != 2 || c.Lines[0].Counts[500] != 1 || c.Lines[1].Counts[53] != 1 || c.Counts != nil {
+		t.Fatalf("unexpected calculation: %+v", c)
+	}
+	if _, err := store.GetCalculation(ctx, 4); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func TestPostgresStore_ListPackCatalogs(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "active"}).
+			AddRow(2, created, false).
+			AddRow(1, created, true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version_id, size, cost FROM pack_catalog_sizes ORDER BY version_id DESC, size ASC")).
+		WillReturnRows(sqlmock.NewRows([]string{"version_id", "size", "cost"}).
+			AddRow(2, 250, 0.0).
+			AddRow(1, 250, 1.5).
+			AddRow(1, 500, 2.0))
+
+	store := NewPostgresStore(db)
+	catalogs, err := store.ListPackCatalogs(ctx)
+	if err != nil {
+		t.Fatalf("ListPackCatalogs error: %v", err)
+	}
+	if len(catalogs) != 2 || catalogs[0].Version != 2 || catalogs[0].Active || len(catalogs[0].Packs) != 1 {
+		t.Fatalf("unexpected catalogs: %+v", catalogs)
+	}
+	if !catalogs[1].Active || len(catalogs[1].Packs) != 2 || catalogs[1].Costs[250] != 1.5 {
+		t.Fatalf("unexpected catalog 1: %+v", catalogs[1])
+	}
+}
+
+func TestPostgresStore_GetPackCatalog(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "active"}).AddRow(1, created, true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1 ORDER BY size ASC")).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"size", "cost"}).AddRow(250, 1.5).AddRow(500, 2.0))
+	mock.ExpectQuery("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v").
+		WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "active"}))
+
+	store := NewPostgresStore(db)
+	c, err := store.GetPackCatalog(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetPackCatalog error: %v", err)
+	}
+	if c.Version != 1 || !c.Active || len(c.Packs) != 2 || c.Costs[500] != 2 {
+		t.Fatalf("unexpected catalog: %+v", c)
+	}
+	if _, err := store.GetPackCatalog(ctx, 9); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func TestPostgresStore_GetActivePackCatalog(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	created := time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT version_id FROM pack_catalog_active")).
+		WillReturnRows(sqlmock.NewRows([]string{"version_id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v CROSS JOIN pack_catalog_active a WHERE v.id = $1")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "active"}).AddRow(2, created, true))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1 ORDER BY size ASC")).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"size", "cost"}).AddRow(250, 1.5))
+
+	store := NewPostgresStore(db)
+	c, err := store.GetActivePackCatalog(ctx)
+	if err != nil {
+		t.Fatalf("GetActivePackCatalog error: %v", err)
+	}
+	if c.Version != 2 || !c.Active || len(c.Packs) != 1 || c.Costs[250] != 1.5 {
+		t.Fatalf("unexpected catalog: %+v", c)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_ActivatePackCatalog(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE pack_catalog_active SET version_id").
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE pack_catalog_active SET version_id").
+		WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	store := NewPostgresStore(db)
+	if err := store.ActivatePackCatalog(ctx, 1); err != nil {
+		t.Fatalf("ActivatePackCatalog error: %v", err)
+	}
+	if err := store.ActivatePackCatalog(ctx, 9); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestPostgresStore_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO api_keys(name, prefix, key_hash, scopes, created_at) VALUES($1,$2,$3,$4,$5) RETURNING id")).
+		WithArgs("ci", "pk_abcdef", "hash1", "calculate,packs:read", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, prefix, scopes, created_at FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL")).
+		WithArgs("hash1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_at"}).AddRow(1, "ci", "pk_abcdef", "calculate,packs:read", now))
+	mock.ExpectQuery("SELECT id, name, prefix, scopes, created_at FROM api_keys").
+		WithArgs("nope").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_at"}))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").
+		WithArgs(sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT id, name, prefix, scopes, created_at, revoked_at FROM api_keys ORDER BY id ASC").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_at", "revoked_at"}).
+			AddRow(1, "ci", "pk_abcdef", "calculate,packs:read", now, now))
+
+	store := NewPostgresStore(db)
+	key, err := store.CreateAPIKey(ctx, APIKey{Name: "ci", Prefix: "pk_abcdef", Scopes: []string{"calculate", "packs:read"}}, "hash1")
+	if err != nil || key.ID != 1 || key.CreatedAt.IsZero() {
+		t.Fatalf("CreateAPIKey: %+v %v", key, err)
+	}
+	key, err = store.GetAPIKeyByHash(ctx, "hash1")
+	if err != nil || key.Name != "ci" || len(key.Scopes) != 2 || key.Scopes[1] != "packs:read" {
+		t.Fatalf("GetAPIKeyByHash: %+v %v", key, err)
+	}
+	if _, err := store.GetAPIKeyByHash(ctx, "nope"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if err := store.RevokeAPIKey(ctx, 1); err != nil {
+		t.Fatalf("RevokeAPIKey error: %v", err)
+	}
+	if err := store.RevokeAPIKey(ctx, 1); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound on second revoke got %v", err)
+	}
+	keys, err := store.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || keys[0].RevokedAt.IsZero() {
+		t.Fatalf("ListAPIKeys: %+v %v", keys, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,651 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+)
+
+// sqlStore implements Store using database/sql. Its statements are written
+// for Postgres; PostgresStore and SQLiteStore differ only in the fields
+// below that adapt them to their driver.
+type sqlStore struct {
+	db *sql.DB
+	// rebind rewrites the $N placeholders of a statement for the driver.
+	rebind func(query string) string
+	// lockActive selects the active catalog version, keeping other
+	// transactions from changing it until this one ends.
+	lockActive string
+}
+
+// q returns query with its placeholders rebound for the driver of s.
+func (s *sqlStore) q(query string) string {
+	return s.rebind(query)
+}
+
+// GetPacks returns pack sizes of the active catalog version.
+func (s *sqlStore) GetPacks(ctx context.Context) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT size FROM pack_catalog_sizes WHERE version_id = (SELECT version_id FROM pack_catalog_active) ORDER BY size ASC"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packs := []int{}
+	for rows.Next() {
+		var size int
+		if err := rows.Scan(&size); err != nil {
+			return nil, err
+		}
+		packs = append(packs, size)
+	}
+	return packs, rows.Err()
+}
+
+// SetPacks adds a catalog version with the given sizes and activates it.
+func (s *sqlStore) SetPacks(ctx context.Context, packs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	prev, err := s.lockActiveCosts(ctx, tx)
+	if err != nil {
+		return err
+	}
+	// sizes that stay keep their cost, new ones cost 0
+	costs := make(map[int]float64, len(packs))
+	for _, p := range packs {
+		costs[p] = prev[p]
+	}
+	if err := s.addCatalog(ctx, tx, costs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetPackCosts returns the unit cost of every pack size of the active catalog version.
+func (s *sqlStore) GetPackCosts(ctx context.Context) (map[int]float64, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = (SELECT version_id FROM pack_catalog_active) ORDER BY size ASC"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	costs := map[int]float64{}
+	for rows.Next() {
+		var size int
+		var cost float64
+		if err := rows.Scan(&size, &cost); err != nil {
+			return nil, err
+		}
+		costs[size] = cost
+	}
+	return costs, rows.Err()
+}
+
+// SetPackCosts adds a catalog version with updated costs and activates it.
+func (s *sqlStore) SetPackCosts(ctx context.Context, costs map[int]float64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	next, err := s.lockActiveCosts(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for size, cost := range costs {
+		if _, ok := next[size]; !ok {
+			return fmt.Errorf("%w %d", ErrUnknownPackSize, size)
+		}
+		next[size] = cost
+	}
+	if err := s.addCatalog(ctx, tx, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockActiveCosts locks the active catalog pointer, so concurrent changes
+// don't build on the same version, and returns the costs of that version.
+func (s *sqlStore) lockActiveCosts(ctx context.Context, tx *sql.Tx) (map[int]float64, error) {
+	var active int
+	if err := tx.QueryRowContext(ctx, s.lockActive).Scan(&active); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, s.q("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1"), active)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	costs := map[int]float64{}
+	for rows.Next() {
+		var size int
+		var cost float64
+		if err := rows.Scan(&size, &cost); err != nil {
+			return nil, err
+		}
+		costs[size] = cost
+	}
+	return costs, rows.Err()
+}
+
+// addCatalog inserts a catalog version with the given sizes and costs and
+// points the active catalog at it.
+func (s *sqlStore) addCatalog(ctx context.Context, tx *sql.Tx, costs map[int]float64) error {
+	var version int
+	err := tx.QueryRowContext(
+		ctx,
+		s.q("INSERT INTO pack_catalog_versions(created_at) VALUES($1) RETURNING id"),
+		time.Now().UTC(),
+	).Scan(&version)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO pack_catalog_sizes(version_id, size, cost) VALUES($1,$2,$3)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for size, cost := range costs {
+		if _, err := stmt.ExecContext(ctx, version, size, cost); err != nil {
+			return err
+		}
+	}
+	_, err = tx.ExecContext(ctx, s.q("UPDATE pack_catalog_active SET version_id = $1"), version)
+	return err
+}
+
+// ListPackCatalogs returns every catalog version with its sizes, newest first.
+func (s *sqlStore) ListPackCatalogs(ctx context.Context) ([]PackCatalog, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v CROSS JOIN pack_catalog_active a ORDER BY v.id DESC"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []PackCatalog{}
+	byVersion := map[int]*PackCatalog{}
+	for rows.Next() {
+		c := PackCatalog{Packs: []int{}, Costs: map[int]float64{}}
+		if err := rows.Scan(&c.Version, &c.CreatedAt, &c.Active); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range out {
+		byVersion[out[i].Version] = &out[i]
+	}
+
+	sizes, err := s.db.QueryContext(ctx, s.q("SELECT version_id, size, cost FROM pack_catalog_sizes ORDER BY version_id DESC, size ASC"))
+	if err != nil {
+		return nil, err
+	}
+	defer sizes.Close()
+	for sizes.Next() {
+		var version, size int
+		var cost float64
+		if err := sizes.Scan(&version, &size, &cost); err != nil {
+			return nil, err
+		}
+		if c, ok := byVersion[version]; ok {
+			c.Packs = append(c.Packs, size)
+			c.Costs[size] = cost
+		}
+	}
+	return out, sizes.Err()
+}
+
+// GetPackCatalog returns one catalog version with its sizes.
+func (s *sqlStore) GetPackCatalog(ctx context.Context, version int) (PackCatalog, error) {
+	c := PackCatalog{Packs: []int{}, Costs: map[int]float64{}}
+	err := s.db.QueryRowContext(
+		ctx,
+		s.q("SELECT v.id, v.created_at, v.id = a.version_id FROM pack_catalog_versions v CROSS JOIN pack_catalog_active a WHERE v.id = $1"), version,
+	).Scan(&c.Version, &c.CreatedAt, &c.Active)
+	if err == sql.ErrNoRows {
+		return PackCatalog{}, ErrNotFound
+	}
+	if err != nil {
+		return PackCatalog{}, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT size, cost FROM pack_catalog_sizes WHERE version_id = $1 ORDER BY size ASC"), version)
+	if err != nil {
+		return PackCatalog{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var size int
+		var cost float64
+		if err := rows.Scan(&size, &cost); err != nil {
+			return PackCatalog{}, err
+		}
+		c.Packs = append(c.Packs, size)
+		c.Costs[size] = cost
+	}
+	return c, rows.Err()
+}
+
+// GetActivePackCatalog returns the active catalog version with its sizes.
+// Versions never change once written, so reading the sizes after the id
+// is consistent even when another version is activated in between.
+func (s *sqlStore) GetActivePackCatalog(ctx context.Context) (PackCatalog, error) {
+	var version int
+	if err := s.db.QueryRowContext(ctx, s.q("SELECT version_id FROM pack_catalog_active")).Scan(&version); err != nil {
+		return PackCatalog{}, err
+	}
+	return s.GetPackCatalog(ctx, version)
+}
+
+// ActivatePackCatalog points the active catalog at an existing version.
+func (s *sqlStore) ActivatePackCatalog(ctx context.Context, version int) error {
+	res, err := s.db.ExecContext(
+		ctx,
+		s.q("UPDATE pack_catalog_active SET version_id = $1 WHERE EXISTS (SELECT 1 FROM pack_catalog_versions WHERE id = $1)"),
+		version,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SaveCalculation saves calculation summary and items.
+func (s *sqlStore) SaveCalculation(ctx context.Context, catalogVersion int, items int, totalItems int, packCount int, counts map[int]int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var calcID int
+	err = tx.QueryRowContext(
+		ctx,
+		s.q("INSERT INTO calculations(items,total_items,pack_count,created_at,catalog_version,request_id) VALUES($1,$2,$3,$4,NULLIF($5,0),NULLIF($6,'')) RETURNING id"),
+		items, totalItems, packCount, time.Now().UTC(), catalogVersion, requestid.FromContext(ctx),
+	).Scan(&calcID)
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO calculation_items(calculation_id, pack_size, quantity) VALUES($1,$2,$3)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for size, qty := range counts {
+		if _, err := stmt.ExecContext(ctx, calcID, size, qty); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetSKUPacks returns pack sizes of a SKU from DB.
+func (s *sqlStore) GetSKUPacks(ctx context.Context, sku string) ([]int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx, s.q("SELECT id FROM skus WHERE code = $1"), sku).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT size FROM sku_packs WHERE sku_id = $1 ORDER BY size ASC"), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	packs := []int{}
+	for rows.Next() {
+		var size int
+		if err := rows.Scan(&size); err != nil {
+			return nil, err
+		}
+		packs = append(packs, size)
+	}
+	return packs, rows.Err()
+}
+
+// SetSKUPacks replaces a SKU's pack sizes atomically, creating the SKU if needed.
+func (s *sqlStore) SetSKUPacks(ctx context.Context, sku string, packs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(
+		ctx,
+		s.q("INSERT INTO skus(code, created_at) VALUES($1,$2) ON CONFLICT (code) DO UPDATE SET code = EXCLUDED.code RETURNING id"),
+		sku, time.Now().UTC(),
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, s.q("DELETE FROM sku_packs WHERE sku_id = $1"), id); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO sku_packs(sku_id, size) VALUES($1,$2)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range distinctSorted(packs) {
+		if _, err := stmt.ExecContext(ctx, id, p); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveOrder saves an order as one calculation with its lines and pack items.
+func (s *sqlStore) SaveOrder(ctx context.Context, lines []OrderLine) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var items, totalItems, packCount int
+	for _, l := range lines {
+		items += l.Items
+		totalItems += l.TotalItems
+		packCount += l.PackCount
+	}
+	var calcID int
+	err = tx.QueryRowContext(
+		ctx,
+		s.q("INSERT INTO calculations(items,total_items,pack_count,created_at,request_id) VALUES($1,$2,$3,$4,NULLIF($5,'')) RETURNING id"),
+		items, totalItems, packCount, time.Now().UTC(), requestid.FromContext(ctx),
+	).Scan(&calcID)
+	if err != nil {
+		return err
+	}
+	lineStmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO calculation_lines(calculation_id, sku, items, total_items, pack_count) VALUES($1,$2,$3,$4,$5)"))
+	if err != nil {
+		return err
+	}
+	defer lineStmt.Close()
+	itemStmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO calculation_items(calculation_id, pack_size, quantity, sku) VALUES($1,$2,$3,$4)"))
+	if err != nil {
+		return err
+	}
+	defer itemStmt.Close()
+	for _, l := range lines {
+		if _, err := lineStmt.ExecContext(ctx, calcID, l.SKU, l.Items, l.TotalItems, l.PackCount); err != nil {
+			return err
+		}
+		for size, qty := range l.Counts {
+			if _, err := itemStmt.ExecContext(ctx, calcID, size, qty, l.SKU); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// ListCalculations returns calculation summaries matching f, newest first.
+func (s *sqlStore) ListCalculations(ctx context.Context, f CalculationFilter) ([]Calculation, error) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Before > 0 {
+		add("id < $%d", f.Before)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To.UTC())
+	}
+	if f.MinItems > 0 {
+		add("items >= $%d", f.MinItems)
+	}
+	if f.MaxItems > 0 {
+		add("items <= $%d", f.MaxItems)
+	}
+	if f.RequestID != "" {
+		add("request_id = $%d", f.RequestID)
+	}
+
+	query := "SELECT id, items, total_items, pack_count, created_at, catalog_version, request_id FROM calculations"
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.q(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Calculation{}
+	for rows.Next() {
+		var c Calculation
+		var catalog sql.NullInt64
+		var requestID sql.NullString
+		if err := rows.Scan(&c.ID, &c.Items, &c.TotalItems, &c.PackCount, &c.CreatedAt, &catalog, &requestID); err != nil {
+			return nil, err
+		}
+		c.CatalogVersion = int(catalog.Int64)
+		c.RequestID = requestID.String
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// GetCalculation returns one calculation with its pack items and order lines.
+func (s *sqlStore) GetCalculation(ctx context.Context, id int) (Calculation, error) {
+	var c Calculation
+	var catalog sql.NullInt64
+	var requestID sql.NullString
+	err := s.db.QueryRowContext(
+		ctx,
+		s.q("SELECT id, items, total_items, pack_count, created_at, catalog_version, request_id FROM calculations WHERE id = $1"), id,
+	).Scan(&c.ID, &c.Items, &c.TotalItems, &c.PackCount, &c.CreatedAt, &catalog, &requestID)
+	if err == sql.ErrNoRows {
+		return Calculation{}, ErrNotFound
+	}
+	if err != nil {
+		return Calculation{}, err
+	}
+	c.CatalogVersion = int(catalog.Int64)
+	c.RequestID = requestID.String
+
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT sku, items, total_items, pack_count FROM calculation_lines WHERE calculation_id = $1 ORDER BY id ASC"), id)
+	if err != nil {
+		return Calculation{}, err
+	}
+	defer rows.Close()
+	lineBySKU := map[string]*OrderLine{}
+	for rows.Next() {
+		var l OrderLine
+		if err := rows.Scan(&l.SKU, &l.Items, &l.TotalItems, &l.PackCount); err != nil {
+			return Calculation{}, err
+		}
+		l.Counts = map[int]int{}
+		c.Lines = append(c.Lines, l)
+	}
+	if err := rows.Err(); err != nil {
+		return Calculation{}, err
+	}
+	for i := range c.Lines {
+		lineBySKU[c.Lines[i].SKU] = &c.Lines[i]
+	}
+
+	items, err := s.db.QueryContext(ctx, s.q("SELECT pack_size, quantity, sku FROM calculation_items WHERE calculation_id = $1 ORDER BY pack_size ASC"), id)
+	if err != nil {
+		return Calculation{}, err
+	}
+	defer items.Close()
+	if c.Lines == nil {
+		c.Counts = map[int]int{}
+	}
+	for items.Next() {
+		var size, qty int
+		var sku sql.NullString
+		if err := items.Scan(&size, &qty, &sku); err != nil {
+			return Calculation{}, err
+		}
+		if l, ok := lineBySKU[sku.String]; ok && sku.Valid {
+			l.Counts[size] += qty
+		} else if c.Counts != nil {
+			c.Counts[size] += qty
+		}
+	}
+	return c, items.Err()
+}
+
+// GetStock returns inventory levels keyed by pack size.
+func (s *sqlStore) GetStock(ctx context.Context) (map[int]int, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT pack_size, quantity FROM inventory"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stock := map[int]int{}
+	for rows.Next() {
+		var size, qty int
+		if err := rows.Scan(&size, &qty); err != nil {
+			return nil, err
+		}
+		stock[size] = qty
+	}
+	return stock, rows.Err()
+}
+
+// SetStock replaces inventory levels atomically.
+func (s *sqlStore) SetStock(ctx context.Context, stock map[int]int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.q("DELETE FROM inventory")); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, s.q("INSERT INTO inventory(pack_size, quantity, updated_at) VALUES($1,$2,$3)"))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for size, qty := range stock {
+		if _, err := stmt.ExecContext(ctx, size, qty, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CreateAPIKey inserts a key; scopes are stored comma separated.
+func (s *sqlStore) CreateAPIKey(ctx context.Context, key APIKey, hash string) (APIKey, error) {
+	key.CreatedAt = time.Now().UTC()
+	err := s.db.QueryRowContext(
+		ctx,
+		s.q("INSERT INTO api_keys(name, prefix, key_hash, scopes, created_at) VALUES($1,$2,$3,$4,$5) RETURNING id"),
+		key.Name, key.Prefix, hash, strings.Join(key.Scopes, ","), key.CreatedAt,
+	).Scan(&key.ID)
+	if err != nil {
+		return APIKey{}, err
+	}
+	key.RevokedAt = time.Time{}
+	return key, nil
+}
+
+// GetAPIKeyByHash returns the unrevoked key with the given hash.
+func (s *sqlStore) GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	var k APIKey
+	var scopes string
+	err := s.db.QueryRowContext(
+		ctx,
+		s.q("SELECT id, name, prefix, scopes, created_at FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL"),
+		hash,
+	).Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return APIKey{}, ErrNotFound
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	k.Scopes = splitScopes(scopes)
+	return k, nil
+}
+
+// ListAPIKeys returns every key ordered by id.
+func (s *sqlStore) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, s.q("SELECT id, name, prefix, scopes, created_at, revoked_at FROM api_keys ORDER BY id ASC"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		var scopes string
+		var revoked sql.NullTime
+		if err := rows.Scan(&k.ID, &k.Name, &k.Prefix, &scopes, &k.CreatedAt, &revoked); err != nil {
+			return nil, err
+		}
+		k.Scopes = splitScopes(scopes)
+		if revoked.Valid {
+			k.RevokedAt = revoked.Time
+		}
+		out = append(out, k)
+	}
+	return out, rows.Err()
+}
+
+// RevokeAPIKey marks a key revoked.
+func (s *sqlStore) RevokeAPIKey(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, s.q("UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL"), time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func splitScopes(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+
+	migrations "github.com/svvictorelias/shipping-pack-backend/internal/database/migrations/sqlite"
+	"github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDriver is the database/sql driver OpenSQLite uses, registered by
+// the pure-Go modernc.org/sqlite.
+const SQLiteDriver = "sqlite"
+
+// sqliteParams are the connection settings of OpenSQLite: foreign keys on,
+// WAL journal, transactions taking the write lock at once and waiting up
+// to 5s for other processes, and times written in a format that sorts.
+const sqliteParams = "_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite"
+
+// OpenSQLite opens the SQLite database file at path, creating it if needed,
+// tracing its statements, and applies the migrations it lacks. Path
+// ":memory:" opens a database that lives as long as the returned DB.
+//
+// The DB holds a single connection: SQLite runs one write at a time anyway,
+// and it keeps transactions from failing on each other's locks.
+func OpenSQLite(ctx context.Context, path string) (*sql.DB, error) {
+	db, err := tracing.OpenDB(SQLiteDriver, "file:"+path+"?"+sqliteParams)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrations.Run(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// SQLiteStore implements Store using database/sql and SQLite, for
+// single-node deployments. Its schema and statements are the ones of
+// PostgresStore.
+type SQLiteStore struct {
+	sqlStore
+}
+
+// NewSQLiteStore returns a store on db, opened by OpenSQLite.
+//
+// Transactions take the write lock when they begin, so reading the active
+// catalog version is enough to keep concurrent changes from building on it.
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{sqlStore{
+		db:         db,
+		rebind:     rebindSQLite,
+		lockActive: "SELECT version_id FROM pack_catalog_active",
+	}}
+}
+
+var pgPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// rebindSQLite rewrites the $N placeholders of query to ?N, which SQLite
+// binds to the same argument.
+func rebindSQLite(query string) string {
+	return pgPlaceholder.ReplaceAllString(query, "?$1")
+}
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	migrations "github.com/svvictorelias/shipping-pack-backend/internal/database/migrations/sqlite"
+)
+
+// openSQLite opens the SQLite database file at path for t.
+func openSQLite(t *testing.T, path string) *sql.DB {
+	t.Helper()
+	db, err := OpenSQLite(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestOpenSQLite_Migrations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "packcalc.db")
+	db := openSQLite(t, path)
+	if err := NewSQLiteStore(db).SetPacks(context.Background(), []int{250, 500}); err != nil {
+		t.Fatalf("SetPacks: %v", err)
+	}
+	db.Close()
+
+	// reopening applies nothing and keeps the data
+	db = openSQLite(t, path)
+	all, _ := migrations.Migrations()
+	var n int
+	var last string
+	if err := db.QueryRow("SELECT COUNT(*), MAX(name) FROM migrations WHERE success").Scan(&n, &last); err != nil {
+		t.Fatalf("read migrations: %v", err)
+	}
+	if n != len(all) || last != all[len(all)-1].Name {
+		t.Fatalf("expected %d migrations up to %s got %d up to %s", len(all), all[len(all)-1].Name, n, last)
+	}
+	if packs, err := NewSQLiteStore(db).GetPacks(context.Background()); err != nil || len(packs) != 2 {
+		t.Fatalf("expected the packs to survive got %v, %v", packs, err)
+	}
+
+	if _, err := db.Exec("UPDATE migrations SET checksum = 'edited' WHERE name = ?", all[0].Name); err != nil {
+		t.Fatalf("edit checksum: %v", err)
+	}
+	db.Close()
+	if _, err := OpenSQLite(context.Background(), path); err == nil {
+		t.Fatal("expected an edited migration to fail")
+	}
+}
+
+func TestRebindSQLite(t *testing.T) {
+	cases := map[string]string{
+		"SELECT size FROM sku_packs WHERE sku_id = $1":                     "SELECT size FROM sku_packs WHERE sku_id = ?1",
+		"INSERT INTO inventory(pack_size, quantity) VALUES($1,$2)":         "INSERT INTO inventory(pack_size, quantity) VALUES(?1,?2)",
+		"UPDATE t SET a = $1 WHERE EXISTS (SELECT 1 FROM u WHERE id = $1)": "UPDATE t SET a = ?1 WHERE EXISTS (SELECT 1 FROM u WHERE id = ?1)",
+		"SELECT id FROM calculations ORDER BY id DESC LIMIT $12":           "SELECT id FROM calculations ORDER BY id DESC LIMIT ?12",
+	}
+	for in, want := range cases {
+		if got := rebindSQLite(in); got != want {
+			t.Errorf("rebindSQLite(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
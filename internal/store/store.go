@@ -1,15 +1,166 @@
 package store
 
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrUnknownPackSize is returned when a cost refers to a size that is not in
+// the active catalog.
+var ErrUnknownPackSize = errors.New("unknown pack size")
+
+// OrderLine is the result for one SKU of a multi-line order.
+type OrderLine struct {
+	SKU        string
+	Items      int
+	TotalItems int
+	PackCount  int
+	Counts     map[int]int // map[packSize]quantity
+}
+
+// Calculation is a persisted calculation. Counts is set for single-SKU
+// calculations and Lines for multi-line orders; both are only filled by
+// GetCalculation.
+type Calculation struct {
+	ID         int
+	Items      int
+	TotalItems int
+	PackCount  int
+	CreatedAt  time.Time
+	Counts     map[int]int
+	Lines      []OrderLine
+	// CatalogVersion is the pack catalog version the calculation used,
+	// 0 for multi-line orders.
+	CatalogVersion int
+	// RequestID is the ID of the HTTP request that saved the calculation,
+	// "" if it was not saved by one.
+	RequestID string
+}
+
+// PackCatalog is an immutable version of the pack sizes and their costs.
+type PackCatalog struct {
+	Version   int
+	CreatedAt time.Time
+	Active    bool
+	Packs     []int           // sorted ascending
+	Costs     map[int]float64 // map[packSize]unitCost
+}
+
+// APIKey is a stored API key. Only a hash of the secret is kept, so the
+// secret itself is never returned.
+type APIKey struct {
+	ID        int
+	Name      string
+	Prefix    string   // start of the secret, to tell keys apart
+	Scopes    []string // empty, not nil, without scopes when read back
+	CreatedAt time.Time
+	RevokedAt time.Time // zero while the key is valid
+}
+
+// CalculationFilter narrows ListCalculations. Zero values leave a bound open.
+type CalculationFilter struct {
+	Before   int // cursor: only ids lower than Before
+	Limit    int
+	From     time.Time // created_at >= From
+	To       time.Time // created_at < To
+	MinItems int
+	MaxItems int
+	// RequestID only matches calculations saved by that request.
+	RequestID string
+}
+
 // Store defines persistence operations used by the service.
 // This allows easy mocking for tests.
 type Store interface {
-	// GetPacks returns configured pack sizes (unsorted possible).
-	GetPacks() ([]int, error)
+	// GetPacks returns the pack sizes of the active catalog, sorted ascending.
+	GetPacks(ctx context.Context) ([]int, error)
+
+	// SetPacks adds a catalog version with the given pack sizes and makes
+	// it active. Sizes of the previous version keep their cost and new ones
+	// cost 0. Duplicate
+	// sizes are stored once.
+	SetPacks(ctx context.Context, packs []int) error
+
+	// GetPackCosts returns the unit cost of each pack size.
+	GetPackCosts(ctx context.Context) (map[int]float64, error)
+
+	// SetPackCosts adds a catalog version with the unit cost of existing
+	// pack sizes updated and makes it active.
+	SetPackCosts(ctx context.Context, costs map[int]float64) error
 
-	// SetPacks atomically replaces pack sizes in DB.
-	SetPacks([]int) error
+	// ListPackCatalogs returns every pack catalog version, newest first.
+	ListPackCatalogs(ctx context.Context) ([]PackCatalog, error)
+
+	// GetPackCatalog returns one pack catalog version.
+	// Returns ErrNotFound for an unknown version.
+	GetPackCatalog(ctx context.Context, version int) (PackCatalog, error)
+
+	// GetActivePackCatalog returns the active pack catalog version.
+	GetActivePackCatalog(ctx context.Context) (PackCatalog, error)
+
+	// ActivatePackCatalog makes an existing catalog version the active one.
+	// Returns ErrNotFound for an unknown version.
+	ActivatePackCatalog(ctx context.Context, version int) error
+
+	// SaveCalculation persists a run of CalculatePacks for auditing, linked
+	// to the catalog version it used and to the request ID ctx carries.
+	// catalogVersion 0 links no version. counts is map[packSize]quantity
+	SaveCalculation(ctx context.Context, catalogVersion int, items int, totalItems int, packCount int, counts map[int]int) error
+
+	// GetSKUPacks returns the pack sizes of one SKU's catalog, sorted ascending.
+	// Returns ErrNotFound for an unknown SKU.
+	GetSKUPacks(ctx context.Context, sku string) ([]int, error)
+
+	// SetSKUPacks atomically replaces the pack sizes of a SKU, creating it if needed.
+	// Duplicate sizes are stored once.
+	SetSKUPacks(ctx context.Context, sku string, packs []int) error
+
+	// SaveOrder persists a multi-line order as a single calculation record,
+	// linked to the request ID ctx carries. The SKUs of lines must be
+	// distinct.
+	SaveOrder(ctx context.Context, lines []OrderLine) error
+
+	// ListCalculations returns calculation summaries matching f, newest first.
+	ListCalculations(ctx context.Context, f CalculationFilter) ([]Calculation, error)
+
+	// GetCalculation returns one calculation with its breakdown.
+	// Returns ErrNotFound for an unknown id.
+	GetCalculation(ctx context.Context, id int) (Calculation, error)
+
+	// GetStock returns available quantity per pack size.
+	// Sizes without an entry have unlimited stock.
+	GetStock(ctx context.Context) (map[int]int, error)
+
+	// SetStock atomically replaces inventory levels in DB.
+	SetStock(ctx context.Context, stock map[int]int) error
+
+	// CreateAPIKey stores a key by the hash of its secret and returns it
+	// with ID and CreatedAt set. A hash already stored is an error.
+	CreateAPIKey(ctx context.Context, key APIKey, hash string) (APIKey, error)
+
+	// GetAPIKeyByHash returns the key whose secret hashes to hash.
+	// Returns ErrNotFound for an unknown or revoked key.
+	GetAPIKeyByHash(ctx context.Context, hash string) (APIKey, error)
+
+	// ListAPIKeys returns every key, revoked ones included, oldest first.
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+
+	// RevokeAPIKey revokes a key.
+	// Returns ErrNotFound for an unknown or already revoked key.
+	RevokeAPIKey(ctx context.Context, id int) error
+}
 
-	// SaveCalculation persists a run of CalculatePacks for auditing.
-	// counts is map[packSize]quantity
-	SaveCalculation(items int, totalItems int, packCount int, counts map[int]int) error
+// distinctSorted returns a sorted copy of packs without duplicates, as every
+// store keeps pack sizes.
+func distinctSorted(packs []int) []int {
+	out := make([]int, len(packs))
+	copy(out, packs)
+	sort.Ints(out)
+	return slices.Compact(out)
 }
@@ -0,0 +1,418 @@
+// Package storetest checks that an implementation of store.Store behaves
+// like the others: the same ordering, duplicate handling, errors and
+// filters, whatever database is behind it.
+package storetest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/svvictorelias/shipping-pack-backend/internal/requestid"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+// Run runs every conformance test as a subtest of t. Each one gets a store
+// from newStore, which must start with catalog version 1 active and empty
+// and nothing else saved; newStore registers any cleanup on its t.
+func Run(t *testing.T, newStore func(t *testing.T) store.Store) {
+	for _, tc := range []struct {
+		name string
+		test func(t *testing.T, s store.Store)
+	}{
+		{"PackOrdering", testPackOrdering},
+		{"PackDuplicates", testPackDuplicates},
+		{"PackCosts", testPackCosts},
+		{"PackCatalogs", testPackCatalogs},
+		{"Calculations", testCalculations},
+		{"CalculationFilters", testCalculationFilters},
+		{"Orders", testOrders},
+		{"SKUPacks", testSKUPacks},
+		{"Stock", testStock},
+		{"APIKeys", testAPIKeys},
+	} {
+		t.Run(tc.name, func(t *testing.T) { tc.test(t, newStore(t)) })
+	}
+}
+
+// setPacks sets the packs of s, failing t on error.
+func setPacks(t *testing.T, s store.Store, packs ...int) {
+	t.Helper()
+	if err := s.SetPacks(context.Background(), packs); err != nil {
+		t.Fatalf("SetPacks(%v): %v", packs, err)
+	}
+}
+
+// Pack sizes come back sorted ascending, whatever order they were set in.
+func testPackOrdering(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if packs, err := s.GetPacks(ctx); err != nil || packs == nil || len(packs) != 0 {
+		t.Fatalf("expected no packs, not nil, got %#v, %v", packs, err)
+	}
+	setPacks(t, s, 1000, 250, 5000, 500)
+	want := []int{250, 500, 1000, 5000}
+	if packs, err := s.GetPacks(ctx); err != nil || !reflect.DeepEqual(packs, want) {
+		t.Fatalf("GetPacks = %v, %v, want %v", packs, err, want)
+	}
+	if c, err := s.GetPackCatalog(ctx, 2); err != nil || !reflect.DeepEqual(c.Packs, want) {
+		t.Fatalf("GetPackCatalog(2).Packs = %v, %v, want %v", c.Packs, err, want)
+	}
+	if cs, err := s.ListPackCatalogs(ctx); err != nil || len(cs) == 0 || !reflect.DeepEqual(cs[0].Packs, want) {
+		t.Fatalf("ListPackCatalogs = %+v, %v, want %v first", cs, err, want)
+	}
+
+	// the slice returned is the caller's
+	packs, _ := s.GetPacks(ctx)
+	packs[0] = 1
+	if again, _ := s.GetPacks(ctx); again[0] != 250 {
+		t.Fatalf("changing the returned packs changed the store: %v", again)
+	}
+}
+
+// Duplicate sizes are stored once.
+func testPackDuplicates(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	setPacks(t, s, 500, 250, 500, 250)
+	if packs, err := s.GetPacks(ctx); err != nil || !reflect.DeepEqual(packs, []int{250, 500}) {
+		t.Fatalf("GetPacks = %v, %v, want [250 500]", packs, err)
+	}
+	if costs, err := s.GetPackCosts(ctx); err != nil || len(costs) != 2 {
+		t.Fatalf("expected 2 costs got %v, %v", costs, err)
+	}
+}
+
+func testPackCosts(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	setPacks(t, s, 250, 500, 1000)
+	if costs, err := s.GetPackCosts(ctx); err != nil || !reflect.DeepEqual(costs, map[int]float64{250: 0, 500: 0, 1000: 0}) {
+		t.Fatalf("new sizes cost 0, got %v, %v", costs, err)
+	}
+	if err := s.SetPackCosts(ctx, map[int]float64{500: 1.25}); err != nil {
+		t.Fatalf("SetPackCosts: %v", err)
+	}
+	if err := s.SetPackCosts(ctx, map[int]float64{1000: 2.5}); err != nil {
+		t.Fatalf("SetPackCosts: %v", err)
+	}
+	want := map[int]float64{250: 0, 500: 1.25, 1000: 2.5}
+	if costs, err := s.GetPackCosts(ctx); err != nil || !reflect.DeepEqual(costs, want) {
+		t.Fatalf("GetPackCosts = %v, %v, want %v", costs, err, want)
+	}
+
+	if err := s.SetPackCosts(ctx, map[int]float64{250: 9, 42: 1}); !errors.Is(err, store.ErrUnknownPackSize) {
+		t.Fatalf("expected ErrUnknownPackSize got %v", err)
+	}
+	if costs, _ := s.GetPackCosts(ctx); !reflect.DeepEqual(costs, want) {
+		t.Fatalf("a failed SetPackCosts changed the costs: %v", costs)
+	}
+	if cs, _ := s.ListPackCatalogs(ctx); len(cs) != 4 {
+		t.Fatalf("a failed SetPackCosts added a version: %d versions", len(cs))
+	}
+
+	// new sizes keep the costs of the sizes that stay
+	setPacks(t, s, 250, 500, 2000)
+	if costs, _ := s.GetPackCosts(ctx); !reflect.DeepEqual(costs, map[int]float64{250: 0, 500: 1.25, 2000: 0}) {
+		t.Fatalf("expected SetPacks to carry the costs forward got %v", costs)
+	}
+}
+
+func testPackCatalogs(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+	setPacks(t, s, 250, 500)
+	if err := s.SetPackCosts(ctx, map[int]float64{500: 1.25}); err != nil {
+		t.Fatalf("SetPackCosts: %v", err)
+	}
+
+	catalogs, err := s.ListPackCatalogs(ctx)
+	if err != nil || len(catalogs) != 3 {
+		t.Fatalf("expected 3 versions got %+v, %v", catalogs, err)
+	}
+	for i, c := range catalogs {
+		if c.Version != 3-i || c.Active != (i == 0) {
+			t.Fatalf("expected versions 3, 2, 1 with 3 active got %+v", catalogs)
+		}
+	}
+	if c := catalogs[0]; c.Costs[500] != 1.25 || c.CreatedAt.Before(start) {
+		t.Fatalf("unexpected version 3 %+v", c)
+	}
+	if c := catalogs[2]; c.Packs == nil || len(c.Packs) != 0 || c.Costs == nil {
+		t.Fatalf("expected version 1 empty, not nil, got %#v", c)
+	}
+
+	if err := s.ActivatePackCatalog(ctx, 2); err != nil {
+		t.Fatalf("ActivatePackCatalog: %v", err)
+	}
+	if costs, _ := s.GetPackCosts(ctx); costs[500] != 0 {
+		t.Fatalf("expected the costs of version 2 got %v", costs)
+	}
+	c, err := s.GetPackCatalog(ctx, 2)
+	if err != nil || !c.Active || c.Version != 2 || !reflect.DeepEqual(c.Packs, []int{250, 500}) {
+		t.Fatalf("GetPackCatalog(2) = %+v, %v", c, err)
+	}
+	if c, _ := s.GetPackCatalog(ctx, 3); c.Active {
+		t.Fatal("expected version 3 inactive")
+	}
+	if active, err := s.GetActivePackCatalog(ctx); err != nil || !reflect.DeepEqual(active, c) {
+		t.Fatalf("GetActivePackCatalog = %+v, %v, want %+v", active, err, c)
+	}
+	// activating the active version is fine
+	if err := s.ActivatePackCatalog(ctx, 2); err != nil {
+		t.Fatalf("ActivatePackCatalog again: %v", err)
+	}
+
+	for _, v := range []int{0, -1, 99} {
+		if _, err := s.GetPackCatalog(ctx, v); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetPackCatalog(%d): expected ErrNotFound got %v", v, err)
+		}
+		if err := s.ActivatePackCatalog(ctx, v); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("ActivatePackCatalog(%d): expected ErrNotFound got %v", v, err)
+		}
+	}
+}
+
+func testCalculations(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+	setPacks(t, s, 250, 500)
+	setPacks(t, s, 100)
+	// the version passed is saved, not the active one
+	if err := s.SaveCalculation(requestid.NewContext(ctx, "req-1"), 2, 501, 750, 2, map[int]int{250: 1, 500: 1}); err != nil {
+		t.Fatalf("SaveCalculation: %v", err)
+	}
+	if err := s.SaveCalculation(ctx, 3, 90, 100, 1, map[int]int{100: 1}); err != nil {
+		t.Fatalf("SaveCalculation: %v", err)
+	}
+
+	calcs, err := s.ListCalculations(ctx, store.CalculationFilter{})
+	if err != nil || len(calcs) != 2 {
+		t.Fatalf("expected 2 calculations got %+v, %v", calcs, err)
+	}
+	second, first := calcs[0], calcs[1]
+	if second.ID <= first.ID {
+		t.Fatalf("expected newest first got ids %d, %d", second.ID, first.ID)
+	}
+	if first.Items != 501 || first.TotalItems != 750 || first.PackCount != 2 || first.CatalogVersion != 2 ||
+		first.RequestID != "req-1" || first.CreatedAt.Before(start) || first.Counts != nil || first.Lines != nil {
+		t.Fatalf("unexpected summary %+v", first)
+	}
+	if second.CatalogVersion != 3 || second.RequestID != "" {
+		t.Fatalf("unexpected summary %+v", second)
+	}
+
+	got, err := s.GetCalculation(ctx, first.ID)
+	if err != nil || !reflect.DeepEqual(got.Counts, map[int]int{250: 1, 500: 1}) || got.Lines != nil {
+		t.Fatalf("GetCalculation = %+v, %v", got, err)
+	}
+	got.Counts = nil
+	if !got.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("GetCalculation created at %v, ListCalculations %v", got.CreatedAt, first.CreatedAt)
+	}
+	got.CreatedAt = first.CreatedAt
+	if !reflect.DeepEqual(got, first) {
+		t.Fatalf("GetCalculation = %+v, ListCalculations %+v", got, first)
+	}
+
+	// a calculation without packs still has its counts, version 0 links
+	// no catalog
+	if err := s.SaveCalculation(ctx, 0, 0, 0, 0, nil); err != nil {
+		t.Fatalf("SaveCalculation: %v", err)
+	}
+	calcs, _ = s.ListCalculations(ctx, store.CalculationFilter{Limit: 1})
+	if got, err := s.GetCalculation(ctx, calcs[0].ID); err != nil || got.Counts == nil || len(got.Counts) != 0 || got.CatalogVersion != 0 {
+		t.Fatalf("expected empty counts, not nil, and no version got %#v, %v", got, err)
+	}
+
+	for _, id := range []int{0, -1, 999} {
+		if _, err := s.GetCalculation(ctx, id); !errors.Is(err, store.ErrNotFound) {
+			t.Errorf("GetCalculation(%d): expected ErrNotFound got %v", id, err)
+		}
+	}
+}
+
+func testCalculationFilters(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if calcs, err := s.ListCalculations(ctx, store.CalculationFilter{}); err != nil || calcs == nil || len(calcs) != 0 {
+		t.Fatalf("expected no calculations, not nil, got %#v, %v", calcs, err)
+	}
+	setPacks(t, s, 250, 500)
+	for i, items := range []int{100, 300, 500, 700} {
+		rctx := requestid.NewContext(ctx, []string{"a", "b", "a", ""}[i])
+		if err := s.SaveCalculation(rctx, 2, items, items, 1, map[int]int{}); err != nil {
+			t.Fatalf("SaveCalculation: %v", err)
+		}
+	}
+	all, _ := s.ListCalculations(ctx, store.CalculationFilter{})
+	if len(all) != 4 {
+		t.Fatalf("expected 4 calculations got %d", len(all))
+	}
+	created := all[2].CreatedAt // of the calculation of 300 items
+
+	items := func(calcs []store.Calculation) []int {
+		out := []int{}
+		for _, c := range calcs {
+			out = append(out, c.Items)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name string
+		f    store.CalculationFilter
+		want []int
+	}{
+		{"before", store.CalculationFilter{Before: all[1].ID}, []int{300, 100}},
+		{"limit", store.CalculationFilter{Limit: 3}, []int{700, 500, 300}},
+		{"before and limit", store.CalculationFilter{Before: all[0].ID, Limit: 1}, []int{500}},
+		{"from is inclusive", store.CalculationFilter{From: created}, []int{700, 500, 300}},
+		{"to is exclusive", store.CalculationFilter{To: created}, []int{100}},
+		{"from in the future", store.CalculationFilter{From: time.Now().Add(time.Hour)}, []int{}},
+		{"min items", store.CalculationFilter{MinItems: 300}, []int{700, 500, 300}},
+		{"max items", store.CalculationFilter{MaxItems: 300}, []int{300, 100}},
+		{"items range", store.CalculationFilter{MinItems: 200, MaxItems: 600}, []int{500, 300}},
+		{"request id", store.CalculationFilter{RequestID: "a"}, []int{500, 100}},
+		{"unknown request id", store.CalculationFilter{RequestID: "z"}, []int{}},
+	} {
+		calcs, err := s.ListCalculations(ctx, tc.f)
+		if err != nil || !reflect.DeepEqual(items(calcs), tc.want) {
+			t.Errorf("%s: got items %v, %v, want %v", tc.name, items(calcs), err, tc.want)
+		}
+	}
+}
+
+func testOrders(t *testing.T, s store.Store) {
+	ctx := requestid.NewContext(context.Background(), "order-1")
+	setPacks(t, s, 250)
+	lines := []store.OrderLine{
+		{SKU: "B", Items: 600, TotalItems: 1000, PackCount: 2, Counts: map[int]int{500: 2}},
+		{SKU: "A", Items: 10, TotalItems: 250, PackCount: 1, Counts: map[int]int{250: 1}},
+	}
+	if err := s.SaveOrder(ctx, lines); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+
+	calcs, err := s.ListCalculations(ctx, store.CalculationFilter{})
+	if err != nil || len(calcs) != 1 {
+		t.Fatalf("expected 1 calculation got %+v, %v", calcs, err)
+	}
+	c := calcs[0]
+	if c.Items != 610 || c.TotalItems != 1250 || c.PackCount != 3 || c.CatalogVersion != 0 || c.RequestID != "order-1" {
+		t.Fatalf("expected the totals of the order got %+v", c)
+	}
+	got, err := s.GetCalculation(ctx, c.ID)
+	if err != nil || got.Counts != nil || !reflect.DeepEqual(got.Lines, lines) {
+		t.Fatalf("GetCalculation = %+v, %v, want lines %+v in order", got, err, lines)
+	}
+
+	// the lines stored are not the caller's
+	lines[0].Counts[500] = 99
+	if got, _ := s.GetCalculation(ctx, c.ID); got.Lines[0].Counts[500] != 2 {
+		t.Fatalf("changing the saved lines changed the store: %+v", got.Lines)
+	}
+}
+
+func testSKUPacks(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if _, err := s.GetSKUPacks(ctx, "A"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if err := s.SetSKUPacks(ctx, "A", []int{500, 250, 500}); err != nil {
+		t.Fatalf("SetSKUPacks: %v", err)
+	}
+	if packs, err := s.GetSKUPacks(ctx, "A"); err != nil || !reflect.DeepEqual(packs, []int{250, 500}) {
+		t.Fatalf("expected sorted sizes without duplicates got %v, %v", packs, err)
+	}
+	if err := s.SetSKUPacks(ctx, "A", []int{1000, 100}); err != nil {
+		t.Fatalf("SetSKUPacks: %v", err)
+	}
+	if packs, err := s.GetSKUPacks(ctx, "A"); err != nil || !reflect.DeepEqual(packs, []int{100, 1000}) {
+		t.Fatalf("expected the sizes replaced got %v, %v", packs, err)
+	}
+	if err := s.SetSKUPacks(ctx, "B", []int{}); err != nil {
+		t.Fatalf("SetSKUPacks: %v", err)
+	}
+	if packs, err := s.GetSKUPacks(ctx, "B"); err != nil || packs == nil || len(packs) != 0 {
+		t.Fatalf("expected no sizes, not nil, got %#v, %v", packs, err)
+	}
+	// SKUs are case sensitive
+	if _, err := s.GetSKUPacks(ctx, "a"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
+
+func testStock(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if stock, err := s.GetStock(ctx); err != nil || stock == nil || len(stock) != 0 {
+		t.Fatalf("expected no stock, not nil, got %#v, %v", stock, err)
+	}
+	if err := s.SetStock(ctx, map[int]int{250: 3, 500: 0}); err != nil {
+		t.Fatalf("SetStock: %v", err)
+	}
+	if stock, err := s.GetStock(ctx); err != nil || !reflect.DeepEqual(stock, map[int]int{250: 3, 500: 0}) {
+		t.Fatalf("GetStock = %v, %v", stock, err)
+	}
+	if err := s.SetStock(ctx, map[int]int{500: 7}); err != nil {
+		t.Fatalf("SetStock: %v", err)
+	}
+	if stock, err := s.GetStock(ctx); err != nil || !reflect.DeepEqual(stock, map[int]int{500: 7}) {
+		t.Fatalf("expected the stock replaced got %v, %v", stock, err)
+	}
+}
+
+func testAPIKeys(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	if keys, err := s.ListAPIKeys(ctx); err != nil || keys == nil || len(keys) != 0 {
+		t.Fatalf("expected no keys, not nil, got %#v, %v", keys, err)
+	}
+	start := time.Now().Add(-time.Second)
+	key, err := s.CreateAPIKey(ctx, store.APIKey{Name: "ci", Prefix: "pk_ab", Scopes: []string{"calculate", "admin"}}, "hash-1")
+	if err != nil || key.ID == 0 || key.Name != "ci" || key.CreatedAt.Before(start) || !key.RevokedAt.IsZero() {
+		t.Fatalf("CreateAPIKey = %+v, %v", key, err)
+	}
+	if _, err := s.CreateAPIKey(ctx, store.APIKey{Name: "dup", Prefix: "pk_cd"}, "hash-1"); err == nil {
+		t.Fatal("expected a duplicate hash to fail")
+	}
+	other, err := s.CreateAPIKey(ctx, store.APIKey{Name: "none", Prefix: "pk_ef"}, "hash-2")
+	if err != nil || other.ID <= key.ID {
+		t.Fatalf("CreateAPIKey = %+v, %v", other, err)
+	}
+
+	got, err := s.GetAPIKeyByHash(ctx, "hash-1")
+	if err != nil || got.ID != key.ID || got.Name != "ci" || got.Prefix != "pk_ab" || !reflect.DeepEqual(got.Scopes, []string{"calculate", "admin"}) {
+		t.Fatalf("GetAPIKeyByHash = %+v, %v", got, err)
+	}
+	if got, err := s.GetAPIKeyByHash(ctx, "hash-2"); err != nil || got.Scopes == nil || len(got.Scopes) != 0 {
+		t.Fatalf("expected no scopes, not nil, got %#v, %v", got.Scopes, err)
+	}
+	if _, err := s.GetAPIKeyByHash(ctx, "hash-3"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+
+	if err := s.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if err := s.RevokeAPIKey(ctx, key.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected revoking twice to be ErrNotFound got %v", err)
+	}
+	if err := s.RevokeAPIKey(ctx, 999); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+	if _, err := s.GetAPIKeyByHash(ctx, "hash-1"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("expected a revoked key to be ErrNotFound got %v", err)
+	}
+	// a revoked key keeps its hash
+	if _, err := s.CreateAPIKey(ctx, store.APIKey{Name: "again", Prefix: "pk_ab"}, "hash-1"); err == nil {
+		t.Fatal("expected the hash of a revoked key to stay taken")
+	}
+
+	keys, err := s.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("expected 2 keys got %+v, %v", keys, err)
+	}
+	if keys[0].ID != key.ID || keys[0].RevokedAt.Before(keys[0].CreatedAt) || !reflect.DeepEqual(keys[0].Scopes, key.Scopes) {
+		t.Fatalf("expected the revoked key first got %+v", keys[0])
+	}
+	if keys[1].ID != other.ID || !keys[1].RevokedAt.IsZero() || keys[1].Scopes == nil {
+		t.Fatalf("unexpected key %#v", keys[1])
+	}
+}
@@ -0,0 +1,63 @@
+package storetest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/svvictorelias/go-migrate/pkg/migrate"
+	"github.com/svvictorelias/shipping-pack-backend/internal/store"
+)
+
+// PostgresEnv names the Postgres database TestConformance_Postgres runs against.
+// Every table in it is emptied, so it must be a throwaway database.
+const PostgresEnv = "PACKCALC_TEST_DATABASE_URL"
+
+func TestConformance_Mock(t *testing.T) {
+	Run(t, func(t *testing.T) store.Store { return store.NewMockStore(nil) })
+}
+
+func TestConformance_SQLite(t *testing.T) {
+	Run(t, func(t *testing.T) store.Store {
+		db, err := store.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "packcalc.db"))
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return store.NewSQLiteStore(db)
+	})
+}
+
+func TestConformance_Postgres(t *testing.T) {
+	dsn := os.Getenv(PostgresEnv)
+	if dsn == "" {
+		t.Skip(PostgresEnv + " not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("open Postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := migrate.Run(db, "postgres", filepath.Join("..", "..", "database", "migrations"), false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	Run(t, func(t *testing.T) store.Store {
+		resetPostgres(t, db)
+		return store.NewPostgresStore(db)
+	})
+}
+
+// resetPostgres empties every table of db and restarts its ids, leaving
+// catalog version 1 active and empty as after the migrations.
+func resetPostgres(t *testing.T, db *sql.DB) {
+	t.Helper()
+	_, err := db.Exec(`TRUNCATE calculation_items, calculation_lines, calculations, sku_packs, skus, inventory, api_keys,
+    pack_catalog_active, pack_catalog_sizes, pack_catalog_versions RESTART IDENTITY CASCADE;
+INSERT INTO pack_catalog_versions(created_at) VALUES (NOW());
+INSERT INTO pack_catalog_active(version_id) VALUES (1);`)
+	if err != nil {
+		t.Fatalf("reset Postgres: %v", err)
+	}
+}
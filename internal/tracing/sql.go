@@ -0,0 +1,249 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/svvictorelias/shipping-pack-backend/internal/tracing"
+
+// OpenDB is sql.Open with a span for every statement, prepare, transaction
+// and ping run with a context that already carries a span, such as the
+// span of an HTTP request. Statements run outside of a trace, like those of
+// migrations at startup, are not traced.
+func OpenDB(driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	_ = db.Close()
+
+	var c driver.Connector = dsnConnector{dsn: dsn, d: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if c, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return sql.OpenDB(connector{Connector: c, system: driverName}), nil
+}
+
+// dsnConnector is the connector of drivers that have none.
+type dsnConnector struct {
+	dsn string
+	d   driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.d.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                        { return c.d }
+
+type connector struct {
+	driver.Connector
+	system string
+}
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) {
+	cn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: cn, system: c.system}, nil
+}
+
+// start starts a span for an operation of the database, or returns a span
+// that records nothing when ctx is not part of a trace.
+func start(ctx context.Context, system, name, query string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, noop.Span{}
+	}
+	attrs := []attribute.KeyValue{attribute.String("db.system.name", system)}
+	if query != "" {
+		attrs = append(attrs, attribute.String("db.query.text", query))
+	}
+	return otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// finish ends span like End, except that driver.ErrSkip, which makes
+// database/sql retry another way, is not a failure.
+func finish(span trace.Span, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		err = nil
+	}
+	End(span, err)
+}
+
+// conn forwards the optional interfaces of its driver.Conn, which
+// database/sql detects by type assertion, so that wrapping changes nothing
+// but the spans.
+type conn struct {
+	driver.Conn
+	system string
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (st driver.Stmt, err error) {
+	ctx, span := start(ctx, c.system, "sql.prepare", query)
+	defer func() { finish(span, err) }()
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		st, err = p.PrepareContext(ctx, query)
+	} else {
+		st, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{Stmt: st, conn: c.Conn, query: query, system: c.system}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (t driver.Tx, err error) {
+	spanCtx, span := start(ctx, c.system, "sql.begin", "")
+	defer func() { finish(span, err) }()
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = b.BeginTx(spanCtx, opts)
+	} else {
+		t, err = c.Conn.Begin() //nolint:staticcheck // the driver has nothing else
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tx{Tx: t, ctx: ctx, system: c.system}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (res driver.Result, err error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := start(ctx, c.system, "sql.exec", query)
+	defer func() { finish(span, err) }()
+	return e.ExecContext(ctx, query, args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	ctx, span := start(ctx, c.system, "sql.query", query)
+	defer func() { finish(span, err) }()
+	return q.QueryContext(ctx, query, args)
+}
+
+func (c *conn) Ping(ctx context.Context) (err error) {
+	p, ok := c.Conn.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	ctx, span := start(ctx, c.system, "sql.ping", "")
+	defer func() { finish(span, err) }()
+	return p.Ping(ctx)
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type stmt struct {
+	driver.Stmt
+	conn   driver.Conn
+	query  string
+	system string
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	ctx, span := start(ctx, s.system, "sql.exec", s.query)
+	defer func() { finish(span, err) }()
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		return e.ExecContext(ctx, args)
+	}
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Exec(vals) //nolint:staticcheck // the driver has nothing else
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	ctx, span := start(ctx, s.system, "sql.query", s.query)
+	defer func() { finish(span, err) }()
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		return q.QueryContext(ctx, args)
+	}
+	vals, err := values(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.Stmt.Query(vals) //nolint:staticcheck // the driver has nothing else
+}
+
+// CheckNamedValue is the checker of the statement or else of its
+// connection, which database/sql would otherwise pick.
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	if n, ok := s.conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// values converts args for drivers without context support, which take
+// positional arguments only.
+func values(args []driver.NamedValue) ([]driver.Value, error) {
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		if a.Name != "" {
+			return nil, errors.New("tracing: driver does not support named parameters")
+		}
+		out[i] = a.Value
+	}
+	return out, nil
+}
+
+// tx traces the end of a transaction under the context it began with.
+type tx struct {
+	driver.Tx
+	ctx    context.Context
+	system string
+}
+
+func (t *tx) Commit() (err error) {
+	_, span := start(t.ctx, t.system, "sql.commit", "")
+	defer func() { finish(span, err) }()
+	return t.Tx.Commit()
+}
+
+func (t *tx) Rollback() (err error) {
+	_, span := start(t.ctx, t.system, "sql.rollback", "")
+	defer func() { finish(span, err) }()
+	return t.Tx.Rollback()
+}
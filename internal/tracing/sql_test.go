@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestOpenDB_Spans(t *testing.T) {
+	_, mock, err := sqlmock.NewWithDSN("tracing_spans")
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	db, err := OpenDB("sqlmock", "tracing_spans")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	sr := record(t)
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO inventory(pack_size, quantity) VALUES($1,$2)")).
+		ExpectExec().WithArgs(250, 3).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pack_size, quantity FROM inventory")).
+		WillReturnRows(sqlmock.NewRows([]string{"pack_size", "quantity"}).AddRow(250, 3))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO inventory(pack_size, quantity) VALUES($1,$2)")
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	if _, err := stmt.ExecContext(ctx, 250, 3); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT pack_size, quantity FROM inventory")
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	rows.Close()
+	parent.End()
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+
+	var names []string
+	for _, s := range sr.Ended() {
+		if s.Name() == "request" {
+			continue
+		}
+		names = append(names, s.Name())
+		if s.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("%s: expected the request span as parent", s.Name())
+		}
+	}
+	want := []string{"sql.begin", "sql.prepare", "sql.exec", "sql.commit", "sql.query"}
+	if len(names) != len(want) {
+		t.Fatalf("expected spans %v got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("expected spans %v got %v", want, names)
+		}
+	}
+
+	query := sr.Ended()[4]
+	attrs := attribute.NewSet(query.Attributes()...)
+	if v, _ := attrs.Value("db.query.text"); v.AsString() != "SELECT pack_size, quantity FROM inventory" {
+		t.Errorf("unexpected db.query.text %q", v.AsString())
+	}
+	if v, _ := attrs.Value("db.system.name"); v.AsString() != "sqlmock" {
+		t.Errorf("unexpected db.system.name %q", v.AsString())
+	}
+}
+
+func TestOpenDB_NoTrace(t *testing.T) {
+	_, mock, err := sqlmock.NewWithDSN("tracing_no_trace", sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("error creating sqlmock: %v", err)
+	}
+	db, err := OpenDB("sqlmock", "tracing_no_trace")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+	sr := record(t)
+
+	mock.ExpectPing()
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM inventory")).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := db.PingContext(context.Background()); err != nil {
+		t.Fatalf("ping: %v", err)
+	}
+	if _, err := db.ExecContext(context.Background(), "DELETE FROM inventory"); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+	if n := len(sr.Ended()); n != 0 {
+		t.Fatalf("expected no spans outside of a trace got %d", n)
+	}
+}
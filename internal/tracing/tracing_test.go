@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// record installs a tracer provider recording every span for the duration
+// of the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return sr
+}
+
+func TestSetup_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	prev := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	shutdown, err := Setup(Options{Exporter: ExporterFile, File: path, SampleRatio: 1, Service: "packcalc"})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "work")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read spans: %v", err)
+	}
+	var got struct {
+		Name     string
+		Resource []struct{ Key string }
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("expected one JSON span got %s: %v", b, err)
+	}
+	if got.Name != "work" || len(got.Resource) == 0 || got.Resource[0].Key != "service.name" {
+		t.Fatalf("unexpected span %s", b)
+	}
+	if fields := otel.GetTextMapPropagator().Fields(); !strings.Contains(strings.Join(fields, ","), "traceparent") {
+		t.Fatalf("expected the W3C propagator got fields %v", fields)
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+}
+
+func TestSetup_Errors(t *testing.T) {
+	if _, err := Setup(Options{Exporter: "jaeger"}); err == nil || !strings.Contains(err.Error(), `unknown exporter "jaeger"`) {
+		t.Fatalf("expected unknown exporter error got %v", err)
+	}
+	if _, err := Setup(Options{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "spans.json")}); err == nil {
+		t.Fatal("expected an error for an unwritable file")
+	}
+	shutdown, err := Setup(Options{Exporter: ExporterNone})
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Fatalf("expected none to succeed got %v", err)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	sr := record(t)
+	tracer := otel.Tracer("test")
+	_, ok := tracer.Start(context.Background(), "ok")
+	End(ok, nil)
+	_, failed := tracer.Start(context.Background(), "failed")
+	End(failed, errors.New("boom"))
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Unset || len(spans[0].Events()) != 0 {
+		t.Errorf("expected a successful span got %+v", spans[0].Status())
+	}
+	if spans[1].Status() != (sdktrace.Status{Code: codes.Error, Description: "boom"}) || len(spans[1].Events()) != 1 {
+		t.Errorf("expected a failed span with the error got %+v", spans[1].Status())
+	}
+}